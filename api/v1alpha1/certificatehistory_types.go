@@ -0,0 +1,113 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MonitorLabel names the CertificateMonitor a CertificateHistory belongs to.
+const MonitorLabel = "monitoring.egarciam.com/monitor"
+
+// CertificateHistorySpec identifies the certificate a history is kept for.
+// Histories are written by the controller, one per certificate of a monitor.
+type CertificateHistorySpec struct {
+	// Monitor is the CertificateMonitor recording the history.
+	Monitor string `json:"monitor"`
+	// Certificate is the name of the certificate in the monitor status, e.g.
+	// "internal-shop-web".
+	Certificate string `json:"certificate"`
+	// Type is the certificate source: internal, external or endpoint.
+	Type string `json:"type"`
+	// Path is the cluster location, host path or endpoint of the certificate.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// CertificateObservation is one certificate found at the location of a
+// history.
+type CertificateObservation struct {
+	// SerialNumber is the certificate serial number in hex.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// Fingerprint is the SHA-256 fingerprint of the certificate.
+	Fingerprint string `json:"fingerprint"`
+	// NotBefore is the start of the validity period in RFC 3339.
+	// +optional
+	NotBefore string `json:"notBefore,omitempty"`
+	// NotAfter is the end of the validity period in RFC 3339.
+	// +optional
+	NotAfter string `json:"notAfter,omitempty"`
+	// FirstObserved is when a scan first found the certificate.
+	FirstObserved metav1.Time `json:"firstObserved"`
+	// LastObserved is when a scan last found the certificate.
+	LastObserved metav1.Time `json:"lastObserved"`
+	// RenewedBeforeExpiry is how long before NotAfter the certificate was
+	// replaced, negative when it was replaced after expiring. It is set once
+	// a replacement is observed.
+	// +optional
+	RenewedBeforeExpiry *metav1.Duration `json:"renewedBeforeExpiry,omitempty"`
+}
+
+// CertificateHistoryStatus lists the certificates observed at a location.
+type CertificateHistoryStatus struct {
+	// Observations are the latest certificates, oldest first. The oldest are
+	// dropped beyond the history limit of the controller.
+	// +optional
+	Observations []CertificateObservation `json:"observations,omitempty"`
+	// Renewals counts the replacements observed, including those of dropped
+	// observations.
+	// +optional
+	Renewals int32 `json:"renewals,omitempty"`
+	// LastRenewed is when the current certificate replaced the previous one.
+	// +optional
+	LastRenewed *metav1.Time `json:"lastRenewed,omitempty"`
+	// Expired is set when the current certificate expired without being
+	// replaced.
+	// +optional
+	Expired bool `json:"expired,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=certhistory
+//+kubebuilder:printcolumn:name="Certificate",type=string,JSONPath=`.spec.certificate`
+//+kubebuilder:printcolumn:name="Renewals",type=integer,JSONPath=`.status.renewals`
+//+kubebuilder:printcolumn:name="Last Renewed",type=string,format=date-time,JSONPath=`.status.lastRenewed`
+//+kubebuilder:printcolumn:name="Expired",type=boolean,JSONPath=`.status.expired`
+
+// CertificateHistory is the Schema for the certificatehistories API
+type CertificateHistory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertificateHistorySpec   `json:"spec,omitempty"`
+	Status CertificateHistoryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CertificateHistoryList contains a list of CertificateHistory
+type CertificateHistoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CertificateHistory `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CertificateHistory{}, &CertificateHistoryList{})
+}
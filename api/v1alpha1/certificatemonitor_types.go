@@ -41,16 +41,289 @@ type CertificateMonitorSpec struct {
 	DiscoverInternal bool `json:"discoverInternal,omitempty"`
 	DiscoverExternal bool `json:"discoverExternal,omitempty"`
 	SendMail         bool `json:"sendMail,omitempty"`
+
+	// SMTP references the mail transport settings used when SendMail is set.
+	// Without it the in-cluster MailHog test server is used.
+	// +optional
+	SMTP *SMTPConfigReference `json:"smtp,omitempty"`
+
+	// ReminderInterval is how often a certificate that stays expiring or
+	// expired is notified again. Notifications are otherwise only sent when
+	// the status of a certificate changes. Defaults to 24h; "0s" disables
+	// reminders.
+	// +optional
+	ReminderInterval *metav1.Duration `json:"reminderInterval,omitempty"`
+
+	// Digest groups all findings of a monitor into a single mail instead of
+	// one mail per certificate: "scan" sends one per full scan, "daily" at
+	// most one a day. Defaults to "none".
+	// +optional
+	Digest DigestMode `json:"digest,omitempty"`
+
+	// Endpoints lists HTTPS endpoints ("https://host[:port]" or "host:port")
+	// whose serving certificate is probed on every scan.
+	// +optional
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// Templates names a ConfigMap in the monitor namespace with custom
+	// notification templates (keys alert.subject, alert.text, alert.html,
+	// digest.subject, digest.text, digest.html). Missing keys keep the
+	// built-in template.
+	// +optional
+	Templates string `json:"templates,omitempty"`
+
+	// Webhook posts every alert as JSON to an HTTP endpoint, in addition to
+	// email. Digest mode only applies to email.
+	// +optional
+	Webhook *WebhookConfig `json:"webhook,omitempty"`
+
+	// Slack posts every alert to a Slack incoming webhook.
+	// +optional
+	Slack *IncomingWebhookReference `json:"slack,omitempty"`
+
+	// Teams posts every alert to a Microsoft Teams incoming webhook.
+	// +optional
+	Teams *IncomingWebhookReference `json:"teams,omitempty"`
+
+	// Alertmanager pushes critical and expired certificates to an
+	// Alertmanager and resolves them once the certificate is valid again.
+	// +optional
+	Alertmanager *AlertmanagerConfig `json:"alertmanager,omitempty"`
+
+	// PagerDuty opens PagerDuty incidents for critical and expired
+	// certificates and resolves them once the certificate is valid again.
+	// +optional
+	PagerDuty *PagerDutyConfig `json:"pagerDuty,omitempty"`
+
+	// NotificationPolicy names a NotificationPolicy in the monitor namespace
+	// routing the alerts to channels and email recipients. Without it every
+	// configured channel gets every alert, and email goes to the recipients
+	// of the legacy email-recipients-config ConfigMap in "default".
+	// +optional
+	NotificationPolicy string `json:"notificationPolicy,omitempty"`
+
+	// BusinessHours restricts warnings, the alerts about expiring
+	// certificates, to a weekly window; outside it they wait for the window
+	// to open. Critical and expired certificates are notified at any time.
+	// +optional
+	BusinessHours *BusinessHours `json:"businessHours,omitempty"`
+
+	// Escalation notifies further recipients about certificates that stay
+	// critical or expired, without being renewed, for too long.
+	// +optional
+	Escalation *EscalationConfig `json:"escalation,omitempty"`
+
+	// Schedule controls how often the monitor rescans. It accepts a duration
+	// ("15m", "24h") or a standard cron expression ("0 6 * * *", "@daily").
+	// Defaults to the manager's --check-interval-minutes.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// DigestMode selects how findings are mailed.
+// +kubebuilder:validation:Enum=none;scan;daily
+type DigestMode string
+
+const (
+	// DigestNone mails every certificate alert on its own.
+	DigestNone DigestMode = "none"
+	// DigestPerScan mails one digest per full scan with findings.
+	DigestPerScan DigestMode = "scan"
+	// DigestDaily mails at most one digest every 24 hours.
+	DigestDaily DigestMode = "daily"
+)
+
+// BusinessHours is a daily time window on some weekdays.
+type BusinessHours struct {
+	// Days are the weekdays of the window. Defaults to Monday to Friday.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+	// Start is when the window opens each day, as "HH:MM". Defaults to 09:00.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	// +optional
+	Start string `json:"start,omitempty"`
+	// End is when the window closes each day, as "HH:MM". Defaults to 18:00.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	// +optional
+	End string `json:"end,omitempty"`
+	// TimeZone is the IANA time zone of the window, e.g. "Europe/Madrid".
+	// Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
+// Weekday is a three-letter day name.
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type Weekday string
+
+// EscalationConfig sends a one-off escalation for certificates left
+// unattended.
+type EscalationConfig struct {
+	// After is how long a certificate has to stay critical or expired before
+	// it is escalated, e.g. "12h".
+	After metav1.Duration `json:"after"`
+	// Recipients are the email addresses the escalation is mailed to.
+	// +optional
+	Recipients []string `json:"recipients,omitempty"`
+	// Channels are the other channels the escalation is sent to. They still
+	// have to be configured on the monitor.
+	// +optional
+	Channels []NotificationChannel `json:"channels,omitempty"`
+}
+
+// SMTPConfigReference points to the objects, in the monitor namespace, holding
+// the SMTP settings: host, port, from, tls ("starttls" or "tls"),
+// insecureSkipVerify, username, password and ca.crt. Keys may live in either
+// object; the Secret wins when both define one.
+type SMTPConfigReference struct {
+	// ConfigMapName is the ConfigMap with the non-sensitive settings.
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// SecretName is the Secret with the credentials and CA bundle.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// WebhookConfig describes a webhook receiving alerts.
+type WebhookConfig struct {
+	// URL receives a POST request per alert.
+	URL string `json:"url"`
+	// SecretName is a Secret in the monitor namespace. Its "signing-key" key,
+	// when present, signs requests with HMAC-SHA256; every other key is sent
+	// as a request header.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// MaxRetries is how many times the notification queue retries a failed
+	// delivery, with its backoff, before the alert is dead-lettered to the
+	// controller log. Defaults to the --notification-max-attempts flag.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+}
+
+// IncomingWebhookReference points to the Secret, in the monitor namespace,
+// holding the URL of a chat incoming webhook.
+type IncomingWebhookReference struct {
+	// SecretName is the Secret holding the webhook URL.
+	SecretName string `json:"secretName"`
+	// Key is the Secret key holding the webhook URL. Defaults to "url".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// AlertmanagerConfig describes the Alertmanager receiving alerts.
+type AlertmanagerConfig struct {
+	// URL is the Alertmanager base URL, e.g. "http://alertmanager:9093".
+	URL string `json:"url"`
+	// SecretName is a Secret in the monitor namespace whose keys are sent as
+	// request headers, e.g. Authorization.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// TTL is how long an alert keeps firing without being sent again.
+	// Every full scan sends the firing alerts again, so it has to exceed the
+	// scan interval. Defaults to the time until the third next scan.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// PagerDutyConfig describes the PagerDuty Events API v2 integration.
+type PagerDutyConfig struct {
+	// SecretName is the Secret, in the monitor namespace, holding the
+	// integration routing key.
+	SecretName string `json:"secretName"`
+	// Key is the Secret key holding the routing key. Defaults to "routingKey".
+	// +optional
+	Key string `json:"key,omitempty"`
+	// URL overrides the Events API endpoint.
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+// NotifyAnnotation lists extra email recipients, comma separated, for the
+// certificates of a Secret or Node, or of every Secret in a Namespace. They
+// are merged with the recipients of the monitor.
+const NotifyAnnotation = "certchecker.io/notify"
+
+// SilenceUntilAnnotation silences the certificates of a Secret or Node until
+// the given time, as RFC 3339 or a "2006-01-02" date (midnight UTC), e.g.
+// while a known certificate is being replaced.
+const SilenceUntilAnnotation = "certchecker.io/silence-until"
+
+// RescanAnnotation forces an immediate rescan of a CertificateMonitor when set
+// to any value. The controller removes it once the scan has completed.
+const RescanAnnotation = "monitoring.egarciam.com/rescan"
+
 // MonitoredCertificateStatus represents the status of a monitored certificate.
 type MonitoredCertificateStatus struct {
 	Name      string `json:"name"`
 	Type      string `json:"type"`   //"internal", "external"
 	Path      string `json:"path"`   // cluster location | host path
-	Status    string `json:"status"` // "valid", "expiring", "expired"
+	Status    string `json:"status"` // "valid", "expiring", "critical", "expired"
 	Expiry    string `json:"expiry,omitempty"`
 	Namespace string `json:"namespace"`
+	// Node is the node holding an external certificate.
+	// +optional
+	Node string `json:"node,omitempty"`
+
+	// Fingerprint is the SHA-256 fingerprint of the certificate, used to tell
+	// a renewed certificate from the one that was alerted on.
+	// +optional
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Subject is the distinguished name of the certificate subject.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+	// Issuer is the distinguished name of the certificate issuer.
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+	// DNSNames lists the DNS subject alternative names.
+	// +optional
+	DNSNames []string `json:"dnsNames,omitempty"`
+	// NotBefore is the start of the validity period in RFC 3339.
+	// +optional
+	NotBefore string `json:"notBefore,omitempty"`
+	// SerialNumber is the certificate serial number in hex.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// ManagedBy names the controller renewing the certificate, e.g.
+	// cert-manager.
+	// +optional
+	ManagedBy string `json:"managedBy,omitempty"`
+	// Owner is the team owning the certificate, named by an owner label or
+	// annotation of its secret, of the objects owning the secret, or of its
+	// namespace.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// UsedBy lists the workloads referencing the secret of an internal
+	// certificate, found at the last full scan.
+	// +optional
+	UsedBy []WorkloadReference `json:"usedBy,omitempty"`
+	// LastNotifiedStatus is the status recipients were last notified about.
+	// +optional
+	LastNotifiedStatus string `json:"lastNotifiedStatus,omitempty"`
+	// LastNotified is when the last notification for this certificate was sent.
+	// +optional
+	LastNotified *metav1.Time `json:"lastNotified,omitempty"`
+	// StatusSince is when the certificate entered its current status, or
+	// was last renewed.
+	// +optional
+	StatusSince *metav1.Time `json:"statusSince,omitempty"`
+	// Escalated is when the certificate was escalated. It is cleared when the
+	// status changes or the certificate is renewed.
+	// +optional
+	Escalated *metav1.Time `json:"escalated,omitempty"`
+	// SilencedUntil is when the silence covering the certificate ends. No
+	// alerts are sent for it until then.
+	// +optional
+	SilencedUntil *metav1.Time `json:"silencedUntil,omitempty"`
+}
+
+// WorkloadReference names an object referencing a certificate secret.
+type WorkloadReference struct {
+	// Kind is Pod, Deployment, StatefulSet, Ingress, Gateway or
+	// ServiceAccount.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
 }
 
 // CertificateMonitorStatus defines the observed state of CertificateMonitor
@@ -58,6 +331,23 @@ type CertificateMonitorStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	MonitoredCertificates []MonitoredCertificateStatus `json:"monitoredCertificates"`
+
+	// LastScanTime is when the last full scan was run.
+	// +optional
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+	// NextScanTime is when the next full scan is due.
+	// +optional
+	NextScanTime *metav1.Time `json:"nextScanTime,omitempty"`
+	// LastDigestTime is when the last digest mail was sent.
+	// +optional
+	LastDigestTime *metav1.Time `json:"lastDigestTime,omitempty"`
+	// UnroutableCertificates lists the alerting certificates that no
+	// configured channel or recipient receives.
+	// +optional
+	UnroutableCertificates []string `json:"unroutableCertificates,omitempty"`
+	// ObservedGeneration is the spec generation the last scan was run against.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,65 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CertificateSilenceSpec defines which certificates are silenced and until
+// when. It applies to the monitors in its namespace.
+type CertificateSilenceSpec struct {
+	// Match selects the silenced certificates, like the match of a
+	// notification route. An empty match silences every certificate.
+	// +optional
+	Match NotificationMatch `json:"match,omitempty"`
+	// Certificates are the names of the silenced certificates as listed in
+	// the monitor status, e.g. "internal-shop-web".
+	// +optional
+	Certificates []string `json:"certificates,omitempty"`
+	// Until is when the silence ends.
+	Until metav1.Time `json:"until"`
+	// Reason tells why the certificates are silenced.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:shortName=certsilence
+//+kubebuilder:printcolumn:name="Until",type=string,format=date-time,JSONPath=`.spec.until`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.spec.reason`
+
+// CertificateSilence is the Schema for the certificatesilences API
+type CertificateSilence struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CertificateSilenceSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CertificateSilenceList contains a list of CertificateSilence
+type CertificateSilenceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CertificateSilence `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CertificateSilence{}, &CertificateSilenceList{})
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotificationChannel names a notification channel of a CertificateMonitor.
+// +kubebuilder:validation:Enum=email;webhook;slack;teams;alertmanager;pagerduty
+type NotificationChannel string
+
+const (
+	ChannelEmail        NotificationChannel = "email"
+	ChannelWebhook      NotificationChannel = "webhook"
+	ChannelSlack        NotificationChannel = "slack"
+	ChannelTeams        NotificationChannel = "teams"
+	ChannelAlertmanager NotificationChannel = "alertmanager"
+	ChannelPagerDuty    NotificationChannel = "pagerduty"
+)
+
+// NotificationPolicySpec defines how the alerts of the monitors referencing
+// the policy are routed.
+type NotificationPolicySpec struct {
+	// Routes are evaluated in order. The first matching route applies, and
+	// the following ones too while the matching routes set Continue.
+	// Certificates matching no route are not notified.
+	Routes []NotificationRoute `json:"routes"`
+}
+
+// NotificationRoute sends the certificates it matches to channels and
+// recipients.
+type NotificationRoute struct {
+	// Match selects the certificates of the route. An empty match selects
+	// every certificate.
+	// +optional
+	Match NotificationMatch `json:"match,omitempty"`
+	// Channels lists the channels the alerts are sent to. The channels still
+	// have to be configured on the CertificateMonitor.
+	Channels []NotificationChannel `json:"channels"`
+	// Recipients are the email addresses used by the email channel.
+	// +optional
+	Recipients []string `json:"recipients,omitempty"`
+	// Continue keeps evaluating the following routes after this one matched.
+	// +optional
+	Continue bool `json:"continue,omitempty"`
+}
+
+// NotificationMatch selects certificates. All the criteria set have to match;
+// a list matches when it contains the value.
+type NotificationMatch struct {
+	// Severities are certificate statuses: expiring, critical or expired.
+	// Resolved alerts match the severity they resolve.
+	// +optional
+	Severities []string `json:"severities,omitempty"`
+	// Namespaces are the namespaces of the certificate secrets. Node and
+	// endpoint certificates have no namespace.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector matches the labels of the object holding the certificate: the
+	// Secret for internal certificates, the Node for external ones. Endpoint
+	// certificates have no labels.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Owners are the owners of the certificates, as resolved from the owner
+	// keys of the controller.
+	// +optional
+	Owners []string `json:"owners,omitempty"`
+	// Types are the certificate sources: internal, external or endpoint.
+	// +optional
+	Types []string `json:"types,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:shortName=notifpol
+
+// NotificationPolicy is the Schema for the notificationpolicies API
+type NotificationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NotificationPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NotificationPolicyList contains a list of NotificationPolicy
+type NotificationPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NotificationPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NotificationPolicy{}, &NotificationPolicyList{})
+}
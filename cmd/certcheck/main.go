@@ -0,0 +1,194 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// certcheck checks certificates without a cluster, e.g. on bastions or in
+// build artifacts.
+//
+//	certcheck scan [OPTIONS] PATH...
+//
+// scan walks the given files and directories and evaluates every PEM
+// certificate the way the controller evaluates the certificates of the
+// nodes. It exits with 1 when any certificate is expiring, critical or
+// expired, and with 2 when the scan itself fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/report"
+	"egarciam.com/checkcert/internal/scan"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitError    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprintln(stderr, "Usage: certcheck scan [OPTIONS] PATH...")
+		fmt.Fprintln(stderr, "\nRun \"certcheck scan -h\" for the options.")
+		if len(args) == 0 {
+			return exitError
+		}
+		return exitOK
+	}
+	switch args[0] {
+	case "scan":
+		return runScan(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "Error: unknown command %q\n", args[0])
+		return exitError
+	}
+}
+
+// patterns is a repeatable flag of glob patterns, also accepting comma
+// separated lists.
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*p = append(*p, s)
+		}
+	}
+	return nil
+}
+
+func runScan(args []string, stdout, stderr io.Writer) int {
+	var (
+		opts     scan.Options
+		include  patterns
+		exclude  patterns
+		output   string
+		hostname string
+	)
+	fs := flag.NewFlagSet("certcheck scan", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: certcheck scan [OPTIONS] PATH...\n\n")
+		fmt.Fprintf(stderr, "Evaluates the PEM certificates in the given files and directories.\n")
+		fmt.Fprintf(stderr, "Exits with 1 when a certificate is expiring, critical or expired.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Var(&include, "include", "Glob pattern of the files to check, matched against the file name or the path below the scanned directory. Repeatable. Defaults to *.crt and *.pem.")
+	fs.Var(&exclude, "exclude", "Glob pattern of the files and directories to skip, matched like --include. Repeatable.")
+	fs.BoolVar(&opts.FollowSymlinks, "follow-symlinks", false, "Follow symbolic links below the scanned directories.")
+	fs.StringVar(&output, "output", "table", "Output format: table, or a report format: "+report.FormatList()+".")
+	fs.StringVar(&output, "o", "table", "Shorthand for --output.")
+	fs.StringVar(&hostname, "node", "", "Name recorded as the node of the results. Defaults to the host name.")
+	config.DefaultWarningDays = fs.Int("warning-expiration-days", 30, "Number of days to consider a certificate as expiring soon")
+	config.DefaultCriticalDays = fs.Int("critical-expiration-days", 7, "Number of days to consider a certificate critical")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitError
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "Error: expected at least one path")
+		fs.Usage()
+		return exitError
+	}
+	format, err := outputFormat(output)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	for _, p := range [][]string{include, exclude} {
+		if err := scan.ValidatePatterns(p); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	opts.Include, opts.Exclude = include, exclude
+	if len(opts.Include) == 0 {
+		opts.Include = []string{"*.crt", "*.pem"}
+	}
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	files, errs := scan.Walk(fs.Args(), opts)
+	for _, err := range errs {
+		fmt.Fprintf(stderr, "Warning: %v\n", err)
+	}
+	statuses := make([]monitoringv1alpha1.MonitoredCertificateStatus, 0, len(files))
+	for _, f := range files {
+		s, err := certeval.EvaluateCertificateFile(f, hostname)
+		if err != nil {
+			// Key files and other PEM data share the certificate extensions.
+			fmt.Fprintf(stderr, "Warning: skipping %v\n", err)
+			continue
+		}
+		statuses = append(statuses, s)
+	}
+	if len(files) == 0 && len(errs) > 0 {
+		return exitError
+	}
+
+	if err := printResults(stdout, format, statuses, time.Now()); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	for _, s := range statuses {
+		if s.Status != "valid" {
+			return exitFindings
+		}
+	}
+	return exitOK
+}
+
+// printResults writes the certificates as a table, or as a report when a
+// format is given.
+func printResults(out io.Writer, format report.Format, statuses []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) error {
+	if format != "" {
+		return report.Write(out, format, report.New(statuses, now))
+	}
+	return report.WriteTable(out, []report.Column{
+		{Header: "PATH", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Path }},
+		{Header: "STATUS", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Status }},
+		{Header: "EXPIRES", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Expiry }},
+		report.DaysColumn(now),
+		{Header: "SUBJECT", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Subject }},
+		{Header: "ISSUER", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Issuer }},
+	}, statuses, "No certificates found.")
+}
+
+// outputFormat reads the --output flag: an empty format is the table.
+func outputFormat(output string) (report.Format, error) {
+	if output == "table" {
+		return "", nil
+	}
+	return report.ParseFormat(output)
+}
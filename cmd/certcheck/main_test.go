@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"egarciam.com/checkcert/internal/report"
+)
+
+var _ = Describe("certcheck scan", func() {
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+	writeCert := func(name string, notAfter time.Time) string {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(dir, name+".crt")
+		Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+		return path
+	}
+	scan := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"scan", "--node", "bastion"}, args...), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	It("prints a table of the certificates", func() {
+		path := writeCert("web", time.Now().Add(100*24*time.Hour+time.Hour))
+		code, out, _ := scan(dir)
+		Expect(code).To(Equal(exitOK))
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"PATH", "STATUS", "EXPIRES", "DAYS", "SUBJECT", "ISSUER"}))
+		row := strings.Fields(lines[1])
+		Expect(row[0]).To(Equal(path))
+		Expect(row[1]).To(Equal("valid"))
+		Expect(row[3]).To(Equal("100"))
+		Expect(row[4]).To(Equal("CN=web"))
+	})
+
+	It("says when no certificate was found", func() {
+		code, out, _ := scan(dir)
+		Expect(code).To(Equal(exitOK))
+		Expect(out).To(Equal("No certificates found.\n"))
+	})
+
+	It("renders a JSON report and exits with findings", func() {
+		writeCert("old", time.Now().Add(-24*time.Hour))
+		writeCert("web", time.Now().Add(100*24*time.Hour))
+		code, out, _ := scan("-o", "json", dir)
+		Expect(code).To(Equal(exitFindings))
+		var doc report.Document
+		Expect(json.Unmarshal([]byte(out), &doc)).To(Succeed())
+		Expect(doc.Summary).To(Equal(map[string]int{"expired": 1, "valid": 1}))
+		Expect(doc.Certificates).To(HaveLen(2))
+		Expect(doc.Certificates[0].Node).To(Equal("bastion"))
+		Expect(doc.Certificates[0].Subject).To(Equal("CN=old"))
+	})
+
+	It("rejects unknown output formats", func() {
+		code, _, stderr := scan("-o", "pdf", dir)
+		Expect(code).To(Equal(exitError))
+		Expect(stderr).To(ContainSubstring("unknown report format"))
+	})
+})
@@ -0,0 +1,214 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-certcheck lists the kubernetes.io/tls secrets of a namespace, or of
+// the whole cluster, with the status the controller would give them. Installed
+// on the PATH it runs as "kubectl certcheck".
+//
+// It exits with 1 when any certificate is expiring, critical, expired or
+// unreadable, and with 2 when the check itself fails, so it can gate CI jobs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// so every kubeconfig that works with kubectl works here.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/report"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitError    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var (
+		kubeconfig    string
+		kubeContext   string
+		namespace     string
+		allNamespaces bool
+		timeout       time.Duration
+		output        string
+	)
+	fs := flag.NewFlagSet("kubectl-certcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: kubectl certcheck [OPTIONS] [NAMESPACE]\n\n")
+		fmt.Fprintf(stderr, "Lists kubernetes.io/tls secrets with their expiry, issuer and status.\n")
+		fmt.Fprintf(stderr, "Exits with 1 when a certificate is expiring, critical, expired or unreadable.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config.")
+	fs.StringVar(&kubeContext, "context", "", "The kubeconfig context to use.")
+	fs.StringVar(&namespace, "namespace", "", "Namespace to check. Defaults to the namespace of the context.")
+	fs.StringVar(&namespace, "n", "", "Shorthand for --namespace.")
+	fs.BoolVar(&allNamespaces, "all-namespaces", false, "Check every namespace.")
+	fs.BoolVar(&allNamespaces, "A", false, "Shorthand for --all-namespaces.")
+	fs.StringVar(&output, "output", "table", "Output format: table, or a report format: "+report.FormatList()+".")
+	fs.StringVar(&output, "o", "table", "Shorthand for --output.")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "Timeout of the API requests.")
+	config.DefaultWarningDays = fs.Int("warning-expiration-days", 30, "Number of days to consider a certificate as expiring soon")
+	config.DefaultCriticalDays = fs.Int("critical-expiration-days", 7, "Number of days to consider a certificate critical")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitError
+	}
+
+	format, err := outputFormat(output)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	switch {
+	case fs.NArg() > 1:
+		fmt.Fprintln(stderr, "Error: expected at most one namespace")
+		return exitError
+	case fs.NArg() == 1 && allNamespaces:
+		fmt.Fprintln(stderr, "Error: a namespace cannot be given together with --all-namespaces")
+		return exitError
+	case fs.NArg() == 1:
+		namespace = fs.Arg(0)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: unable to load kubeconfig: %v\n", err)
+		return exitError
+	}
+	switch {
+	case allNamespaces:
+		namespace = metav1.NamespaceAll
+	case namespace == "":
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			fmt.Fprintf(stderr, "Error: unable to determine the namespace: %v\n", err)
+			return exitError
+		}
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	statuses, failed, err := checkSecrets(ctx, clientset, namespace, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if err := printResults(stdout, format, statuses, allNamespaces, time.Now()); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	for _, s := range statuses {
+		if s.Status != "valid" {
+			failed = true
+		}
+	}
+	if failed {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// checkSecrets evaluates the TLS secrets of a namespace, or of all of them
+// when namespace is empty. Secrets that cannot be parsed are reported on
+// stderr and make failed true.
+func checkSecrets(ctx context.Context, clientset kubernetes.Interface, namespace string, stderr io.Writer) ([]monitoringv1alpha1.MonitoredCertificateStatus, bool, error) {
+	list, err := clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("type", string(corev1.SecretTypeTLS)).String(),
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to list TLS secrets: %w", err)
+	}
+
+	var statuses []monitoringv1alpha1.MonitoredCertificateStatus
+	failed := false
+	for i := range list.Items {
+		s, err := certeval.EvaluateSecret(&list.Items[i])
+		if err != nil {
+			fmt.Fprintf(stderr, "Warning: %v\n", err)
+			failed = true
+			continue
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Path < statuses[j].Path })
+	return statuses, failed, nil
+}
+
+// printResults writes the certificates as a table in the layout of kubectl
+// get, or as a report when a format is given.
+func printResults(out io.Writer, format report.Format, statuses []monitoringv1alpha1.MonitoredCertificateStatus, allNamespaces bool, now time.Time) error {
+	if format != "" {
+		return report.Write(out, format, report.New(statuses, now))
+	}
+	var columns []report.Column
+	if allNamespaces {
+		columns = append(columns, report.Column{Header: "NAMESPACE", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Namespace }})
+	}
+	columns = append(columns,
+		report.Column{Header: "NAME", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Path[len(c.Namespace)+1:] }},
+		report.Column{Header: "STATUS", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Status }},
+		report.Column{Header: "EXPIRES", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Expiry }},
+		report.DaysColumn(now),
+		report.Column{Header: "ISSUER", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Issuer }},
+		report.Column{Header: "CERT-MANAGER", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string {
+			return strconv.FormatBool(c.ManagedBy == "cert-manager")
+		}},
+	)
+	return report.WriteTable(out, columns, statuses, "No TLS secrets found.")
+}
+
+// outputFormat reads the --output flag: an empty format is the table.
+func outputFormat(output string) (report.Format, error) {
+	if output == "table" {
+		return "", nil
+	}
+	return report.ParseFormat(output)
+}
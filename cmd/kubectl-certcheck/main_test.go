@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/report"
+)
+
+var _ = Describe("kubectl certcheck", func() {
+	now := time.Now()
+	tlsSecret := func(namespace, name string, notAfter time.Time, annotations map[string]string) *corev1.Secret {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Annotations: annotations},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})},
+		}
+	}
+	check := func(namespace string) ([]string, bool) {
+		clientset := fake.NewSimpleClientset(
+			tlsSecret("shop", "web-tls", now.Add(100*24*time.Hour+time.Hour), map[string]string{certeval.CertManagerAnnotation: "web"}),
+			tlsSecret("billing", "api-tls", now.Add(-24*time.Hour), nil),
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "broken-tls"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{corev1.TLSCertKey: []byte("garbage")},
+			},
+		)
+		var stderr bytes.Buffer
+		statuses, failed, err := checkSecrets(context.Background(), clientset, namespace, &stderr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stderr.String()).To(ContainSubstring("shop/broken-tls"))
+
+		var out bytes.Buffer
+		Expect(printResults(&out, "", statuses, namespace == metav1.NamespaceAll, now)).To(Succeed())
+		return strings.Split(strings.TrimSpace(out.String()), "\n"), failed
+	}
+
+	It("prints the secrets of a namespace", func() {
+		lines, failed := check("shop")
+		Expect(failed).To(BeTrue())
+		Expect(lines).To(HaveLen(2))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"NAME", "STATUS", "EXPIRES", "DAYS", "ISSUER", "CERT-MANAGER"}))
+		row := strings.Fields(lines[1])
+		Expect(row[0]).To(Equal("web-tls"))
+		Expect(row[1]).To(Equal("valid"))
+		Expect(row[3]).To(Equal("100"))
+		Expect(row[len(row)-1]).To(Equal("true"))
+	})
+
+	It("adds the namespace column for all namespaces", func() {
+		lines, _ := check(metav1.NamespaceAll)
+		Expect(lines).To(HaveLen(3))
+		Expect(strings.Fields(lines[0])[0]).To(Equal("NAMESPACE"))
+		Expect(strings.Fields(lines[1])[:3]).To(Equal([]string{"billing", "api-tls", "expired"}))
+		Expect(strings.Fields(lines[1])[4]).To(Equal("-1"))
+		Expect(strings.Fields(lines[2])[:3]).To(Equal([]string{"shop", "web-tls", "valid"}))
+	})
+
+	It("renders a JSON report", func() {
+		statuses := []monitoringv1alpha1.MonitoredCertificateStatus{
+			{Name: "internal-shop-web-tls", Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: "expiring", Expiry: now.Add(10 * 24 * time.Hour).Format(time.RFC3339)},
+		}
+		var out bytes.Buffer
+		Expect(printResults(&out, report.JSON, statuses, false, now)).To(Succeed())
+		var doc report.Document
+		Expect(json.Unmarshal(out.Bytes(), &doc)).To(Succeed())
+		Expect(doc.Summary).To(Equal(map[string]int{"expiring": 1}))
+		Expect(doc.Certificates).To(Equal(statuses))
+	})
+
+	It("says when no secret was found", func() {
+		var out bytes.Buffer
+		Expect(printResults(&out, "", nil, false, now)).To(Succeed())
+		Expect(out.String()).To(Equal("No TLS secrets found.\n"))
+	})
+})
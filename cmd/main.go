@@ -17,9 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -38,6 +40,7 @@ import (
 	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
 	"egarciam.com/checkcert/internal/config"
 	"egarciam.com/checkcert/internal/controller"
+	"egarciam.com/checkcert/internal/inventory"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -61,8 +64,27 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var secretsMetadataOnly bool
+	var dashboardAddr string
+	var enableInventoryAPI bool
+	var apiTokenFile string
+	var dashboardCertFile string
+	var dashboardKeyFile string
+	var dashboardSkipAuth bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&dashboardAddr, "dashboard-bind-address", "0",
+		"The address the certificate inventory dashboard binds to. Use \"0\" to disable it. "+
+			"Addresses other than loopback ones need --dashboard-cert-file and --dashboard-key-file.")
+	flag.StringVar(&dashboardCertFile, "dashboard-cert-file", "", "The certificate the inventory dashboard serves TLS with.")
+	flag.StringVar(&dashboardKeyFile, "dashboard-key-file", "", "The key of --dashboard-cert-file.")
+	flag.BoolVar(&dashboardSkipAuth, "dashboard-skip-auth", false,
+		"If set, the inventory dashboard shows every certificate without authenticating callers. "+
+			"Only accepted with a loopback --dashboard-bind-address.")
+	flag.BoolVar(&enableInventoryAPI, "enable-inventory-api", false,
+		"If set, the inventory dashboard also serves the certificate API under /api/v1.")
+	flag.StringVar(&apiTokenFile, "inventory-api-token-file", "",
+		"File of static inventory tokens, one \"token,user[,group...]\" per line, accepted besides Kubernetes tokens.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -70,11 +92,28 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&secretsMetadataOnly, "secrets-metadata-only", false,
+		"If set, only Secret metadata is cached and secret data is fetched on demand when a secret changes. "+
+			"Reduces memory usage on clusters with many secrets.")
 
 	config.CertDirs = flag.String("cert-dirs", "/etc/kubernetes/pki:/etc/ssl/certs", "OS list separator separated list of directories to scan for certificates")
 	config.DefaultWarningDays = flag.Int("warning-expiration-days", 30, "Number of days to consider a certificate as expiring soon")
+	config.DefaultCriticalDays = flag.Int("critical-expiration-days", 7, "Number of days to consider an expiring certificate as critical")
 	config.DefaultCheckIntervalMinutes = flag.Int("check-interval-minutes", 10080, "Checking interval in minutes. Defaul 7 days (10.080 min)")
 	config.Debug = flag.Bool("debug", true, "Enable debug logging")
+	config.ScanWorkers = flag.Int("scan-workers", 8, "Maximum number of certificates evaluated or probed in parallel")
+	config.TargetTimeout = flag.Duration("target-timeout", 10*time.Second, "Timeout for evaluating or probing a single certificate")
+	config.ScanTimeout = flag.Duration("scan-timeout", 5*time.Minute, "Deadline for a complete scan of a CertificateMonitor")
+	config.WorkloadUsage = flag.Bool("map-workload-usage", true,
+		"Record in the status the Pods, Deployments, StatefulSets, Ingresses, Gateways and ServiceAccounts using each TLS secret")
+	config.OwnerKeys = flag.String("owner-keys", "owner,team",
+		"Comma separated label or annotation keys naming the owner of a certificate, looked up on its secret, the secret owners and its namespace")
+	config.HistoryLimit = flag.Int("certificate-history-limit", 10,
+		"Certificates kept in the CertificateHistory of each monitored certificate to track renewals. 0 disables the histories")
+	config.ClusterName = flag.String("cluster-name", "", "Name of the cluster shown in notifications")
+	config.NotificationRateLimits = flag.String("notification-rate-limits", "email=60,webhook=60,slack=60,teams=60,alertmanager=120,pagerduty=60",
+		"Maximum notifications sent per minute on each channel, as channel=count pairs")
+	config.NotificationMaxAttempts = flag.Int("notification-max-attempts", 10, "Delivery attempts of a queued notification before it is dropped")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -132,14 +171,56 @@ func main() {
 	}
 
 	if err = (&controller.CertificateMonitorReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		MetadataOnlySecrets: secretsMetadataOnly,
+		APIReader:           mgr.GetAPIReader(),
+		Recorder:            mgr.GetEventRecorderFor("certificatemonitor-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CertificateMonitor")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	certificates := func(ctx context.Context) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
+		return controller.ListMonitoredCertificates(ctx, mgr.GetClient())
+	}
+	if dashboardAddr != "0" {
+		// Every route of the dashboard authenticates bearer tokens with
+		// TokenReviews and authorizes namespaces with SubjectAccessReviews.
+		server := &inventory.Server{
+			Addr:      dashboardAddr,
+			Source:    certificates,
+			SkipAuth:  dashboardSkipAuth,
+			EnableAPI: enableInventoryAPI,
+			CertFile:  dashboardCertFile,
+			KeyFile:   dashboardKeyFile,
+			TLSOpts:   tlsOpts,
+		}
+		if !dashboardSkipAuth {
+			var authenticators inventory.Authenticators
+			if apiTokenFile != "" {
+				tokens, err := inventory.LoadTokenFile(apiTokenFile)
+				if err != nil {
+					setupLog.Error(err, "unable to load the inventory API token file")
+					os.Exit(1)
+				}
+				authenticators = append(authenticators, tokens)
+			}
+			authenticators = append(authenticators, &inventory.TokenReviewer{Client: mgr.GetClient()})
+			server.Authenticator = authenticators
+			server.Authorizer = &inventory.SubjectAccessReviewer{Client: mgr.GetClient()}
+		}
+		if err := server.Validate(); err != nil {
+			setupLog.Error(err, "invalid inventory dashboard settings")
+			os.Exit(1)
+		}
+		if err := mgr.Add(server); err != nil {
+			setupLog.Error(err, "unable to set up the inventory dashboard")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,185 @@
+// Package certeval evaluates certificates into the status entries of a
+// CertificateMonitor. It has no controller dependencies so the command line
+// tools can share the evaluation with the controller.
+package certeval
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/config"
+)
+
+// Certificate statuses, from the least to the most urgent.
+const (
+	Valid    string = "valid"
+	Expiring string = "expiring"
+	Critical string = "critical"
+	Expired  string = "expired"
+)
+
+// Defaults used when --warning-expiration-days and --critical-expiration-days
+// are not set.
+const (
+	defaultWarningDays  = 30
+	defaultCriticalDays = 7
+)
+
+// CertManagerAnnotation is set by cert-manager on the secrets it issues.
+const CertManagerAnnotation = "cert-manager.io/certificate-name"
+
+// ParsePEM decodes the first certificate of a PEM bundle.
+func ParsePEM(certData []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certData)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Status determines if a certificate is valid, expiring, critical, or expired.
+func Status(expiry time.Time) string {
+	now := time.Now()
+	if now.After(expiry) {
+		return Expired
+	}
+	if now.Add(time.Duration(CriticalDays()) * 24 * time.Hour).After(expiry) {
+		return Critical
+	}
+	if now.Add(time.Duration(WarningDays()) * 24 * time.Hour).After(expiry) {
+		return Expiring
+	}
+	return Valid
+}
+
+// WarningDays is how many days before expiry a certificate is expiring.
+func WarningDays() int {
+	if config.DefaultWarningDays == nil {
+		return defaultWarningDays
+	}
+	return *config.DefaultWarningDays
+}
+
+// CriticalDays is how many days before expiry a certificate is critical.
+func CriticalDays() int {
+	if config.DefaultCriticalDays == nil {
+		return defaultCriticalDays
+	}
+	return *config.DefaultCriticalDays
+}
+
+// NextChange returns when the status of a certificate expiring at expiry next
+// changes after now: when it starts expiring, turns critical or expires. It is
+// zero once the certificate expired.
+func NextChange(expiry, now time.Time) time.Time {
+	for _, t := range []time.Time{
+		expiry.Add(-time.Duration(WarningDays()) * 24 * time.Hour),
+		expiry.Add(-time.Duration(CriticalDays()) * 24 * time.Hour),
+		expiry,
+	} {
+		if t.After(now) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Fingerprint is the hex SHA-256 of the DER certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// SetDetails copies the identifying fields of a certificate into its status
+// entry.
+func SetDetails(certStatus *monitoringv1alpha1.MonitoredCertificateStatus, cert *x509.Certificate) {
+	certStatus.Fingerprint = Fingerprint(cert)
+	certStatus.Subject = cert.Subject.String()
+	certStatus.Issuer = cert.Issuer.String()
+	certStatus.DNSNames = cert.DNSNames
+	certStatus.NotBefore = cert.NotBefore.Format(time.RFC3339)
+	certStatus.SerialNumber = cert.SerialNumber.Text(16)
+}
+
+// EvaluateSecret builds the status entry of a kubernetes.io/tls secret the
+// way the controller does, for tools inspecting secrets outside of a scan.
+func EvaluateSecret(secret *corev1.Secret) (monitoringv1alpha1.MonitoredCertificateStatus, error) {
+	cert, err := ParsePEM(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return monitoringv1alpha1.MonitoredCertificateStatus{}, fmt.Errorf("secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	key := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+	return SecretStatus(key, cert, ManagedBy(secret.Annotations)), nil
+}
+
+// SecretStatus is the status entry of the certificate of a TLS secret.
+func SecretStatus(key types.NamespacedName, cert *x509.Certificate, managedBy string) monitoringv1alpha1.MonitoredCertificateStatus {
+	certStatus := monitoringv1alpha1.MonitoredCertificateStatus{
+		Name:      InternalName(key.Namespace, key.Name),
+		Type:      "internal",
+		Path:      key.Namespace + "/" + key.Name,
+		Status:    Status(cert.NotAfter),
+		Expiry:    cert.NotAfter.Format(time.RFC3339),
+		Namespace: key.Namespace,
+		ManagedBy: managedBy,
+	}
+	SetDetails(&certStatus, cert)
+	return certStatus
+}
+
+// ManagedBy tells from the annotations of a secret which controller renews
+// it. cert-manager marks the secrets of its Certificates with the certificate
+// name.
+func ManagedBy(annotations map[string]string) string {
+	if _, ok := annotations[CertManagerAnnotation]; ok {
+		return "cert-manager"
+	}
+	return ""
+}
+
+// InternalName is the status entry name used for a TLS secret.
+func InternalName(namespace, name string) string {
+	return fmt.Sprintf("internal-%s-%s", namespace, name)
+}
+
+// IsCertificateFile reports whether a file name has one of the extensions
+// checked on the nodes.
+func IsCertificateFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".crt" || ext == ".pem"
+}
+
+// EvaluateCertificateFile builds the status entry of the certificate in a PEM
+// file of a host, the way the node checks do. node names the host.
+func EvaluateCertificateFile(path, node string) (monitoringv1alpha1.MonitoredCertificateStatus, error) {
+	certData, err := os.ReadFile(path)
+	if err != nil {
+		return monitoringv1alpha1.MonitoredCertificateStatus{}, err
+	}
+	cert, err := ParsePEM(certData)
+	if err != nil {
+		return monitoringv1alpha1.MonitoredCertificateStatus{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	certStatus := monitoringv1alpha1.MonitoredCertificateStatus{
+		Name:   fmt.Sprintf("external-%s-%s", node, path),
+		Type:   "external",
+		Path:   path,
+		Node:   node,
+		Status: Status(cert.NotAfter),
+		Expiry: cert.NotAfter.Format(time.RFC3339),
+	}
+	SetDetails(&certStatus, cert)
+	return certStatus, nil
+}
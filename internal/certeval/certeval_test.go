@@ -0,0 +1,119 @@
+package certeval
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("EvaluateSecret", func() {
+	certPEM, _, err := selfSignedCert()
+	if err != nil {
+		panic(err)
+	}
+	secret := func(data []byte, annotations map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Annotations: annotations},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: data},
+		}
+	}
+
+	It("builds the same entry as a scan", func() {
+		s, err := EvaluateSecret(secret(certPEM, nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Name).To(Equal("internal-shop-web"))
+		Expect(s.Path).To(Equal("shop/web"))
+		Expect(s.Status).To(Equal(Valid))
+		Expect(s.Issuer).To(Equal("CN=bench.example.com"))
+		Expect(s.Fingerprint).NotTo(BeEmpty())
+		Expect(s.ManagedBy).To(BeEmpty())
+	})
+
+	It("recognizes secrets issued by cert-manager", func() {
+		s, err := EvaluateSecret(secret(certPEM, map[string]string{CertManagerAnnotation: "web"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.ManagedBy).To(Equal("cert-manager"))
+	})
+
+	It("reports secrets without a certificate", func() {
+		_, err := EvaluateSecret(secret([]byte("not a certificate"), nil))
+		Expect(err).To(MatchError(ContainSubstring("shop/web")))
+	})
+})
+
+var _ = Describe("NextChange", func() {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	It("returns the next threshold the certificate crosses", func() {
+		expiry := now.Add(40 * 24 * time.Hour)
+		Expect(NextChange(expiry, now)).To(Equal(expiry.Add(-30 * 24 * time.Hour)))
+		Expect(NextChange(expiry, expiry.Add(-10*24*time.Hour))).To(Equal(expiry.Add(-7 * 24 * time.Hour)))
+		Expect(NextChange(expiry, expiry.Add(-time.Hour))).To(Equal(expiry))
+		Expect(NextChange(expiry, expiry).IsZero()).To(BeTrue())
+	})
+})
+
+var _ = Describe("EvaluateCertificateFile", func() {
+	It("builds the entry of a certificate on a host", func() {
+		certPEM, keyPEM, err := selfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+		dir := GinkgoT().TempDir()
+		certPath := filepath.Join(dir, "apiserver.crt")
+		Expect(os.WriteFile(certPath, certPEM, 0o600)).To(Succeed())
+
+		s, err := EvaluateCertificateFile(certPath, "bastion")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Type).To(Equal("external"))
+		Expect(s.Path).To(Equal(certPath))
+		Expect(s.Node).To(Equal("bastion"))
+		Expect(s.Status).To(Equal(Valid))
+		Expect(s.Subject).To(Equal("CN=bench.example.com"))
+		// Node annotations keep the upper case statuses.
+		Expect(strings.ToUpper(s.Status)).To(Equal("VALID"))
+
+		keyPath := filepath.Join(dir, "apiserver-key.pem")
+		Expect(os.WriteFile(keyPath, keyPEM, 0o600)).To(Succeed())
+		Expect(IsCertificateFile(keyPath)).To(BeTrue())
+		_, err = EvaluateCertificateFile(keyPath, "bastion")
+		Expect(err).To(MatchError(ContainSubstring(keyPath)))
+	})
+})
+
+// selfSignedCert returns a PEM certificate valid for 90 days and its key.
+func selfSignedCert() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bench.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
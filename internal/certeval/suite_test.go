@@ -0,0 +1,14 @@
+package certeval
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCertEval(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "CertEval Suite")
+}
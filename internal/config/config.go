@@ -1,10 +1,22 @@
 package config
 
+import "time"
+
 var (
 	CertDirs                    *string
 	DefaultWarningDays          *int
+	DefaultCriticalDays         *int
 	DefaultCheckIntervalMinutes *int
 	Debug                       *bool
+	ScanWorkers                 *int
+	TargetTimeout               *time.Duration
+	ScanTimeout                 *time.Duration
+	ClusterName                 *string
+	NotificationRateLimits      *string
+	NotificationMaxAttempts     *int
+	WorkloadUsage               *bool
+	OwnerKeys                   *string
+	HistoryLimit                *int
 )
 
 const (
@@ -15,5 +27,6 @@ const (
 	NODE_NAME                      = "NODE_NAME"
 	VALID                          = "VALID"
 	EXPIRING                       = "EXPIRING"
+	CRITICAL                       = "CRITICAL"
 	EXPIRED                        = "EXPIRED"
 )
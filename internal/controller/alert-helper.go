@@ -0,0 +1,426 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/queue"
+	"egarciam.com/checkcert/internal/schedule"
+)
+
+// defaultReminderInterval is used when the monitor does not set one.
+const defaultReminderInterval = 24 * time.Hour
+
+// alertKind tells why a notification is sent.
+type alertKind string
+
+const (
+	// alertTransition: the certificate became expiring, critical or expired.
+	alertTransition alertKind = "transition"
+	// alertReminder: the certificate is still expiring, critical or expired.
+	alertReminder alertKind = "reminder"
+	// alertResolved: a certificate that was alerted on is valid again.
+	alertResolved alertKind = "resolved"
+	// alertEscalation: the certificate stayed critical or expired for longer
+	// than the escalation delay.
+	alertEscalation alertKind = "escalation"
+)
+
+// alert is a notification due for one status entry.
+type alert struct {
+	kind alertKind
+	// index of the entry in the current status list.
+	index int
+	cert  monitoringv1alpha1.MonitoredCertificateStatus
+	// previousStatus is what recipients were last told.
+	previousStatus string
+	// rotated is set when the fingerprint changed since the last scan.
+	rotated bool
+}
+
+// isAlerting reports whether a status has to be notified.
+func isAlerting(status string) bool {
+	return status == expiring || status == critical || status == expired
+}
+
+// reminderInterval returns the reminder period of a monitor; zero disables reminders.
+func reminderInterval(certMonitor *monitoringv1alpha1.CertificateMonitor) time.Duration {
+	if certMonitor.Spec.ReminderInterval == nil {
+		return defaultReminderInterval
+	}
+	return certMonitor.Spec.ReminderInterval.Duration
+}
+
+// planAlerts carries the notification state of each certificate over from the
+// previous status into current, and returns the notifications due now: on a
+// status transition, when the reminder interval elapsed, or once the
+// certificate is valid again after an alert. The time the certificate entered
+// its status, and its escalation, are kept while neither the status nor the
+// certificate change.
+func planAlerts(previous, current []monitoringv1alpha1.MonitoredCertificateStatus, reminder time.Duration, now time.Time) []alert {
+	byName := make(map[string]monitoringv1alpha1.MonitoredCertificateStatus, len(previous))
+	for _, p := range previous {
+		byName[p.Name] = p
+	}
+
+	var alerts []alert
+	for i := range current {
+		cur := &current[i]
+		prev, seen := byName[cur.Name]
+		if seen {
+			cur.LastNotifiedStatus = prev.LastNotifiedStatus
+			cur.LastNotified = prev.LastNotified
+		}
+		a := alert{
+			index:          i,
+			previousStatus: cur.LastNotifiedStatus,
+			rotated:        seen && prev.Fingerprint != "" && cur.Fingerprint != "" && prev.Fingerprint != cur.Fingerprint,
+		}
+		if seen && prev.Status == cur.Status && !a.rotated {
+			cur.StatusSince = prev.StatusSince
+			cur.Escalated = prev.Escalated
+		}
+		if cur.StatusSince == nil {
+			cur.StatusSince = &metav1.Time{Time: now}
+		}
+
+		switch {
+		case isAlerting(cur.Status) && cur.LastNotifiedStatus != cur.Status:
+			a.kind = alertTransition
+		case isAlerting(cur.Status) && reminder > 0 && cur.LastNotified != nil && now.Sub(cur.LastNotified.Time) >= reminder:
+			a.kind = alertReminder
+		case cur.Status == valid && isAlerting(cur.LastNotifiedStatus):
+			a.kind = alertResolved
+		default:
+			continue
+		}
+		a.cert = *cur
+		alerts = append(alerts, a)
+	}
+	return alerts
+}
+
+// planEscalations returns an escalation for every certificate critical or
+// expired for at least the given delay and not escalated yet.
+func planEscalations(current []monitoringv1alpha1.MonitoredCertificateStatus, after time.Duration, now time.Time) []alert {
+	var alerts []alert
+	for i, s := range current {
+		if s.Status != critical && s.Status != expired {
+			continue
+		}
+		if s.Escalated != nil || s.StatusSince == nil || now.Sub(s.StatusSince.Time) < after {
+			continue
+		}
+		alerts = append(alerts, alert{kind: alertEscalation, index: i, cert: s, previousStatus: s.LastNotifiedStatus})
+	}
+	return alerts
+}
+
+// escalationDestination is where the escalations of a monitor go.
+func escalationDestination(ctx context.Context, esc *monitoringv1alpha1.EscalationConfig) destination {
+	log := log.FromContext(ctx)
+	recipients, invalid := parseRecipients(strings.Join(esc.Recipients, ","))
+	for _, addr := range invalid {
+		log.Error(nil, "ignoring invalid escalation address", "address", addr)
+	}
+	dest := destination{channels: map[monitoringv1alpha1.NotificationChannel]bool{}, recipients: recipients}
+	if len(recipients) > 0 {
+		dest.channels[monitoringv1alpha1.ChannelEmail] = true
+	}
+	for _, c := range esc.Channels {
+		dest.channels[c] = true
+	}
+	return dest
+}
+
+// businessHours returns the window warnings are restricted to, nil when they
+// may go out at any time.
+func businessHours(certMonitor *monitoringv1alpha1.CertificateMonitor) (*schedule.Window, error) {
+	bh := certMonitor.Spec.BusinessHours
+	if bh == nil {
+		return nil, nil
+	}
+	days := make([]string, len(bh.Days))
+	for i, d := range bh.Days {
+		days[i] = string(d)
+	}
+	return schedule.ParseWindow(days, bh.Start, bh.End, bh.TimeZone)
+}
+
+// notifyAlerts plans the notifications of a scan, queues one message per
+// channel and recipient and delivers what is due. The state of an entry is
+// advanced once all its messages were delivered or persisted in the queue,
+// which retries failed ones, so nothing is lost when a channel is down.
+// Without channels nothing is sent but the state is still carried over.
+// Alerts reaching no channel are recorded as unroutable and not planned again.
+// Silenced certificates are left pending until their silence ends, and so are
+// warnings outside business hours. Digest monitors only mail on full scans,
+// or once a day for daily digests; the other channels get every alert. Full
+// scans also send the firing alerts to Alertmanager again.
+// It returns when the next queued or deferred message is due, zero when none
+// is.
+func (r *CertificateMonitorReconciler) notifyAlerts(ctx context.Context, ch *channels, certMonitor *monitoringv1alpha1.CertificateMonitor, current []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time, fullScan bool) time.Time {
+	log := log.FromContext(ctx)
+	if ch != nil {
+		if err := r.applySilences(ctx, ch, certMonitor, current, now); err != nil {
+			log.Error(err, "failed to evaluate silences")
+		}
+	}
+	alerts := planAlerts(certMonitor.Status.MonitoredCertificates, current, reminderInterval(certMonitor), now)
+	if fullScan {
+		certMonitor.Status.UnroutableCertificates = r.unroutable(ctx, ch, current, now)
+	}
+	if ch == nil {
+		return time.Time{}
+	}
+	q, cm, err := r.loadQueue(ctx, certMonitor)
+	if err != nil {
+		// Alerts stay pending and are planned again after the backoff.
+		log.Error(err, "failed to load notification queue")
+		return now.Add(queuePolicy().Backoff)
+	}
+	digest := ch.mail != nil && digestMode(certMonitor) != monitoringv1alpha1.DigestNone
+	window, err := businessHours(certMonitor)
+	if err != nil {
+		log.Error(err, "invalid business hours, sending warnings at any time")
+	}
+
+	var deferred time.Time
+	queued := map[int][]string{}
+	for _, a := range alerts {
+		if silenced(current[a.index], now) {
+			continue
+		}
+		severity := alertSeverity(a.cert)
+		if window != nil && severity == expiring && !window.Contains(now) {
+			deferred = window.Next(now)
+			continue
+		}
+		dest, err := r.route(ctx, ch, a.cert, severity)
+		if err != nil {
+			log.Error(err, "failed to route alert", "certificate", a.cert.Name)
+			continue
+		}
+		if !ch.deliverable(dest) {
+			// Nobody can be told; the entry is recorded as unroutable
+			// instead of being planned again on every reconcile.
+			log.Info("Alert reaches no recipient", "certificate", a.cert.Name, "kind", a.kind)
+			current[a.index].LastNotifiedStatus = current[a.index].Status
+			current[a.index].LastNotified = &metav1.Time{Time: now}
+			if isAlerting(a.cert.Status) && !slices.Contains(certMonitor.Status.UnroutableCertificates, a.cert.Name) {
+				certMonitor.Status.UnroutableCertificates = append(certMonitor.Status.UnroutableCertificates, a.cert.Name)
+			}
+			continue
+		}
+		// Entries only covered by the digest are marked when it is queued.
+		if ids := r.enqueueAlert(ctx, ch, q, certMonitor, a, dest, !digest, now); len(ids) > 0 {
+			queued[a.index] = ids
+		}
+	}
+
+	if fullScan {
+		r.refreshAlertmanager(ctx, ch, q, certMonitor, current, queued, now)
+	}
+
+	escalated := map[int][]string{}
+	if esc := certMonitor.Spec.Escalation; esc != nil {
+		dest := escalationDestination(ctx, esc)
+		for _, a := range planEscalations(current, esc.After.Duration, now) {
+			if silenced(current[a.index], now) {
+				continue
+			}
+			if ids := r.enqueueAlert(ctx, ch, q, certMonitor, a, dest, true, now); len(ids) > 0 {
+				escalated[a.index] = ids
+			}
+		}
+	}
+
+	var digestIDs []string
+	if digest && (fullScan || digestMode(certMonitor) == monitoringv1alpha1.DigestDaily) {
+		digestIDs = r.enqueueDigest(ctx, ch, q, certMonitor, current, alerts, now)
+	}
+
+	next := r.deliver(ctx, ch, q, now)
+	saved := true
+	if err := r.saveQueue(ctx, certMonitor, cm, q); err != nil {
+		log.Error(err, "failed to save notification queue")
+		saved = false
+	}
+	// Without a saved queue only what was delivered right away is handled.
+	handled := func(ids []string) bool {
+		if saved {
+			return true
+		}
+		for _, id := range ids {
+			if q.Has(id) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, ids := range queued {
+		if handled(ids) {
+			current[i].LastNotifiedStatus = current[i].Status
+			current[i].LastNotified = &metav1.Time{Time: now}
+		}
+	}
+	for i, ids := range escalated {
+		if handled(ids) {
+			current[i].Escalated = &metav1.Time{Time: now}
+		}
+	}
+	if len(digestIDs) > 0 && handled(digestIDs) {
+		markDigest(certMonitor, current, now)
+	}
+	return earliest(next, deferred)
+}
+
+// nextAlertDue returns when the next reminder, escalation, silence end,
+// daily digest or threshold crossing of a monitor is due, zero when none is.
+// A certificate crossing a threshold alerts without waiting for the next scan,
+// except those on the nodes, whose status the nodes report.
+// Overdue ones are left to the next scan, so an alert that cannot be sent does
+// not requeue the monitor in a loop.
+func nextAlertDue(certMonitor *monitoringv1alpha1.CertificateMonitor, now time.Time) time.Time {
+	var next time.Time
+	due := func(t time.Time) {
+		if t.After(now) {
+			next = earliest(next, t)
+		}
+	}
+	alerting := false
+	reminder := reminderInterval(certMonitor)
+	esc := certMonitor.Spec.Escalation
+	for _, s := range certMonitor.Status.MonitoredCertificates {
+		if expiry, ok := refreshable(s); ok {
+			due(certeval.NextChange(expiry, now))
+		}
+		if !isAlerting(s.Status) {
+			continue
+		}
+		alerting = true
+		if silenced(s, now) {
+			// Whatever is pending goes out once the silence ends.
+			due(s.SilencedUntil.Time)
+			continue
+		}
+		if reminder > 0 && s.LastNotified != nil && s.LastNotifiedStatus == s.Status {
+			due(s.LastNotified.Add(reminder))
+		}
+		if esc != nil && (s.Status == critical || s.Status == expired) && s.Escalated == nil && s.StatusSince != nil {
+			due(s.StatusSince.Add(esc.After.Duration))
+		}
+	}
+	if alerting && digestMode(certMonitor) == monitoringv1alpha1.DigestDaily && certMonitor.Status.LastDigestTime != nil {
+		due(certMonitor.Status.LastDigestTime.Add(24 * time.Hour))
+	}
+	return next
+}
+
+// earliest returns the earlier of two times, ignoring zero ones.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// enqueueAlert queues an alert on every channel of its destination, email
+// only when mail is set, and returns the message IDs.
+func (r *CertificateMonitorReconciler) enqueueAlert(ctx context.Context, ch *channels, q *queue.Queue, certMonitor *monitoringv1alpha1.CertificateMonitor, a alert, dest destination, mail bool, now time.Time) []string {
+	log := log.FromContext(ctx)
+	// Escalations are queued apart, so they do not replace a pending alert.
+	about := a.cert.Name
+	if a.kind == alertEscalation {
+		about = string(alertEscalation) + "/" + about
+	}
+
+	var ids []string
+	if mail && ch.mail != nil && dest.has(monitoringv1alpha1.ChannelEmail) && len(dest.recipients) > 0 {
+		msg, err := ch.mail.templates.RenderAlert(alertData(certMonitor, a, now))
+		if err != nil {
+			log.Error(err, "failed to render alert", "certificate", a.cert.Name)
+			return nil
+		}
+		if ids, err = enqueueMail(q, dest.recipients, about, msg, now); err != nil {
+			log.Error(err, "failed to queue alert", "certificate", a.cert.Name)
+			return nil
+		}
+	}
+	for _, n := range ch.notifiers {
+		if !dest.has(monitoringv1alpha1.NotificationChannel(n.Name())) {
+			continue
+		}
+		id, err := enqueueNotification(q, n.Name(), about, notifyPayload(certMonitor, a, now), maxAttempts(certMonitor, n.Name()), now)
+		if err != nil {
+			log.Error(err, "failed to queue alert", "channel", n.Name(), "certificate", a.cert.Name)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// refreshAlertmanager sends the firing certificates already notified to
+// Alertmanager again, so their alerts do not end while the certificates are
+// still critical or expired. Entries alerted in this round are skipped.
+func (r *CertificateMonitorReconciler) refreshAlertmanager(ctx context.Context, ch *channels, q *queue.Queue, certMonitor *monitoringv1alpha1.CertificateMonitor, current []monitoringv1alpha1.MonitoredCertificateStatus, queued map[int][]string, now time.Time) {
+	log := log.FromContext(ctx)
+	am := destination{channels: map[monitoringv1alpha1.NotificationChannel]bool{monitoringv1alpha1.ChannelAlertmanager: true}}
+	if !ch.deliverable(am) {
+		return
+	}
+	for i, s := range current {
+		if s.Status != critical && s.Status != expired {
+			continue
+		}
+		if _, ok := queued[i]; ok || s.LastNotifiedStatus != s.Status || silenced(s, now) {
+			continue
+		}
+		dest, err := r.route(ctx, ch, s, s.Status)
+		if err != nil {
+			log.Error(err, "failed to route alert", "certificate", s.Name)
+			continue
+		}
+		if !dest.has(monitoringv1alpha1.ChannelAlertmanager) {
+			continue
+		}
+		a := alert{kind: alertReminder, index: i, cert: s, previousStatus: s.LastNotifiedStatus}
+		r.enqueueAlert(ctx, ch, q, certMonitor, a, am, false, now)
+	}
+}
+
+// unroutable returns the names of the alerting certificates whose alerts
+// reach no channel: no route matches them, or only email does and nobody is
+// left to mail. Silenced certificates are left out. Monitors without channels deliberately notify nobody.
+func (r *CertificateMonitorReconciler) unroutable(ctx context.Context, ch *channels, current []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) []string {
+	if ch == nil {
+		return nil
+	}
+	log := log.FromContext(ctx)
+	var names []string
+	for _, s := range current {
+		if !isAlerting(s.Status) || silenced(s, now) {
+			continue
+		}
+		dest, err := r.route(ctx, ch, s, s.Status)
+		if err != nil {
+			log.Error(err, "failed to route certificate", "certificate", s.Name)
+			continue
+		}
+		if !ch.deliverable(dest) {
+			names = append(names, s.Name)
+		}
+	}
+	if len(names) > 0 {
+		log.Info("Alerting certificates reach no recipient", "certificates", names)
+	}
+	return names
+}
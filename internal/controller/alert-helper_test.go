@@ -0,0 +1,432 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/notify"
+	"egarciam.com/checkcert/internal/queue"
+)
+
+// testScheme knows the core types and the monitoring API.
+func testScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(s))
+	utilruntime.Must(monitoringv1alpha1.AddToScheme(s))
+	return s
+}
+
+// fakeNotifier records the alerts it gets and fails when err is set. It is
+// the channel given by name, "fake" by default.
+type fakeNotifier struct {
+	name string
+	sent []notify.Alert
+	err  error
+}
+
+func (f *fakeNotifier) Name() string {
+	if f.name != "" {
+		return f.name
+	}
+	return "fake"
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, a notify.Alert) error {
+	f.sent = append(f.sent, a)
+	return f.err
+}
+
+var _ = Describe("Alert planning", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	notified := &metav1.Time{Time: now.Add(-2 * time.Hour)}
+
+	entry := func(status, fingerprint string) monitoringv1alpha1.MonitoredCertificateStatus {
+		return monitoringv1alpha1.MonitoredCertificateStatus{Name: "internal-default-web", Status: status, Fingerprint: fingerprint}
+	}
+	notifiedEntry := func(status, fingerprint string) monitoringv1alpha1.MonitoredCertificateStatus {
+		e := entry(status, fingerprint)
+		e.LastNotifiedStatus = status
+		e.LastNotified = notified
+		return e
+	}
+
+	It("alerts when a certificate starts expiring", func() {
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+		alerts := planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{entry(valid, "a")}, current, time.Hour*24, now)
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].kind).To(Equal(alertTransition))
+	})
+
+	It("alerts again when an expiring certificate turns critical", func() {
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(critical, "a")}
+		alerts := planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{notifiedEntry(expiring, "a")}, current, 24*time.Hour, now)
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].kind).To(Equal(alertTransition))
+		Expect(alerts[0].previousStatus).To(Equal(expiring))
+	})
+
+	It("stays quiet while nothing changes", func() {
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expired, "a")}
+		alerts := planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{notifiedEntry(expired, "a")}, current, 24*time.Hour, now)
+		Expect(alerts).To(BeEmpty())
+		Expect(current[0].LastNotifiedStatus).To(Equal(expired))
+		Expect(current[0].LastNotified).To(Equal(notified))
+	})
+
+	It("reminds once the interval elapsed", func() {
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expired, "a")}
+		alerts := planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{notifiedEntry(expired, "a")}, current, time.Hour, now)
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].kind).To(Equal(alertReminder))
+	})
+
+	It("resolves a rotated certificate", func() {
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(valid, "b")}
+		alerts := planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{notifiedEntry(expired, "a")}, current, 24*time.Hour, now)
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].kind).To(Equal(alertResolved))
+		Expect(alerts[0].rotated).To(BeTrue())
+		Expect(alerts[0].previousStatus).To(Equal(expired))
+	})
+
+	It("keeps the status start and escalation while nothing changes", func() {
+		since := &metav1.Time{Time: now.Add(-48 * time.Hour)}
+		prev := notifiedEntry(critical, "a")
+		prev.StatusSince = since
+		prev.Escalated = notified
+
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(critical, "a")}
+		planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{prev}, current, 24*time.Hour, now)
+		Expect(current[0].StatusSince).To(Equal(since))
+		Expect(current[0].Escalated).To(Equal(notified))
+
+		current = []monitoringv1alpha1.MonitoredCertificateStatus{entry(expired, "a")}
+		planAlerts([]monitoringv1alpha1.MonitoredCertificateStatus{prev}, current, 24*time.Hour, now)
+		Expect(current[0].StatusSince.Time).To(Equal(now))
+		Expect(current[0].Escalated).To(BeNil())
+	})
+
+	It("escalates certificates left critical, once", func() {
+		stale := entry(critical, "a")
+		stale.StatusSince = &metav1.Time{Time: now.Add(-13 * time.Hour)}
+		fresh := entry(expired, "b")
+		fresh.Name = "internal-default-api"
+		fresh.StatusSince = &metav1.Time{Time: now.Add(-time.Hour)}
+		escalated := entry(critical, "c")
+		escalated.Name = "internal-default-db"
+		escalated.StatusSince = stale.StatusSince
+		escalated.Escalated = notified
+
+		alerts := planEscalations([]monitoringv1alpha1.MonitoredCertificateStatus{stale, fresh, escalated}, 12*time.Hour, now)
+		Expect(alerts).To(HaveLen(1))
+		Expect(alerts[0].kind).To(Equal(alertEscalation))
+		Expect(alerts[0].cert.Name).To(Equal("internal-default-web"))
+	})
+
+	It("schedules the next reminder and daily digest", func() {
+		m := &monitoringv1alpha1.CertificateMonitor{}
+		m.Spec.ReminderInterval = &metav1.Duration{Duration: 6 * time.Hour}
+		overdue := notifiedEntry(expiring, "b")
+		overdue.Name = "internal-default-api"
+		overdue.LastNotified = &metav1.Time{Time: now.Add(-7 * time.Hour)}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{notifiedEntry(expired, "a"), overdue}
+		Expect(nextAlertDue(m, now)).To(Equal(notified.Add(6 * time.Hour)))
+
+		m.Spec.Digest = monitoringv1alpha1.DigestDaily
+		m.Status.LastDigestTime = &metav1.Time{Time: now.Add(-23 * time.Hour)}
+		Expect(nextAlertDue(m, now)).To(Equal(now.Add(time.Hour)))
+
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{entry(valid, "a")}
+		Expect(nextAlertDue(m, now).IsZero()).To(BeTrue())
+	})
+
+	It("schedules escalations and the end of silences", func() {
+		m := &monitoringv1alpha1.CertificateMonitor{}
+		m.Spec.Escalation = &monitoringv1alpha1.EscalationConfig{After: metav1.Duration{Duration: 12 * time.Hour}}
+		stale := notifiedEntry(critical, "a")
+		stale.StatusSince = &metav1.Time{Time: now.Add(-10 * time.Hour)}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{stale}
+		Expect(nextAlertDue(m, now)).To(Equal(now.Add(2 * time.Hour)))
+
+		stale.Escalated = notified
+		silencedEntry := entry(expired, "b")
+		silencedEntry.Name = "internal-default-api"
+		silencedEntry.SilencedUntil = &metav1.Time{Time: now.Add(time.Hour)}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{stale, silencedEntry}
+		Expect(nextAlertDue(m, now)).To(Equal(now.Add(time.Hour)))
+	})
+
+	It("schedules the next threshold crossing", func() {
+		m := &monitoringv1alpha1.CertificateMonitor{}
+		soon := entry(valid, "a")
+		soon.Expiry = now.Add(30*24*time.Hour + 3*time.Hour).Format(time.RFC3339)
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{soon}
+		Expect(nextAlertDue(m, now)).To(Equal(now.Add(3 * time.Hour)))
+
+		m.Spec.ReminderInterval = &metav1.Duration{Duration: 4 * time.Hour}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{notifiedEntry(expiring, "b"), soon}
+		m.Status.MonitoredCertificates[0].Name = "internal-default-api"
+		Expect(nextAlertDue(m, now)).To(Equal(notified.Add(4 * time.Hour)))
+
+		// The nodes report the status of their certificates.
+		soon.Type = "external"
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{soon}
+		Expect(nextAlertDue(m, now).IsZero()).To(BeTrue())
+	})
+
+	Describe("delivery", func() {
+		ctx := context.Background()
+		monitor := func() *monitoringv1alpha1.CertificateMonitor {
+			m := &monitoringv1alpha1.CertificateMonitor{}
+			m.Name = "prod"
+			m.Namespace = "default"
+			m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{entry(valid, "a")}
+			return m
+		}
+		reconciler := func() *CertificateMonitorReconciler {
+			return &CertificateMonitorReconciler{Client: fake.NewClientBuilder().WithScheme(testScheme()).Build()}
+		}
+		queued := func(r *CertificateMonitorReconciler, m *monitoringv1alpha1.CertificateMonitor) int {
+			q, _, err := r.loadQueue(ctx, m)
+			Expect(err).NotTo(HaveOccurred())
+			return q.Len()
+		}
+
+		It("delivers right away and advances the state", func() {
+			n := &fakeNotifier{name: "webhook"}
+			m := monitor()
+			r := reconciler()
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			retry := r.notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, true)
+			Expect(n.sent).To(HaveLen(1))
+			Expect(n.sent[0].Monitor).To(Equal("prod"))
+			Expect(n.sent[0].Certificate.Status).To(Equal(expiring))
+			Expect(current[0].LastNotifiedStatus).To(Equal(expiring))
+			Expect(retry.IsZero()).To(BeTrue())
+			Expect(queued(r, m)).To(BeZero())
+		})
+
+		It("queues a failed delivery and retries it later", func() {
+			n := &fakeNotifier{name: "webhook", err: errors.New("unreachable")}
+			ch := &channels{notifiers: []notify.Notifier{n}}
+			m := monitor()
+			r := reconciler()
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			retry := r.notifyAlerts(ctx, ch, m, current, now, true)
+			Expect(n.sent).To(HaveLen(1))
+			// The queue owns the retry, so the alert is not planned again.
+			Expect(current[0].LastNotifiedStatus).To(Equal(expiring))
+			Expect(retry).To(BeTemporally(">", now))
+			Expect(queued(r, m)).To(Equal(1))
+
+			n.err = nil
+			m.Status.MonitoredCertificates = current
+			Expect(r.notifyAlerts(ctx, ch, m, current, retry, false).IsZero()).To(BeTrue())
+			Expect(n.sent).To(HaveLen(2))
+			Expect(queued(r, m)).To(BeZero())
+		})
+
+		It("records alerts reaching no channel instead of planning them again", func() {
+			n := &fakeNotifier{}
+			m := monitor()
+			r := reconciler()
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			r.notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, false)
+			Expect(n.sent).To(BeEmpty())
+			Expect(m.Status.UnroutableCertificates).To(Equal([]string{"internal-default-web"}))
+			Expect(current[0].LastNotifiedStatus).To(Equal(expiring))
+
+			m.Status.MonitoredCertificates = current
+			Expect(planAlerts(m.Status.MonitoredCertificates, []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}, 24*time.Hour, now)).To(BeEmpty())
+		})
+
+		It("drops rejected alerts instead of retrying them", func() {
+			n := &fakeNotifier{name: "webhook", err: fmt.Errorf("POST hooks.example.com: 400 Bad Request: %w", notify.ErrRejected)}
+			m := monitor()
+			r := reconciler()
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			Expect(r.notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, true).IsZero()).To(BeTrue())
+			Expect(n.sent).To(HaveLen(1))
+			Expect(queued(r, m)).To(BeZero())
+		})
+
+		It("bounds webhook retries by the monitor setting", func() {
+			m := monitor()
+			retries := int32(2)
+			m.Spec.Webhook = &monitoringv1alpha1.WebhookConfig{URL: "https://hooks.example.com", MaxRetries: &retries}
+			Expect(maxAttempts(m, "webhook")).To(Equal(3))
+			Expect(maxAttempts(m, "slack")).To(BeZero())
+		})
+
+		It("backs off when the queued messages have no channel", func() {
+			m := monitor()
+			r := reconciler()
+			q := &queue.Queue{}
+			_, err := enqueueNotification(q, "webhook", "internal-default-web", notify.Alert{}, 0, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.saveQueue(ctx, m, nil, q)).To(Succeed())
+
+			Expect(r.flushQueue(ctx, m, now)).To(Equal(now.Add(queuePolicy().Backoff)))
+			Expect(queued(r, m)).To(Equal(1))
+		})
+
+		It("drops the oldest messages of a full queue", func() {
+			m := monitor()
+			r := reconciler()
+			q := &queue.Queue{}
+			for i := 0; i <= maxQueuedMessages; i++ {
+				_, err := enqueueNotification(q, "webhook", fmt.Sprintf("cert-%d", i), notify.Alert{}, 0, now.Add(time.Duration(i)*time.Second))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(r.saveQueue(ctx, m, nil, q)).To(Succeed())
+
+			stored, _, err := r.loadQueue(ctx, m)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Len()).To(Equal(maxQueuedMessages))
+			Expect(stored.Has("webhook/cert-0")).To(BeFalse())
+		})
+
+		It("keeps the state when the queue cannot be saved", func() {
+			n := &fakeNotifier{name: "webhook", err: errors.New("unreachable")}
+			r := &CertificateMonitorReconciler{Client: fake.NewClientBuilder().WithScheme(testScheme()).
+				WithInterceptorFuncs(interceptor.Funcs{Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+					return errors.New("forbidden")
+				}}).Build()}
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			r.notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, monitor(), current, now, true)
+			Expect(current[0].LastNotifiedStatus).To(BeEmpty())
+		})
+
+		It("holds warnings back until business hours", func() {
+			n := &fakeNotifier{name: "webhook"}
+			m := monitor()
+			m.Spec.BusinessHours = &monitoringv1alpha1.BusinessHours{}
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			// now is a Saturday.
+			retry := reconciler().notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, true)
+			Expect(n.sent).To(BeEmpty())
+			Expect(current[0].LastNotifiedStatus).To(BeEmpty())
+			Expect(retry).To(Equal(time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)))
+
+			current = []monitoringv1alpha1.MonitoredCertificateStatus{entry(critical, "a")}
+			reconciler().notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, true)
+			Expect(n.sent).To(HaveLen(1))
+		})
+
+		It("sends deferred warnings on the reconcile at window start", func() {
+			n := &fakeNotifier{name: "webhook"}
+			ch := &channels{notifiers: []notify.Notifier{n}}
+			m := monitor()
+			m.Spec.BusinessHours = &monitoringv1alpha1.BusinessHours{}
+			r := reconciler()
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expiring, "a")}
+			retry := r.notifyAlerts(ctx, ch, m, current, now, true)
+			Expect(n.sent).To(BeEmpty())
+			m.Status.MonitoredCertificates = current
+
+			// The requeue lands at window start, on a reconcile without scan.
+			current = append([]monitoringv1alpha1.MonitoredCertificateStatus(nil), m.Status.MonitoredCertificates...)
+			Expect(r.notifyAlerts(ctx, ch, m, current, retry, false).IsZero()).To(BeTrue())
+			Expect(n.sent).To(HaveLen(1))
+			Expect(current[0].LastNotifiedStatus).To(Equal(expiring))
+		})
+
+		It("refreshes firing Alertmanager alerts on full scans", func() {
+			var posts int
+			srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { posts++ }))
+			defer srv.Close()
+			am, err := notify.NewAlertmanager(notify.AlertmanagerConfig{URL: srv.URL, TTL: time.Hour})
+			Expect(err).NotTo(HaveOccurred())
+			ch := &channels{notifiers: []notify.Notifier{am}}
+
+			m := monitor()
+			web, api := notifiedEntry(critical, "a"), notifiedEntry(expiring, "b")
+			api.Name = "internal-default-api"
+			m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{web, api}
+			current := func() []monitoringv1alpha1.MonitoredCertificateStatus {
+				return []monitoringv1alpha1.MonitoredCertificateStatus{entry(critical, "a"), api}
+			}
+
+			reconciler().notifyAlerts(ctx, ch, m, current(), now, false)
+			Expect(posts).To(BeZero())
+			reconciler().notifyAlerts(ctx, ch, m, current(), now, true)
+			Expect(posts).To(Equal(1))
+		})
+
+		It("lets Alertmanager alerts outlive a missed scan", func() {
+			m := monitor()
+			m.Spec.Schedule = "6h"
+			Expect(alertTTL(m, now)).To(Equal(18 * time.Hour))
+		})
+
+		It("sends escalations to their own channels", func() {
+			n := &fakeNotifier{name: "webhook"}
+			m := monitor()
+			m.Spec.Escalation = &monitoringv1alpha1.EscalationConfig{
+				After:    metav1.Duration{Duration: 12 * time.Hour},
+				Channels: []monitoringv1alpha1.NotificationChannel{monitoringv1alpha1.ChannelWebhook},
+			}
+			prev := notifiedEntry(critical, "a")
+			prev.StatusSince = &metav1.Time{Time: now.Add(-24 * time.Hour)}
+			m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{prev}
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(critical, "a")}
+
+			reconciler().notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, true)
+			Expect(n.sent).To(HaveLen(1))
+			Expect(n.sent[0].Kind).To(Equal(string(alertEscalation)))
+			Expect(current[0].Escalated.Time).To(Equal(now))
+		})
+
+		It("does not notify silenced certificates", func() {
+			n := &fakeNotifier{name: "webhook"}
+			m := monitor()
+			silence := &monitoringv1alpha1.CertificateSilence{
+				ObjectMeta: metav1.ObjectMeta{Name: "replacing", Namespace: "default"},
+				Spec: monitoringv1alpha1.CertificateSilenceSpec{
+					Certificates: []string{"internal-default-web"},
+					Until:        metav1.Time{Time: now.Add(72 * time.Hour)},
+				},
+			}
+			r := &CertificateMonitorReconciler{Client: fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(silence).Build()}
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{entry(expired, "a")}
+
+			r.notifyAlerts(ctx, &channels{notifiers: []notify.Notifier{n}}, m, current, now, true)
+			Expect(n.sent).To(BeEmpty())
+			Expect(current[0].SilencedUntil.Time).To(BeTemporally("==", silence.Spec.Until.Time))
+			// Pending, so the alert goes out once the silence ends.
+			Expect(current[0].LastNotifiedStatus).To(BeEmpty())
+		})
+	})
+})
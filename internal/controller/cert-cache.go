@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"crypto/x509"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"egarciam.com/checkcert/internal/certeval"
+)
+
+// cachedCert is the parse result of a secret at a given resourceVersion.
+// Parse errors are cached too, so a broken secret is not reparsed every scan.
+type cachedCert struct {
+	resourceVersion string
+	// notTLS marks secrets that turned out not to be kubernetes.io/tls when
+	// fetched lazily, so they are not fetched again until they change.
+	notTLS bool
+	cert   *x509.Certificate
+	err    error
+}
+
+// certCache keeps parsed certificates keyed by secret UID and resourceVersion.
+// Only the latest resourceVersion of each secret is kept, so the cache holds
+// at most one entry per secret.
+type certCache struct {
+	mu      sync.Mutex
+	entries map[types.UID]cachedCert
+}
+
+func newCertCache() *certCache {
+	return &certCache{entries: map[types.UID]cachedCert{}}
+}
+
+// get returns the parsed tls.crt of the secret, parsing it only when the
+// secret is new or its resourceVersion changed.
+func (c *certCache) get(secret *corev1.Secret) (*x509.Certificate, error) {
+	if entry, ok := c.lookup(secret.UID, secret.ResourceVersion); ok {
+		return entry.cert, entry.err
+	}
+
+	cert, err := certeval.ParsePEM(secret.Data[corev1.TLSCertKey])
+	c.store(secret.UID, cachedCert{resourceVersion: secret.ResourceVersion, cert: cert, err: err})
+	return cert, err
+}
+
+// lookup returns the entry of a secret if it was cached at resourceVersion.
+func (c *certCache) lookup(uid types.UID, resourceVersion string) (cachedCert, bool) {
+	if c == nil {
+		return cachedCert{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[uid]
+	if !ok || entry.resourceVersion != resourceVersion {
+		return cachedCert{}, false
+	}
+	return entry, true
+}
+
+// store replaces the entry of a secret.
+func (c *certCache) store(uid types.UID, entry cachedCert) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries[uid] = entry
+	c.mu.Unlock()
+}
+
+// retain drops every entry whose secret is not in seen. It is called after a
+// full scan so deleted secrets do not linger.
+func (c *certCache) retain(seen map[types.UID]struct{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for uid := range c.entries {
+		if _, ok := seen[uid]; !ok {
+			delete(c.entries, uid)
+		}
+	}
+}
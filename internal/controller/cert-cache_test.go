@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Certificate cache", func() {
+	var (
+		cache   *certCache
+		secret  *corev1.Secret
+		certPEM []byte
+	)
+	BeforeEach(func() {
+		var err error
+		certPEM, _, err = selfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+		cache = newCertCache()
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-tls", UID: "s1", ResourceVersion: "1"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM},
+		}
+	})
+
+	It("parses a secret once per resourceVersion", func() {
+		first, err := cache.get(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Same resourceVersion: the cached certificate is returned even though
+		// the data would no longer parse.
+		secret.Data[corev1.TLSCertKey] = []byte("garbage")
+		again, err := cache.get(secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(first))
+
+		secret.ResourceVersion = "2"
+		_, err = cache.get(secret)
+		Expect(err).To(HaveOccurred())
+		_, ok := cache.lookup(secret.UID, "1")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("caches parse errors until the secret changes", func() {
+		secret.Data[corev1.TLSCertKey] = []byte("garbage")
+		_, err := cache.get(secret)
+		Expect(err).To(HaveOccurred())
+
+		secret.Data[corev1.TLSCertKey] = certPEM
+		_, err = cache.get(secret)
+		Expect(err).To(HaveOccurred())
+
+		secret.ResourceVersion = "2"
+		cert, err := cache.get(secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert).NotTo(BeNil())
+	})
+
+	It("evicts the secrets a scan no longer sees", func() {
+		other := secret.DeepCopy()
+		other.UID = "s2"
+		_, _ = cache.get(secret)
+		_, _ = cache.get(other)
+
+		cache.retain(map[types.UID]struct{}{"s2": {}})
+		_, ok := cache.lookup("s1", "1")
+		Expect(ok).To(BeFalse())
+		_, ok = cache.lookup("s2", "1")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("works without a cache", func() {
+		var none *certCache
+		cert, err := none.get(secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert).NotTo(BeNil())
+		none.retain(nil)
+	})
+})
@@ -29,14 +29,22 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
 	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/queue"
 	// email "egarciam.com/checkcert/lib/email"
 )
 
@@ -45,47 +53,113 @@ type CertificateMonitorReconciler struct {
 	client.Client
 	ConfigMapName string // Name of the ConfigMap to fetch recipients
 	Scheme        *runtime.Scheme
+
+	// MetadataOnlySecrets makes the controller cache only Secret metadata and
+	// fetch secret data through APIReader when a secret changed.
+	MetadataOnlySecrets bool
+	// APIReader reads directly from the API server, bypassing the cache.
+	APIReader client.Reader
+	// Recorder records Events for certificate transitions. Optional.
+	Recorder record.EventRecorder
+
+	// changes holds secrets modified since the last reconcile of each monitor.
+	changes *changeTracker
+	// certs caches parsed certificates by secret UID and resourceVersion.
+	certs *certCache
+	// limiter paces outbound notifications per channel.
+	limiter *queue.Limiter
 }
 
 const (
-	valid    string = "valid"
-	expired  string = "expired"
-	expiring string = "expiring"
+	valid    = certeval.Valid
+	expired  = certeval.Expired
+	expiring = certeval.Expiring
+	critical = certeval.Critical
 )
 
 //+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=certificatemonitors,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
-//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=certificatemonitors/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=certificatemonitors/finalizers,verbs=update
+//+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=notificationpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=certificatesilences,verbs=get;list;watch
+//+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=certificatehistories,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.egarciam.com,resources=certificatehistories/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=pods;serviceaccounts,verbs=list
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=list
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=list
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=list
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the CertificateMonitor object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// A full scan only runs when it is due according to the monitor schedule, when
+// the spec changed, or when the rescan annotation is set; otherwise the request
+// is requeued for the next scan time.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.0/pkg/reconcile
 func (r *CertificateMonitorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	log := log.FromContext(context.Background())
+	log := log.FromContext(ctx)
 	log.Info("EN RECONCILIATION LOOP")
 
 	// TODO(user): your logic here
 	certMonitor := &monitoringv1alpha1.CertificateMonitor{}
 	if err := r.Get(ctx, req.NamespacedName, certMonitor); err != nil {
 		log.Error(err, "unable to fetch CertificateMonitor")
+		if apierrors.IsNotFound(err) {
+			forgetCertificateMetrics(req.Namespace, req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	now := time.Now()
+	sched, err := scheduleFor(certMonitor)
+	if err != nil {
+		log.Error(err, "invalid schedule, using default interval", "schedule", certMonitor.Spec.Schedule)
+	}
+
+	rescan := rescanRequested(certMonitor)
+	if !rescan && !scanDue(certMonitor, now) {
+		next := certMonitor.Status.NextScanTime.Time
+		changed := r.changes.take(req.NamespacedName)
+		retry, err := r.applyChanges(ctx, certMonitor, changed)
+		if err != nil {
+			log.Error(err, "failed to apply secret and node changes")
+			r.changes.add(req.NamespacedName, changed...)
+			return ctrl.Result{}, err
+		}
+		retry = earliest(retry, r.flushQueue(ctx, certMonitor, now))
+		retry = earliest(retry, nextAlertDue(certMonitor, now))
+		log.V(1).Info("scan not due yet", "nextScanTime", next.Format(time.RFC3339))
+		return ctrl.Result{RequeueAfter: requeueAfter(now, next, retry)}, nil
+	}
+	// A full scan relists every secret and node, so pending changes are
+	// covered by it.
+	r.changes.take(req.NamespacedName)
+
+	// The whole scan shares one deadline; the status is still written with
+	// whatever was collected before it expired.
+	scanCtx, cancel := context.WithTimeout(ctx, scanTimeout())
+	defer cancel()
+
 	updatedStatuses := []monitoringv1alpha1.MonitoredCertificateStatus{}
+	// complete is unset when a discovery failed, so the histories of the
+	// certificates it missed are kept.
+	complete := true
 	// var certStatuses []monitoringv1alpha1.MonitoredCertificateStatus
 	if certMonitor.Spec.DiscoverInternal {
 		log.Info("discoverInternal", fmt.Sprintf("%v", certMonitor.Spec.DiscoverInternal), "review certificates")
-		certStatuses, err := r.discoverInternalCerts(ctx, certMonitor.Spec.SendMail)
+		certStatuses, err := r.discoverInternalCerts(scanCtx, certMonitor.Status.MonitoredCertificates)
 		if err != nil {
 			log.Error(err, "failed to discover internal certs")
+			complete = false
 		} else {
 			updatedStatuses = append(updatedStatuses, certStatuses...)
 		}
@@ -103,20 +177,50 @@ func (r *CertificateMonitorReconciler) Reconcile(ctx context.Context, req ctrl.R
 	if certMonitor.Spec.DiscoverExternal {
 		certDirsList := filepath.SplitList(*config.CertDirs)
 		klog.InfoS("Check certificates", "discoverExternal", certMonitor.Spec.DiscoverExternal)
-		certStatuses, err := r.discoverExternalCerts(certDirsList, context.TODO(), nodeName)
+		certStatuses, err := r.discoverExternalCerts(certDirsList, scanCtx, nodeName)
 		if err != nil {
 			log.Error(err, "failed to discover external certs")
+			complete = false
 		} else {
 			updatedStatuses = append(updatedStatuses, certStatuses...)
 		}
 	}
+	// Probe HTTPS endpoints
+	if len(certMonitor.Spec.Endpoints) > 0 {
+		updatedStatuses = append(updatedStatuses, r.discoverEndpointCerts(scanCtx, certMonitor.Spec.Endpoints)...)
+	}
+	sortCertStatuses(updatedStatuses)
 
+	// Notify status transitions and reminders, reusing one SMTP session
+	ch := r.newChannels(ctx, certMonitor)
+	retry := r.notifyAlerts(ctx, ch, certMonitor, updatedStatuses, now, true)
+	ch.close()
+	r.recordEvents(ctx, certMonitor, updatedStatuses, now)
+	recordCertificateMetrics(certMonitor, updatedStatuses, now)
+
+	next := sched.Next(now)
 	certMonitor.Status.MonitoredCertificates = updatedStatuses
+	certMonitor.Status.LastScanTime = &metav1.Time{Time: now}
+	certMonitor.Status.NextScanTime = &metav1.Time{Time: next}
+	certMonitor.Status.ObservedGeneration = certMonitor.Generation
 	// log.Info(fmt.Sprintf("%v", updatedStatuses))
-	if err := r.Status().Update(ctx, certMonitor); err != nil {
+	if err := r.updateStatus(ctx, certMonitor); err != nil {
 		log.Error(err, "failed to update CertificateMonitor status")
 		return ctrl.Result{}, err
 	}
+	r.recordHistory(ctx, certMonitor, updatedStatuses, now, complete && scanCtx.Err() == nil)
+	retry = earliest(retry, nextAlertDue(certMonitor, now))
+
+	// Drop the rescan annotation only once the scan is recorded, so a failed
+	// status update leaves the request in place for the next attempt.
+	if rescan {
+		patch := client.MergeFrom(certMonitor.DeepCopy())
+		delete(certMonitor.Annotations, monitoringv1alpha1.RescanAnnotation)
+		if err := r.Patch(ctx, certMonitor, patch); err != nil {
+			log.Error(err, "failed to clear rescan annotation")
+			return ctrl.Result{}, err
+		}
+	}
 
 	// for _, cert := range certMonitor.Spec.Certificates {
 	// 	var status monitoringv1alpha1.MonitoredCertificateStatus
@@ -159,24 +263,71 @@ func (r *CertificateMonitorReconciler) Reconcile(ctx context.Context, req ctrl.R
 	// 	return ctrl.Result{}, err
 	// }
 
-	return ctrl.Result{RequeueAfter: 15 * time.Second}, nil
+	log.Info("scan completed", "certificates", len(updatedStatuses), "nextScanTime", next.Format(time.RFC3339))
+	return ctrl.Result{RequeueAfter: requeueAfter(now, next, retry)}, nil
+}
+
+// updateStatus writes the status of a monitor. The alerts of a reconcile are
+// delivered before its status is written, so a conflict must not drop the
+// notification state: the status is reapplied to a fresh copy of the monitor
+// until the write goes through, or every alert would be sent again.
+func (r *CertificateMonitorReconciler) updateStatus(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) error {
+	status := certMonitor.Status.DeepCopy()
+	reader := client.Reader(r.Client)
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := r.Status().Update(ctx, certMonitor)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+		latest := &monitoringv1alpha1.CertificateMonitor{}
+		if err := reader.Get(ctx, client.ObjectKeyFromObject(certMonitor), latest); err != nil {
+			return err
+		}
+		status.DeepCopyInto(&latest.Status)
+		*certMonitor = *latest
+		return err
+	})
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CertificateMonitorReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	// Add an index for the Secret type
-	if err := mgr.GetFieldIndexer().IndexField(context.TODO(), &corev1.Secret{}, "type", func(o client.Object) []string {
-		secret, ok := o.(*corev1.Secret)
-		if !ok {
-			return nil
-		}
-		return []string{string(secret.Type)}
-	}); err != nil {
+	r.ConfigMapName = "email-recipients-config" // ConfigMap name with email recipients
+	r.changes = newChangeTracker()
+	r.certs = newCertCache()
+	limiter, err := newLimiter()
+	if err != nil {
 		return err
 	}
-	r.ConfigMapName = "email-recipients-config" // ConfigMap name with email recipients
+	r.limiter = limiter
+
+	secretWatch := []builder.WatchesOption{builder.WithPredicates(tlsSecretPredicate)}
+	if r.MetadataOnlySecrets {
+		// The secret type is not part of the metadata, so every secret is
+		// watched and non-TLS ones are filtered out once fetched.
+		secretWatch = []builder.WatchesOption{builder.OnlyMetadata, builder.WithPredicates(secretMetadataPredicate(time.Now()))}
+	} else {
+		// Add an index for the Secret type
+		if err := mgr.GetFieldIndexer().IndexField(context.TODO(), &corev1.Secret{}, "type", func(o client.Object) []string {
+			secret, ok := o.(*corev1.Secret)
+			if !ok {
+				return nil
+			}
+			return []string{string(secret.Type)}
+		}); err != nil {
+			return err
+		}
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&monitoringv1alpha1.CertificateMonitor{}).
+		Watches(&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.secretToMonitors),
+			secretWatch...).
+		Watches(&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(r.nodeToMonitors),
+			builder.WithPredicates(nodeReportPredicate)).
 		Complete(r)
 }
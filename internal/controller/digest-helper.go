@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/queue"
+	"egarciam.com/checkcert/internal/templates"
+)
+
+// clusterScope is how entries without namespace (node files, endpoints) are grouped.
+const clusterScope = "(cluster)"
+
+// severityRank orders severities from most to least urgent.
+var severityRank = map[string]int{expired: 0, critical: 1, expiring: 2, valid: 3}
+
+func digestMode(certMonitor *monitoringv1alpha1.CertificateMonitor) monitoringv1alpha1.DigestMode {
+	if certMonitor.Spec.Digest == "" {
+		return monitoringv1alpha1.DigestNone
+	}
+	return certMonitor.Spec.Digest
+}
+
+// digestDue reports whether a digest may be sent now.
+func digestDue(certMonitor *monitoringv1alpha1.CertificateMonitor, now time.Time) bool {
+	last := certMonitor.Status.LastDigestTime
+	if digestMode(certMonitor) != monitoringv1alpha1.DigestDaily || last == nil {
+		return true
+	}
+	return now.Sub(last.Time) >= 24*time.Hour
+}
+
+// buildDigest groups the alerting entries by namespace, sorted by severity and
+// then by days left, and lists the resolved ones apart.
+func buildDigest(monitor string, current []monitoringv1alpha1.MonitoredCertificateStatus, alerts []alert, now time.Time) templates.Digest {
+	d := templates.Digest{Monitor: monitor, Generated: now, Counts: map[string]int{}}
+
+	byNamespace := map[string][]templates.Certificate{}
+	for _, s := range current {
+		if !isAlerting(s.Status) {
+			continue
+		}
+		ns := s.Namespace
+		if ns == "" {
+			ns = clusterScope
+		}
+		byNamespace[ns] = append(byNamespace[ns], templateCert(s, now))
+		d.Counts[s.Status]++
+	}
+	for ns, rows := range byNamespace {
+		sort.Slice(rows, func(i, j int) bool {
+			if severityRank[rows[i].Status] != severityRank[rows[j].Status] {
+				return severityRank[rows[i].Status] < severityRank[rows[j].Status]
+			}
+			if rows[i].DaysLeft != rows[j].DaysLeft {
+				return rows[i].DaysLeft < rows[j].DaysLeft
+			}
+			return rows[i].Name < rows[j].Name
+		})
+		d.Groups = append(d.Groups, templates.Group{Namespace: ns, Certificates: rows})
+	}
+	sort.Slice(d.Groups, func(i, j int) bool { return d.Groups[i].Namespace < d.Groups[j].Namespace })
+
+	for _, a := range alerts {
+		if a.kind == alertResolved {
+			d.Resolved = append(d.Resolved, templateCert(a.cert, now))
+		}
+	}
+	return d
+}
+
+// enqueueDigest queues for each recipient one digest with the findings of the
+// scan routed to them, when a digest is due, and returns the message IDs.
+func (r *CertificateMonitorReconciler) enqueueDigest(ctx context.Context, ch *channels, q *queue.Queue, certMonitor *monitoringv1alpha1.CertificateMonitor, current []monitoringv1alpha1.MonitoredCertificateStatus, alerts []alert, now time.Time) []string {
+	log := log.FromContext(ctx)
+	if !digestDue(certMonitor, now) {
+		return nil
+	}
+	perRecipient, err := r.digestRecipients(ctx, ch, current, alerts, now)
+	if err != nil {
+		log.Error(err, "failed to route digest")
+		return nil
+	}
+
+	recipients := make([]string, 0, len(perRecipient))
+	for rcpt := range perRecipient {
+		recipients = append(recipients, rcpt)
+	}
+	sort.Strings(recipients)
+
+	var ids []string
+	for _, rcpt := range recipients {
+		in := perRecipient[rcpt]
+		d := buildDigest(certMonitor.Name, in.current, in.alerts, now)
+		if d.Findings() == 0 && len(d.Resolved) == 0 {
+			continue
+		}
+		d.Cluster = clusterName()
+		d.Thresholds = thresholds(certMonitor)
+
+		msg, err := ch.mail.templates.RenderDigest(d)
+		if err != nil {
+			log.Error(err, "failed to render digest")
+			return nil
+		}
+		queued, err := enqueueMail(q, []string{rcpt}, "digest", msg, now)
+		if err != nil {
+			log.Error(err, "failed to queue digest", "recipient", rcpt)
+			return nil
+		}
+		log.Info("Digest queued", "recipient", rcpt, "findings", d.Findings(), "resolved", len(d.Resolved))
+		ids = append(ids, queued...)
+	}
+	return ids
+}
+
+// markDigest records that a digest went out, covering every alerting entry
+// and every entry whose resolution it reported.
+func markDigest(certMonitor *monitoringv1alpha1.CertificateMonitor, current []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) {
+	notified := &metav1.Time{Time: now}
+	certMonitor.Status.LastDigestTime = notified
+	for i := range current {
+		if isAlerting(current[i].Status) || isAlerting(current[i].LastNotifiedStatus) {
+			current[i].LastNotifiedStatus = current[i].Status
+			current[i].LastNotified = notified
+		}
+	}
+}
+
+// digestContent is what goes into the digest of one recipient.
+type digestContent struct {
+	current []monitoringv1alpha1.MonitoredCertificateStatus
+	alerts  []alert
+}
+
+// digestRecipients splits the findings of a scan between the recipients they
+// are routed to by email. Silenced certificates are left out.
+func (r *CertificateMonitorReconciler) digestRecipients(ctx context.Context, ch *channels, current []monitoringv1alpha1.MonitoredCertificateStatus, alerts []alert, now time.Time) (map[string]*digestContent, error) {
+	out := map[string]*digestContent{}
+	recipientsOf := func(s monitoringv1alpha1.MonitoredCertificateStatus) ([]*digestContent, error) {
+		dest, err := r.route(ctx, ch, s, alertSeverity(s))
+		if err != nil || !dest.has(monitoringv1alpha1.ChannelEmail) {
+			return nil, err
+		}
+		var contents []*digestContent
+		for _, rcpt := range dest.recipients {
+			if out[rcpt] == nil {
+				out[rcpt] = &digestContent{}
+			}
+			contents = append(contents, out[rcpt])
+		}
+		return contents, nil
+	}
+
+	for _, s := range current {
+		if !isAlerting(s.Status) || silenced(s, now) {
+			continue
+		}
+		contents, err := recipientsOf(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range contents {
+			c.current = append(c.current, s)
+		}
+	}
+	for _, a := range alerts {
+		if a.kind != alertResolved || silenced(current[a.index], now) {
+			continue
+		}
+		contents, err := recipientsOf(a.cert)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range contents {
+			c.alerts = append(c.alerts, a)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/templates"
+)
+
+var _ = Describe("Digest", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	in := func(days int) string { return now.Add(time.Duration(days) * 24 * time.Hour).Format(time.RFC3339) }
+
+	current := []monitoringv1alpha1.MonitoredCertificateStatus{
+		{Name: "internal-b-api", Namespace: "b", Status: expiring, Expiry: in(20)},
+		{Name: "internal-a-web", Namespace: "a", Status: expiring, Expiry: in(10)},
+		{Name: "internal-a-old", Namespace: "a", Status: expired, Expiry: in(-3)},
+		{Name: "internal-a-ok", Namespace: "a", Status: valid, Expiry: in(200)},
+		{Name: "endpoint-example.com", Status: expiring, Expiry: in(5)},
+	}
+
+	It("groups findings by namespace, most severe first", func() {
+		d := buildDigest("prod", current, nil, now)
+		Expect(d.Findings()).To(Equal(4))
+		Expect(d.Counts).To(Equal(map[string]int{expired: 1, expiring: 3}))
+		Expect(d.Groups).To(HaveLen(3))
+		Expect(d.Groups[0].Namespace).To(Equal(clusterScope))
+		Expect(d.Groups[1].Namespace).To(Equal("a"))
+		Expect(d.Groups[1].Certificates[0].Name).To(Equal("internal-a-old"))
+		Expect(d.Groups[1].Certificates[1].DaysLeft).To(Equal(10))
+	})
+
+	It("renders plain-text and HTML parts", func() {
+		resolved := []alert{{kind: alertResolved, cert: monitoringv1alpha1.MonitoredCertificateStatus{Name: "internal-c-new", Status: valid, Expiry: in(90)}}}
+		msg, err := templates.Builtin().RenderDigest(buildDigest("prod", current, resolved, now))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Subject).To(Equal("[prod] 4 certificate(s) need attention"))
+		Expect(msg.Text).To(ContainSubstring("== a =="))
+		Expect(msg.Text).To(ContainSubstring("internal-c-new"))
+		Expect(msg.HTML).To(ContainSubstring("<td>internal-a-old</td>"))
+	})
+})
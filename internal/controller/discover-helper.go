@@ -2,16 +2,13 @@ package controller
 
 import (
 	"context"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
-	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/certeval"
 	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -24,14 +21,6 @@ import (
 
 // Define Prometheus metrics
 var (
-	certExpiryGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "node_cert_expiry_days",
-			Help: "Time in days until the certificate expires",
-		},
-		[]string{"status", "node", "filename"},
-	)
-
 	sslCertificateState = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "ssl_certificate_state",
@@ -50,66 +39,65 @@ var (
 	// debug                       = flag.Bool("debug", false, "Enable debug logging")
 )
 
-// logic to search for kubernetes.io/tls secrets across namespaces.
-func (r *CertificateMonitorReconciler) discoverInternalCerts(ctx context.Context, sendMail bool) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
+// logic to search for kubernetes.io/tls secrets across namespaces. A secret
+// that fails to evaluate, or is not evaluated before the scan times out, keeps
+// its entry from previous rather than disappearing from the status.
+func (r *CertificateMonitorReconciler) discoverInternalCerts(ctx context.Context, previous []monitoringv1alpha1.MonitoredCertificateStatus) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
 	var certStatuses []monitoringv1alpha1.MonitoredCertificateStatus
-	var recipients []string
-	log := log.FromContext(context.Background())
+	log := log.FromContext(ctx)
 	log.Info("discoverInternalCerts")
 	// List all secrets of type kubernetes.io/tls
-	secretList := &corev1.SecretList{}
-	if err := r.List(ctx, secretList, client.MatchingFields{"type": "kubernetes.io/tls"}); err != nil {
+	internalCerts, err := r.listInternalCerts(ctx)
+	if err != nil {
 		log.Error(err, err.Error())
 		return nil, err
 	}
-	//Enviamos correo?
-	//TODO optimizar para no hacerlo en cada ciclo
-	if sendMail {
-		log.Info("SendMail", fmt.Sprintf("%v", sendMail), "Envio de correo activo - habra que enviar correo con estado de los certificados")
-		var err error
-		recipients, err = r.getRecipients(ctx)
-		if err != nil {
-			log.Error(err, "Failed to get recipients")
-		} else {
-			log.Info("Recipients fetched successfully", "recipients", recipients)
+
+	var usage usageIndex
+	if mapWorkloadUsage() {
+		if usage, err = r.buildUsageIndex(ctx); err != nil {
+			log.Error(err, "unable to map the workloads using certificate secrets")
 		}
 	}
 
-	for _, secret := range secretList.Items {
-		expiry, err := r.getInternalCertExpiry(ctx, secret.Namespace, secret.Name)
+	owners := r.newOwnerResolver()
+	for _, ic := range internalCerts {
+		certStatus, err := r.evaluateInternalCert(ctx, ic)
 		if err != nil {
-			log.Error(err, err.Error())
-			continue // Handle error or log it
-		}
-
-		status := GetCertificateStatus(expiry)
-		switch status {
-		case valid:
-			log.Info("Valid certificate", "name", secret.Name, "expiry date", expiry.Format(time.RFC3339))
-		case expiring:
-		case expired:
-			log.Info("Certificate", "status", status, "name", secret.Name, "expiry date", expiry.Format(time.RFC3339), "days left", (expiry.Sub(time.Now())).Hours()/24)
-			if sendMail {
-				if err := r.sendMails(status, secret.Name, expiry, recipients); err != nil {
-					log.Error(err, "email failed", "certificate", secret.Name, "status", status)
-				} else {
-					log.Info("Email sent for certificate", "name", secret.Name, "status", status)
-				}
+			log.Error(err, "failed to evaluate secret", "secret", ic.key)
+			if last, ok := findCertStatus(previous, certeval.InternalName(ic.key.Namespace, ic.key.Name)); ok {
+				certStatuses = append(certStatuses, last)
 			}
-
+			continue
 		}
-
-		certStatuses = append(certStatuses, monitoringv1alpha1.MonitoredCertificateStatus{
-			Name:      fmt.Sprintf("internal-%s-%s", secret.Namespace, secret.Name),
-			Status:    GetCertificateStatus(expiry),
-			Expiry:    expiry.Format(time.RFC3339),
-			Namespace: secret.Namespace,
-		})
+		certStatus.UsedBy = usage.usedBy(ic.key)
+		if ic.meta != nil {
+			certStatus.Owner = owners.resolve(ctx, ic.meta)
+		}
+		certStatuses = append(certStatuses, certStatus)
 	}
 
 	return certStatuses, nil
 }
 
+// evaluateInternalCert builds the status entry of the certificate stored in a
+// single TLS secret. Notifications are sent afterwards, see notifyAlerts.
+func (r *CertificateMonitorReconciler) evaluateInternalCert(ctx context.Context, ic internalCert) (monitoringv1alpha1.MonitoredCertificateStatus, error) {
+	log := log.FromContext(ctx)
+	if ic.err != nil {
+		return monitoringv1alpha1.MonitoredCertificateStatus{}, ic.err
+	}
+
+	certStatus := certeval.SecretStatus(ic.key, ic.cert, ic.managedBy)
+	switch certStatus.Status {
+	case valid:
+		log.Info("Valid certificate", "name", ic.key.Name, "expiry date", certStatus.Expiry)
+	case expiring, critical, expired:
+		log.Info("Certificate", "status", certStatus.Status, "name", ic.key.Name, "expiry date", certStatus.Expiry, "days left", (ic.cert.NotAfter.Sub(time.Now())).Hours()/24)
+	}
+	return certStatus, nil
+}
+
 // func checkCerts Logicto check external certificates
 func (r *CertificateMonitorReconciler) discoverExternalCerts(certDirs []string, ctx context.Context, nodeName string) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
 	var certStatuses []monitoringv1alpha1.MonitoredCertificateStatus
@@ -123,10 +111,12 @@ func (r *CertificateMonitorReconciler) discoverExternalCerts(certDirs []string,
 		return nil, err
 	}
 
+	var controlPlaneNodes []corev1.Node
 	for _, node := range nodeList.Items {
 		klog.InfoS("Iterating nodes", "node", node.Name)
 
 		if isControlPlaneNode(node) {
+			controlPlaneNodes = append(controlPlaneNodes, node)
 			pod := r.createExternalNodeCheckerPod(node.Name)
 			if err := r.Create(ctx, pod); err != nil {
 				if !errors.IsAlreadyExists(err) {
@@ -158,6 +148,9 @@ func (r *CertificateMonitorReconciler) discoverExternalCerts(certDirs []string,
 
 	}
 
+	// Collect what the checker pods reported on previous runs
+	certStatuses = aggregateNodeReports(controlPlaneNodes)
+
 	return certStatuses, nil
 }
 
@@ -167,48 +160,25 @@ func (r *CertificateMonitorReconciler) discoverExternalCerts(certDirs []string,
 // }
 
 // func checkCertificare Logic to check particular certificate
-// TODO posiblemenete duplicada con GetCertificateStatus en discover-helper.go
 func (r *CertificateMonitorReconciler) checkCertificate(path string, info os.FileInfo, err error, clientset *kubernetes.Clientset, nodeName string, certstatus []monitoringv1alpha1.MonitoredCertificateStatus) error {
 	if err != nil {
 		return err
 	}
 
-	if info.IsDir() || (filepath.Ext(path) != ".crt" && filepath.Ext(path) != ".pem") {
-		return nil
-	}
-
-	certData, err := ioutil.ReadFile(path)
-	if err != nil {
-		klog.Infof("Failed to read certificate %s: %v", path, err)
-		return nil
-	}
-
-	block, _ := pem.Decode(certData)
-	if block == nil {
-		klog.Infof("Failed to parse PEM in %s", path)
+	if info.IsDir() || !certeval.IsCertificateFile(path) {
 		return nil
 	}
 
-	cert, err := x509.ParseCertificate(block.Bytes)
+	certStatus, err := certeval.EvaluateCertificateFile(path, nodeName)
 	if err != nil {
-		klog.Infof("Failed to parse certificate %s: %v", path, err)
+		klog.Infof("Failed to check certificate: %v", err)
 		return nil
 	}
 
-	expiry := cert.NotAfter
-	daysRemaining := time.Until(expiry).Hours() / 24
-
-	var status string
-	if daysRemaining < 0 {
-		status = "EXPIRED"
-	} else if daysRemaining < float64(*config.DefaultWarningDays) {
-		status = "EXPIRING"
-	} else {
-		status = "VALID"
-	}
-
-	klog.InfoS("Certificate control:", "certificate", path, "status", status, "node", nodeName, "expiry-date", expiry, "days-remaining", daysRemaining)
-	//	certExpiryGauge.WithLabelValues(status, nodeName, path).Set(daysRemaining)
+	// Node annotations carry the status in upper case, see nodeReport.
+	status := strings.ToUpper(certStatus.Status)
+	expiry, _ := time.Parse(time.RFC3339, certStatus.Expiry)
+	klog.InfoS("Certificate control:", "certificate", path, "status", status, "node", nodeName, "expiry-date", expiry, "days-remaining", time.Until(expiry).Hours()/24)
 
 	return r.annotateNode(clientset, nodeName, path, status, expiry)
 }
@@ -225,8 +195,8 @@ func (r *CertificateMonitorReconciler) annotateNode(clientset *kubernetes.Client
 		node.Annotations = make(map[string]string)
 	}
 
-	node.Annotations["cert-status-"+filepath.Base(certPath)] = status
-	node.Annotations["cert-expiry-"+filepath.Base(certPath)] = expiry.Format(time.RFC3339)
+	node.Annotations[nodeCertStatusPrefix+filepath.Base(certPath)] = status
+	node.Annotations[nodeCertExpiryPrefix+filepath.Base(certPath)] = expiry.Format(time.RFC3339)
 
 	_, err := clientset.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
 	if err != nil {
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// Reasons of the Events recorded for certificate transitions.
+const (
+	reasonExpiring = "CertificateExpiring"
+	reasonCritical = "CertificateCritical"
+	reasonExpired  = "CertificateExpired"
+	reasonRenewed  = "CertificateRenewed"
+)
+
+// certEvent is an Event to record for one certificate.
+type certEvent struct {
+	cert      monitoringv1alpha1.MonitoredCertificateStatus
+	eventType string
+	reason    string
+	message   string
+}
+
+// planEvents compares the previous entries of a monitor with the current
+// ones and returns an Event for every certificate that became expiring,
+// critical or expired, and for every certificate that was renewed.
+func planEvents(previous, current []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) []certEvent {
+	prev := make(map[string]monitoringv1alpha1.MonitoredCertificateStatus, len(previous))
+	for _, p := range previous {
+		prev[p.Name] = p
+	}
+
+	var events []certEvent
+	for _, s := range current {
+		p, known := prev[s.Name]
+		c := templateCert(s, now)
+		if known && p.Fingerprint != "" && s.Fingerprint != "" && p.Fingerprint != s.Fingerprint {
+			events = append(events, certEvent{s, corev1.EventTypeNormal, reasonRenewed,
+				fmt.Sprintf("Certificate %s was renewed, it now expires on %s", s.Name, s.Expiry)})
+		}
+		if known && p.Status == s.Status {
+			continue
+		}
+		switch s.Status {
+		case expiring:
+			events = append(events, certEvent{s, corev1.EventTypeWarning, reasonExpiring,
+				fmt.Sprintf("Certificate %s expires in %d days, on %s", s.Name, c.DaysLeft, s.Expiry)})
+		case critical:
+			events = append(events, certEvent{s, corev1.EventTypeWarning, reasonCritical,
+				fmt.Sprintf("Certificate %s expires in %d days, on %s", s.Name, c.DaysLeft, s.Expiry)})
+		case expired:
+			events = append(events, certEvent{s, corev1.EventTypeWarning, reasonExpired,
+				fmt.Sprintf("Certificate %s expired on %s", s.Name, s.Expiry)})
+		}
+	}
+	return events
+}
+
+// recordEvents records the Events of a scan on the monitor and on the Secret
+// or Node holding each certificate, so they show up in kubectl describe and
+// in event exporters. Nothing is recorded without a recorder.
+func (r *CertificateMonitorReconciler) recordEvents(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, current []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) {
+	if r.Recorder == nil {
+		return
+	}
+	log := log.FromContext(ctx)
+	for _, e := range planEvents(certMonitor.Status.MonitoredCertificates, current, now) {
+		r.Recorder.Event(certMonitor, e.eventType, e.reason, e.message)
+		obj, err := r.sourceObject(ctx, e.cert)
+		if err != nil {
+			log.Error(err, "failed to fetch certificate source for event", "certificate", e.cert.Name)
+			continue
+		}
+		if obj != nil {
+			r.Recorder.Event(obj, e.eventType, e.reason, e.message)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var _ = Describe("Events", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	entry := func(status, fingerprint string) monitoringv1alpha1.MonitoredCertificateStatus {
+		return monitoringv1alpha1.MonitoredCertificateStatus{
+			Name: "internal-shop-web", Type: "internal", Path: "shop/web", Namespace: "shop",
+			Status: status, Fingerprint: fingerprint, Expiry: now.Add(20 * 24 * time.Hour).Format(time.RFC3339),
+		}
+	}
+	list := func(e ...monitoringv1alpha1.MonitoredCertificateStatus) []monitoringv1alpha1.MonitoredCertificateStatus {
+		return e
+	}
+
+	It("warns when a certificate starts expiring", func() {
+		events := planEvents(list(entry(valid, "a")), list(entry(expiring, "a")), now)
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].eventType).To(Equal(corev1.EventTypeWarning))
+		Expect(events[0].reason).To(Equal(reasonExpiring))
+		Expect(events[0].message).To(ContainSubstring("expires in 20 days"))
+	})
+
+	It("stays quiet while the status holds", func() {
+		Expect(planEvents(list(entry(expired, "a")), list(entry(expired, "a")), now)).To(BeEmpty())
+	})
+
+	It("reports a renewal", func() {
+		events := planEvents(list(entry(critical, "a")), list(entry(valid, "b")), now)
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].eventType).To(Equal(corev1.EventTypeNormal))
+		Expect(events[0].reason).To(Equal(reasonRenewed))
+	})
+
+	It("records on the monitor and the secret", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}}
+		recorder := record.NewFakeRecorder(10)
+		r := &CertificateMonitorReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build(),
+			Recorder: recorder,
+		}
+		m := &monitoringv1alpha1.CertificateMonitor{}
+		m.Status.MonitoredCertificates = list(entry(critical, "a"))
+
+		r.recordEvents(context.Background(), m, list(entry(expired, "a")), now)
+		Expect(recorder.Events).To(HaveLen(2))
+		Expect(<-recorder.Events).To(HavePrefix("Warning CertificateExpired"))
+	})
+})
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/config"
+)
+
+// defaultHistoryLimit is used when --certificate-history-limit is not set.
+const defaultHistoryLimit = 10
+
+// historyRefresh is how stale the last observation of an unchanged
+// certificate may get before its history is written again.
+const historyRefresh = 24 * time.Hour
+
+// historyRetention is how long the history of a certificate that complete
+// scans no longer find is kept, so a secret recreated or an endpoint down for
+// a while picks its history up again.
+const historyRetention = 7 * 24 * time.Hour
+
+// historyLimit is the number of certificates kept in each history. Zero
+// disables the histories.
+func historyLimit() int {
+	if config.HistoryLimit == nil {
+		return defaultHistoryLimit
+	}
+	if *config.HistoryLimit < 0 {
+		return 0
+	}
+	return *config.HistoryLimit
+}
+
+// historyName is the CertificateHistory of a certificate of a monitor.
+// Certificate names hold paths and endpoints, so they are hashed to give a
+// valid object name.
+func historyName(monitor, certificate string) string {
+	if len(monitor) > 240 {
+		monitor = monitor[:240]
+	}
+	sum := sha256.Sum256([]byte(certificate))
+	return monitor + "-" + hex.EncodeToString(sum[:6])
+}
+
+// recordHistory adds the certificates found by a scan to the histories of
+// the monitor, creating the missing ones. Certificates without a fingerprint
+// cannot be told apart across scans and are skipped. A history is only
+// written when it changed, see historyChanged. With prune, statuses are every
+// certificate of the monitor, and the histories of the others are deleted once
+// they were last observed more than historyRetention ago.
+// Failures are logged: the history is informational and never blocks a scan.
+func (r *CertificateMonitorReconciler) recordHistory(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, statuses []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time, prune bool) {
+	limit := historyLimit()
+	if limit == 0 {
+		return
+	}
+	log := log.FromContext(ctx)
+
+	// Histories are not watched; read them from the API server in one list
+	// rather than caching every history of the cluster.
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	list := &monitoringv1alpha1.CertificateHistoryList{}
+	if err := reader.List(ctx, list, client.InNamespace(certMonitor.Namespace), client.MatchingLabels{monitoringv1alpha1.MonitorLabel: certMonitor.Name}); err != nil {
+		log.Error(err, "unable to list certificate histories")
+		return
+	}
+	existing := make(map[string]*monitoringv1alpha1.CertificateHistory, len(list.Items))
+	for i := range list.Items {
+		existing[list.Items[i].Name] = &list.Items[i]
+	}
+
+	if prune {
+		scanned := make(map[string]bool, len(statuses))
+		for _, s := range statuses {
+			scanned[historyName(certMonitor.Name, s.Name)] = true
+		}
+		for name, history := range existing {
+			if scanned[name] || now.Sub(lastObserved(history)) < historyRetention {
+				continue
+			}
+			if err := r.Delete(ctx, history); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "unable to delete certificate history", "certificate", history.Spec.Certificate)
+				continue
+			}
+			log.V(1).Info("Deleted history of removed certificate", "certificate", history.Spec.Certificate)
+		}
+	}
+
+	for _, s := range statuses {
+		if s.Fingerprint == "" {
+			continue
+		}
+		name := historyName(certMonitor.Name, s.Name)
+		history, ok := existing[name]
+		var before *monitoringv1alpha1.CertificateHistoryStatus
+		if ok {
+			before = history.Status.DeepCopy()
+		} else {
+			history = &monitoringv1alpha1.CertificateHistory{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            name,
+					Namespace:       certMonitor.Namespace,
+					Labels:          map[string]string{monitoringv1alpha1.MonitorLabel: certMonitor.Name},
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(certMonitor, monitoringv1alpha1.GroupVersion.WithKind("CertificateMonitor"))},
+				},
+				Spec: monitoringv1alpha1.CertificateHistorySpec{Monitor: certMonitor.Name, Certificate: s.Name, Type: s.Type, Path: s.Path},
+			}
+			if err := r.Create(ctx, history); err != nil {
+				log.Error(err, "unable to create certificate history", "certificate", s.Name)
+				continue
+			}
+		}
+		if renewed := observe(&history.Status, s, now, limit); renewed != nil {
+			log.Info("Certificate renewal recorded", "certificate", s.Name, "renewedBeforeExpiry", renewed.Duration.String())
+		}
+		if before != nil && !historyChanged(before, &history.Status) {
+			continue
+		}
+		if err := r.Status().Update(ctx, history); err != nil {
+			log.Error(err, "unable to update certificate history", "certificate", s.Name)
+		}
+	}
+}
+
+// lastObserved is when a scan last found the certificate of a history, or
+// when the history was created if none recorded it.
+func lastObserved(h *monitoringv1alpha1.CertificateHistory) time.Time {
+	if n := len(h.Status.Observations); n > 0 {
+		return h.Status.Observations[n-1].LastObserved.Time
+	}
+	return h.CreationTimestamp.Time
+}
+
+// historyChanged reports whether an observation has to be written: the
+// certificate, its renewals or its expiry changed, or the last observation
+// stored is older than historyRefresh.
+func historyChanged(before, after *monitoringv1alpha1.CertificateHistoryStatus) bool {
+	n := len(before.Observations)
+	if n == 0 || n != len(after.Observations) || before.Renewals != after.Renewals || before.Expired != after.Expired {
+		return true
+	}
+	stored, seen := before.Observations[n-1], after.Observations[n-1]
+	if stored.Fingerprint != seen.Fingerprint {
+		return true
+	}
+	return seen.LastObserved.Sub(stored.LastObserved.Time) >= historyRefresh
+}
+
+// observe adds a scan result to a history. A known fingerprint only moves
+// its last observation; a new one records a renewal, how long before the
+// expiry of the replaced certificate it happened, and drops the oldest
+// observations beyond limit. It returns the renewal margin when the
+// certificate was renewed.
+func observe(h *monitoringv1alpha1.CertificateHistoryStatus, s monitoringv1alpha1.MonitoredCertificateStatus, now time.Time, limit int) *metav1.Duration {
+	seen := metav1.NewTime(now)
+	var renewed *metav1.Duration
+	if n := len(h.Observations); n > 0 && h.Observations[n-1].Fingerprint == s.Fingerprint {
+		h.Observations[n-1].LastObserved = seen
+	} else {
+		if n > 0 {
+			prev := &h.Observations[n-1]
+			at := renewedAt(prev, s, now)
+			if notAfter, err := time.Parse(time.RFC3339, prev.NotAfter); err == nil {
+				renewed = &metav1.Duration{Duration: notAfter.Sub(at)}
+				prev.RenewedBeforeExpiry = renewed
+			}
+			h.Renewals++
+			h.LastRenewed = &metav1.Time{Time: at}
+		}
+		h.Observations = append(h.Observations, monitoringv1alpha1.CertificateObservation{
+			SerialNumber:  s.SerialNumber,
+			Fingerprint:   s.Fingerprint,
+			NotBefore:     s.NotBefore,
+			NotAfter:      s.Expiry,
+			FirstObserved: seen,
+			LastObserved:  seen,
+		})
+		if len(h.Observations) > limit {
+			h.Observations = append([]monitoringv1alpha1.CertificateObservation(nil), h.Observations[len(h.Observations)-limit:]...)
+		}
+	}
+
+	h.Expired = false
+	if notAfter, err := time.Parse(time.RFC3339, s.Expiry); err == nil {
+		h.Expired = !now.Before(notAfter)
+	}
+	return renewed
+}
+
+// renewedAt estimates when a certificate was replaced: at the start of
+// validity of its replacement when that falls between the scans that saw
+// them, else when the replacement was found.
+func renewedAt(prev *monitoringv1alpha1.CertificateObservation, s monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) time.Time {
+	notBefore, err := time.Parse(time.RFC3339, s.NotBefore)
+	if err != nil || notBefore.Before(prev.FirstObserved.Time) || notBefore.After(now) {
+		return now
+	}
+	return notBefore
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var _ = Describe("Certificate history", func() {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cert := func(fingerprint, notBefore, notAfter string) monitoringv1alpha1.MonitoredCertificateStatus {
+		return monitoringv1alpha1.MonitoredCertificateStatus{
+			Name: "internal-shop-web", Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: valid,
+			Fingerprint: fingerprint, SerialNumber: "0" + fingerprint, NotBefore: notBefore, Expiry: notAfter,
+		}
+	}
+
+	It("records renewals and how long before expiry they happened", func() {
+		h := &monitoringv1alpha1.CertificateHistoryStatus{}
+		Expect(observe(h, cert("aa", "2024-05-01T00:00:00Z", "2024-07-01T00:00:00Z"), start, 2)).To(BeNil())
+		Expect(observe(h, cert("aa", "2024-05-01T00:00:00Z", "2024-07-01T00:00:00Z"), start.Add(24*time.Hour), 2)).To(BeNil())
+		Expect(h.Observations).To(HaveLen(1))
+		Expect(h.Observations[0].FirstObserved.Time).To(Equal(start))
+		Expect(h.Observations[0].LastObserved.Time).To(Equal(start.Add(24 * time.Hour)))
+
+		// Issued between the scans: the renewal dates from its NotBefore.
+		renewed := observe(h, cert("bb", "2024-06-21T00:00:00Z", "2024-08-20T00:00:00Z"), start.Add(30*24*time.Hour), 2)
+		Expect(renewed).NotTo(BeNil())
+		Expect(renewed.Duration).To(Equal(10 * 24 * time.Hour))
+		Expect(h.Observations[0].RenewedBeforeExpiry).To(Equal(renewed))
+		Expect(h.Renewals).To(Equal(int32(1)))
+		Expect(h.LastRenewed.Time).To(Equal(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)))
+
+		// Replaced after expiring, by a certificate issued long before.
+		late := start.Add(90 * 24 * time.Hour)
+		renewed = observe(h, cert("cc", "2024-01-01T00:00:00Z", "2025-01-01T00:00:00Z"), late, 2)
+		Expect(renewed.Duration).To(Equal(time.Date(2024, 8, 20, 0, 0, 0, 0, time.UTC).Sub(late)))
+		Expect(renewed.Duration).To(BeNumerically("<", 0))
+		Expect(h.Renewals).To(Equal(int32(2)))
+		Expect(h.Observations).To(HaveLen(2))
+		Expect(h.Observations[0].Fingerprint).To(Equal("bb"))
+		Expect(h.Observations[1].Fingerprint).To(Equal("cc"))
+		Expect(h.Expired).To(BeFalse())
+	})
+
+	It("flags certificates that expired without being renewed", func() {
+		h := &monitoringv1alpha1.CertificateHistoryStatus{}
+		observe(h, cert("aa", "2024-05-01T00:00:00Z", "2024-06-10T00:00:00Z"), start, 10)
+		Expect(h.Expired).To(BeFalse())
+		observe(h, cert("aa", "2024-05-01T00:00:00Z", "2024-06-10T00:00:00Z"), start.Add(10*24*time.Hour), 10)
+		Expect(h.Expired).To(BeTrue())
+		Expect(h.Renewals).To(BeZero())
+		Expect(h.LastRenewed).To(BeNil())
+	})
+
+	It("keeps one history per certificate of a monitor", func() {
+		monitor := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "prod", UID: "m1"}}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(monitor).
+			WithStatusSubresource(&monitoringv1alpha1.CertificateHistory{}).Build()
+		r := &CertificateMonitorReconciler{Client: c}
+		ctx := context.Background()
+
+		endpoint := monitoringv1alpha1.MonitoredCertificateStatus{Name: "endpoint-example.com:443", Type: "endpoint", Status: "error"}
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{cert("aa", "2024-05-01T00:00:00Z", "2024-07-01T00:00:00Z"), endpoint}, start, true)
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{cert("bb", "2024-06-01T00:00:00Z", "2024-08-01T00:00:00Z")}, start.Add(time.Hour), true)
+
+		list := &monitoringv1alpha1.CertificateHistoryList{}
+		Expect(c.List(ctx, list)).To(Succeed())
+		Expect(list.Items).To(HaveLen(1))
+		history := list.Items[0]
+		Expect(history.Name).To(Equal(historyName("prod", "internal-shop-web")))
+		Expect(history.Labels).To(HaveKeyWithValue(monitoringv1alpha1.MonitorLabel, "prod"))
+		Expect(history.OwnerReferences).To(HaveLen(1))
+		Expect(history.OwnerReferences[0].Name).To(Equal("prod"))
+		Expect(history.Spec).To(Equal(monitoringv1alpha1.CertificateHistorySpec{Monitor: "prod", Certificate: "internal-shop-web", Type: "internal", Path: "shop/web-tls"}))
+		Expect(history.Status.Renewals).To(Equal(int32(1)))
+		Expect(history.Status.Observations).To(HaveLen(2))
+		// Issued before the first scan: the renewal dates from the scan finding it.
+		Expect(history.Status.Observations[0].RenewedBeforeExpiry.Duration).To(Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC).Sub(start.Add(time.Hour))))
+
+		other := &monitoringv1alpha1.CertificateHistory{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "monitoring", Name: historyName("prod", endpoint.Name)}, other)).NotTo(Succeed())
+	})
+
+	It("only writes histories that changed", func() {
+		monitor := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "prod", UID: "m1"}}
+		updates := 0
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(monitor).
+			WithStatusSubresource(&monitoringv1alpha1.CertificateHistory{}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceUpdate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+					updates++
+					return c.SubResource(subResourceName).Update(ctx, obj, opts...)
+				},
+			}).Build()
+		r := &CertificateMonitorReconciler{Client: c}
+		ctx := context.Background()
+		scan := func(at time.Time, certs ...monitoringv1alpha1.MonitoredCertificateStatus) {
+			r.recordHistory(ctx, monitor, certs, at, true)
+		}
+		web := cert("aa", "2024-05-01T00:00:00Z", "2024-07-01T00:00:00Z")
+
+		scan(start, web)
+		Expect(updates).To(Equal(1))
+		scan(start.Add(time.Hour), web)
+		scan(start.Add(23*time.Hour), web)
+		Expect(updates).To(Equal(1))
+
+		// The last observation is refreshed once a day.
+		scan(start.Add(24*time.Hour), web)
+		Expect(updates).To(Equal(2))
+		// Renewals and expiry are written at once.
+		scan(start.Add(25*time.Hour), cert("bb", "2024-06-01T00:00:00Z", "2024-06-03T00:00:00Z"))
+		Expect(updates).To(Equal(3))
+		scan(start.Add(48*time.Hour), cert("bb", "2024-06-01T00:00:00Z", "2024-06-03T00:00:00Z"))
+		Expect(updates).To(Equal(4))
+
+		history := &monitoringv1alpha1.CertificateHistory{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: "monitoring", Name: historyName("prod", web.Name)}, history)).To(Succeed())
+		Expect(history.Status.Expired).To(BeTrue())
+		Expect(history.Status.Renewals).To(Equal(int32(1)))
+	})
+
+	It("deletes the histories of certificates no longer scanned for a week", func() {
+		monitor := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "prod", UID: "m1"}}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(monitor).
+			WithStatusSubresource(&monitoringv1alpha1.CertificateHistory{}).Build()
+		r := &CertificateMonitorReconciler{Client: c}
+		ctx := context.Background()
+		web := cert("aa", "2024-05-01T00:00:00Z", "2024-07-01T00:00:00Z")
+		db := cert("bb", "2024-05-01T00:00:00Z", "2024-07-01T00:00:00Z")
+		db.Name, db.Path = "internal-shop-db", "shop/db-tls"
+		histories := func() []string {
+			list := &monitoringv1alpha1.CertificateHistoryList{}
+			Expect(c.List(ctx, list)).To(Succeed())
+			var names []string
+			for _, h := range list.Items {
+				names = append(names, h.Spec.Certificate)
+			}
+			return names
+		}
+
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{web, db}, start, true)
+		Expect(histories()).To(ConsistOf("internal-shop-web", "internal-shop-db"))
+
+		// Partial scans, such as secret changes, keep the other histories.
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{web}, start.Add(time.Hour), false)
+		Expect(histories()).To(HaveLen(2))
+
+		// An unreadable certificate keeps its history.
+		unreadable := db
+		unreadable.Fingerprint, unreadable.Status = "", "error"
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{web, unreadable}, start.Add(2*time.Hour), true)
+		Expect(histories()).To(HaveLen(2))
+
+		// A certificate missing from a complete scan keeps its history for a while.
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{web}, start.Add(3*time.Hour), true)
+		Expect(histories()).To(HaveLen(2))
+
+		r.recordHistory(ctx, monitor, []monitoringv1alpha1.MonitoredCertificateStatus{web}, start.Add(historyRetention), true)
+		Expect(histories()).To(ConsistOf("internal-shop-web"))
+	})
+})
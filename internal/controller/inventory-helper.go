@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// ListMonitoredCertificates returns the certificates recorded in the status of
+// every CertificateMonitor, node reports included, sorted by name. A
+// certificate watched by several monitors is listed once.
+func ListMonitoredCertificates(ctx context.Context, c client.Reader) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
+	monitors := &monitoringv1alpha1.CertificateMonitorList{}
+	if err := c.List(ctx, monitors); err != nil {
+		return nil, fmt.Errorf("unable to list CertificateMonitors: %w", err)
+	}
+	sort.Slice(monitors.Items, func(i, j int) bool {
+		a, b := monitors.Items[i], monitors.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	var certs []monitoringv1alpha1.MonitoredCertificateStatus
+	seen := map[string]bool{}
+	for _, m := range monitors.Items {
+		for _, s := range m.Status.MonitoredCertificates {
+			if seen[s.Name] {
+				continue
+			}
+			seen[s.Name] = true
+			certs = append(certs, s)
+		}
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Name < certs[j].Name })
+	return certs, nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var _ = Describe("ListMonitoredCertificates", func() {
+	It("flattens the monitors, listing shared certificates once", func() {
+		monitor := func(namespace, name string, certs ...string) *monitoringv1alpha1.CertificateMonitor {
+			m := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+			for _, c := range certs {
+				m.Status.MonitoredCertificates = append(m.Status.MonitoredCertificates, monitoringv1alpha1.MonitoredCertificateStatus{Name: c, Status: valid})
+			}
+			return m
+		}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(
+			monitor("monitoring", "prod", "internal-shop-web", "external-cp1-ca.crt"),
+			monitor("shop", "team", "internal-shop-web", "internal-shop-api"),
+		).Build()
+
+		certs, err := ListMonitoredCertificates(context.Background(), c)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, s := range certs {
+			names = append(names, s.Name)
+		}
+		Expect(names).To(Equal([]string{"external-cp1-ca.crt", "internal-shop-api", "internal-shop-web"}))
+	})
+})
@@ -4,10 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
 	"time"
 
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
 	"egarciam.com/checkcert/internal/email"
+	"egarciam.com/checkcert/internal/templates"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -23,29 +29,163 @@ func (r *CertificateMonitorReconciler) getRecipients(ctx context.Context) ([]str
 		return nil, err
 	}
 
-	var recipients []string
-	if err := json.Unmarshal([]byte(configMap.Data["emails"]), &recipients); err != nil {
+	var list []string
+	if err := json.Unmarshal([]byte(configMap.Data["emails"]), &list); err != nil {
 		log.Error(err, "unable to parse email recipients from ConfigMap")
 		return nil, err
 	}
+	recipients, invalid := parseRecipients(strings.Join(list, ","))
+	for _, addr := range invalid {
+		log.Error(nil, "ignoring invalid address in recipients ConfigMap", "address", addr)
+	}
 	return recipients, nil
 }
 
-// funcion para enviar los correos a la lista de recipients
-func (r *CertificateMonitorReconciler) sendMails(status, name string, expiry time.Time, recipients []string) error {
-	log := log.FromContext(context.Background())
-	log.Info(status, "certificate", "name", name, "expiry date", expiry.Format(time.RFC3339))
-	subject := fmt.Sprintf("Certificate %s is %s", name, status)
-	body := fmt.Sprintf("The certificate %s is %s on %s.", name, status, expiry.Format(time.RFC3339))
-	for _, recipient := range recipients {
-		// Send the email
-		// if err := email.SendMail(subject, body, recipient); err != nil {
-		if err := email.SendMail(subject, body, recipient); err != nil {
-			log.Error(err, "failed to send email", "recipient", recipient)
-			return err
-		} else {
-			log.Info("Email sent successfully", "recipient", recipient, "certificate", name)
-		}
-	}
-	return nil
+// ownerRecipients returns the valid addresses of the notify annotations on
+// the source of a certificate and on its namespace. Invalid addresses are
+// logged and skipped.
+func (r *CertificateMonitorReconciler) ownerRecipients(ctx context.Context, ch *channels, s monitoringv1alpha1.MonitoredCertificateStatus) ([]string, error) {
+	log := log.FromContext(ctx)
+	meta, err := r.source(ctx, ch, s)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{meta.annotations[monitoringv1alpha1.NotifyAnnotation]}
+	if s.Type == "internal" && s.Namespace != "" {
+		annotations, err := r.namespaceAnnotations(ctx, ch, s.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, annotations[monitoringv1alpha1.NotifyAnnotation])
+	}
+
+	var recipients []string
+	for _, v := range values {
+		valid, invalid := parseRecipients(v)
+		for _, addr := range invalid {
+			log.Error(nil, "ignoring invalid address in notify annotation", "certificate", s.Name, "address", addr)
+		}
+		recipients = mergeRecipients(recipients, valid)
+	}
+	return recipients, nil
+}
+
+// parseRecipients splits a comma separated list of addresses into the valid
+// bare addresses and the invalid entries.
+func parseRecipients(list string) (valid, invalid []string) {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(entry)
+		if err != nil {
+			invalid = append(invalid, entry)
+			continue
+		}
+		valid = append(valid, addr.Address)
+	}
+	return valid, invalid
+}
+
+// mergeRecipients appends the addresses of extra missing from recipients.
+func mergeRecipients(recipients, extra []string) []string {
+	for _, rcpt := range extra {
+		if !slices.Contains(recipients, rcpt) {
+			recipients = append(recipients, rcpt)
+		}
+	}
+	return recipients
+}
+
+// mailer carries what a scan needs to send notifications: the recipients,
+// the templates and an SMTP sender whose connection is reused for the whole
+// batch.
+type mailer struct {
+	sender     *email.Sender
+	recipients []string
+	templates  *templates.Set
+}
+
+// newMailer prepares the mail transport of a monitor. It returns nil when the
+// monitor does not send mail. Recipients are only read from the legacy
+// ConfigMap when the monitor has no notification policy.
+func (r *CertificateMonitorReconciler) newMailer(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (*mailer, error) {
+	if !certMonitor.Spec.SendMail {
+		return nil, nil
+	}
+	var recipients []string
+	if certMonitor.Spec.NotificationPolicy == "" {
+		// Owner annotations may be the only recipients, so the legacy
+		// ConfigMap is optional.
+		var err error
+		if recipients, err = r.getRecipients(ctx); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	tmpl, err := r.loadTemplates(ctx, certMonitor)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := r.smtpConfig(ctx, certMonitor)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := email.NewSender(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &mailer{sender: sender, recipients: recipients, templates: tmpl}, nil
+}
+
+// close ends the SMTP session opened by the batch.
+func (m *mailer) close() {
+	if m != nil {
+		_ = m.sender.Close()
+	}
+}
+
+// smtpConfig builds the SMTP transport from the ConfigMap and Secret the
+// monitor references. Secret keys override ConfigMap keys.
+func (r *CertificateMonitorReconciler) smtpConfig(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (email.Config, error) {
+	ref := certMonitor.Spec.SMTP
+	if ref == nil {
+		return email.DefaultConfig(), nil
+	}
+
+	data := map[string][]byte{}
+	if ref.ConfigMapName != "" {
+		var configMap corev1.ConfigMap
+		key := types.NamespacedName{Name: ref.ConfigMapName, Namespace: certMonitor.Namespace}
+		if err := r.Get(ctx, key, &configMap); err != nil {
+			return email.Config{}, fmt.Errorf("unable to fetch SMTP ConfigMap %s: %w", key, err)
+		}
+		for k, v := range configMap.Data {
+			data[k] = []byte(v)
+		}
+	}
+	if ref.SecretName != "" {
+		var secret corev1.Secret
+		key := types.NamespacedName{Name: ref.SecretName, Namespace: certMonitor.Namespace}
+		if err := r.fetchSecret(ctx, key, &secret); err != nil {
+			return email.Config{}, fmt.Errorf("unable to fetch SMTP Secret %s: %w", key, err)
+		}
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+	}
+	return email.ConfigFromData(data)
+}
+
+// alertData is the template view of an alert.
+func alertData(certMonitor *monitoringv1alpha1.CertificateMonitor, a alert, now time.Time) templates.Alert {
+	return templates.Alert{
+		Monitor:        certMonitor.Name,
+		Cluster:        clusterName(),
+		Thresholds:     thresholds(certMonitor),
+		Kind:           string(a.kind),
+		PreviousStatus: a.previousStatus,
+		Rotated:        a.rotated,
+		Certificate:    templateCert(a.cert, now),
+	}
 }
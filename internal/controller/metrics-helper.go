@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// certificateExpiryDays is the expiry metric of every monitored certificate,
+// node certificates included.
+var certificateExpiryDays = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "certificatemonitor_certificate_expiry_days",
+		Help: "Days until a monitored certificate expires, negative once expired",
+	},
+	[]string{"namespace", "monitor", "certificate", "certificate_namespace", "type", "owner"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(certificateExpiryDays)
+}
+
+// recordCertificateMetrics replaces the expiry series of a monitor with those
+// of its current certificates. Certificates of unknown expiry have none.
+func recordCertificateMetrics(certMonitor *monitoringv1alpha1.CertificateMonitor, statuses []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) {
+	forgetCertificateMetrics(certMonitor.Namespace, certMonitor.Name)
+	for _, s := range statuses {
+		expiry, err := time.Parse(time.RFC3339, s.Expiry)
+		if err != nil {
+			continue
+		}
+		certificateExpiryDays.WithLabelValues(certMonitor.Namespace, certMonitor.Name, s.Name, s.Namespace, s.Type, s.Owner).
+			Set(expiry.Sub(now).Hours() / 24)
+	}
+}
+
+// forgetCertificateMetrics drops the expiry series of a monitor.
+func forgetCertificateMetrics(namespace, name string) {
+	certificateExpiryDays.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "monitor": name})
+}
@@ -3,12 +3,22 @@ package controller
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+const (
+	// Node annotation prefixes written by the checker pods, see annotateNode.
+	nodeCertStatusPrefix = "cert-status-"
+	nodeCertExpiryPrefix = "cert-expiry-"
 )
 
 // createCertificateCheckerPod creates a Pod to check certificates on a specific node
@@ -125,3 +135,38 @@ func (r *CertificateMonitorReconciler) monitorPod(ctx context.Context, pod *core
 		}
 	}
 }
+
+// aggregateNodeReports turns the certificate annotations left by the checker
+// pods on each node into status entries, in node order. Reading annotations
+// is cheap, so the nodes are not spread over the worker pool.
+func aggregateNodeReports(nodes []corev1.Node) []monitoringv1alpha1.MonitoredCertificateStatus {
+	var certStatuses []monitoringv1alpha1.MonitoredCertificateStatus
+	for _, node := range nodes {
+		certStatuses = append(certStatuses, nodeReport(node)...)
+	}
+	return certStatuses
+}
+
+// nodeReport reads the cert-status-* and cert-expiry-* annotations of a node.
+func nodeReport(node corev1.Node) []monitoringv1alpha1.MonitoredCertificateStatus {
+	var files []string
+	for key := range node.Annotations {
+		if file, ok := strings.CutPrefix(key, nodeCertStatusPrefix); ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	certStatuses := make([]monitoringv1alpha1.MonitoredCertificateStatus, 0, len(files))
+	for _, file := range files {
+		certStatuses = append(certStatuses, monitoringv1alpha1.MonitoredCertificateStatus{
+			Name:   fmt.Sprintf("external-%s-%s", node.Name, file),
+			Type:   "external",
+			Path:   file,
+			Node:   node.Name,
+			Status: strings.ToLower(node.Annotations[nodeCertStatusPrefix+file]),
+			Expiry: node.Annotations[nodeCertExpiryPrefix+file],
+		})
+	}
+	return certStatuses
+}
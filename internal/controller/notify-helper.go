@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/notify"
+)
+
+// channels are the notification channels of a monitor for one batch: email,
+// which also handles digests, and the per-alert notifiers, along with the
+// policy routing alerts between them.
+type channels struct {
+	mail      *mailer
+	notifiers []notify.Notifier
+	policy    *monitoringv1alpha1.NotificationPolicy
+	// sources and namespaces cache the metadata routing looks at.
+	sources    map[string]sourceMeta
+	namespaces map[string]map[string]string
+}
+
+// newChannels sets up every channel the monitor configures. A channel that
+// cannot be set up is logged and left out. It returns nil when no channel is
+// available, or when the policy cannot be read: sending without it would
+// reach the wrong people.
+func (r *CertificateMonitorReconciler) newChannels(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) *channels {
+	log := log.FromContext(ctx)
+	policy, err := r.loadPolicy(ctx, certMonitor)
+	if err != nil {
+		log.Error(err, "Failed to load notification policy")
+		return nil
+	}
+	ch := &channels{policy: policy}
+
+	m, err := r.newMailer(ctx, certMonitor)
+	if err != nil {
+		log.Error(err, "Failed to set up email notifications")
+	}
+	ch.mail = m
+
+	spec := certMonitor.Spec
+	setups := []struct {
+		name       string
+		configured bool
+		setup      func() (notify.Notifier, error)
+	}{
+		{"webhook", spec.Webhook != nil, func() (notify.Notifier, error) { return r.newWebhook(ctx, certMonitor) }},
+		{"Slack", spec.Slack != nil, func() (notify.Notifier, error) {
+			url, err := r.secretValue(ctx, certMonitor, spec.Slack.SecretName, spec.Slack.Key, "url")
+			if err != nil {
+				return nil, err
+			}
+			return notify.NewSlack(url)
+		}},
+		{"Teams", spec.Teams != nil, func() (notify.Notifier, error) {
+			url, err := r.secretValue(ctx, certMonitor, spec.Teams.SecretName, spec.Teams.Key, "url")
+			if err != nil {
+				return nil, err
+			}
+			return notify.NewTeams(url)
+		}},
+		{"Alertmanager", spec.Alertmanager != nil, func() (notify.Notifier, error) { return r.newAlertmanager(ctx, certMonitor) }},
+		{"PagerDuty", spec.PagerDuty != nil, func() (notify.Notifier, error) {
+			routingKey, err := r.secretValue(ctx, certMonitor, spec.PagerDuty.SecretName, spec.PagerDuty.Key, "routingKey")
+			if err != nil {
+				return nil, err
+			}
+			return notify.NewPagerDuty(routingKey, spec.PagerDuty.URL)
+		}},
+	}
+	for _, s := range setups {
+		if !s.configured {
+			continue
+		}
+		n, err := s.setup()
+		if err != nil {
+			log.Error(err, fmt.Sprintf("Failed to set up %s notifications", s.name))
+			continue
+		}
+		ch.notifiers = append(ch.notifiers, n)
+	}
+
+	if ch.mail == nil && len(ch.notifiers) == 0 {
+		return nil
+	}
+	return ch
+}
+
+// close releases the resources held by the channels.
+func (c *channels) close() {
+	if c != nil {
+		c.mail.close()
+	}
+}
+
+// secretData returns the data of a Secret in the monitor namespace.
+func (r *CertificateMonitorReconciler) secretData(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, name string) (map[string][]byte, error) {
+	var secret corev1.Secret
+	key := types.NamespacedName{Name: name, Namespace: certMonitor.Namespace}
+	if err := r.fetchSecret(ctx, key, &secret); err != nil {
+		return nil, fmt.Errorf("unable to fetch Secret %s: %w", key, err)
+	}
+	return secret.Data, nil
+}
+
+// secretValue returns one key of a Secret in the monitor namespace, falling
+// back to defaultKey when dataKey is empty.
+func (r *CertificateMonitorReconciler) secretValue(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, name, dataKey, defaultKey string) (string, error) {
+	data, err := r.secretData(ctx, certMonitor, name)
+	if err != nil {
+		return "", err
+	}
+	if dataKey == "" {
+		dataKey = defaultKey
+	}
+	v, ok := data[dataKey]
+	if !ok {
+		return "", fmt.Errorf("Secret %s/%s has no key %q", certMonitor.Namespace, name, dataKey)
+	}
+	return strings.TrimSpace(string(v)), nil
+}
+
+// newWebhook builds the webhook notifier of a monitor, reading headers and
+// the signing key from the referenced Secret.
+func (r *CertificateMonitorReconciler) newWebhook(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (*notify.Webhook, error) {
+	spec := certMonitor.Spec.Webhook
+	var data map[string][]byte
+	if spec.SecretName != "" {
+		var err error
+		if data, err = r.secretData(ctx, certMonitor, spec.SecretName); err != nil {
+			return nil, err
+		}
+	}
+	return notify.NewWebhook(notify.WebhookConfigFromData(spec.URL, data))
+}
+
+// newAlertmanager builds the Alertmanager notifier of a monitor, reading
+// request headers from the referenced Secret.
+func (r *CertificateMonitorReconciler) newAlertmanager(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (*notify.Alertmanager, error) {
+	spec := certMonitor.Spec.Alertmanager
+	cfg := notify.AlertmanagerConfig{URL: spec.URL, Headers: map[string]string{}}
+	if spec.SecretName != "" {
+		data, err := r.secretData(ctx, certMonitor, spec.SecretName)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range data {
+			cfg.Headers[k] = string(v)
+		}
+	}
+	cfg.TTL = alertTTL(certMonitor, time.Now())
+	if spec.TTL != nil {
+		cfg.TTL = spec.TTL.Duration
+	}
+	return notify.NewAlertmanager(cfg)
+}
+
+// alertTTL is how long Alertmanager alerts last by default: until the third
+// next scan. Full scans send the firing alerts again, so they only end once
+// two scans in a row were missed.
+func alertTTL(certMonitor *monitoringv1alpha1.CertificateMonitor, now time.Time) time.Duration {
+	// An invalid schedule falls back to the scan interval.
+	sched, _ := scheduleFor(certMonitor)
+	end := now
+	for i := 0; i < 3; i++ {
+		end = sched.Next(end)
+	}
+	return end.Sub(now)
+}
+
+// notifyPayload is the channel-independent payload of an alert.
+func notifyPayload(certMonitor *monitoringv1alpha1.CertificateMonitor, a alert, now time.Time) notify.Alert {
+	return notify.Alert{
+		Kind:           string(a.kind),
+		Monitor:        certMonitor.Name,
+		Cluster:        clusterName(),
+		PreviousStatus: a.previousStatus,
+		Rotated:        a.rotated,
+		Timestamp:      now,
+		Certificate:    templateCert(a.cert, now),
+	}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"egarciam.com/checkcert/internal/config"
+)
+
+// defaultOwnerKeys are used when --owner-keys is not set.
+const defaultOwnerKeys = "owner,team"
+
+// ownerKeys are the label and annotation keys naming the owner of a
+// certificate, in order of preference.
+func ownerKeys() []string {
+	keys := defaultOwnerKeys
+	if config.OwnerKeys != nil {
+		keys = *config.OwnerKeys
+	}
+	var out []string
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// ownerOf returns the value of the first owner key set on an object, as a
+// label or else as an annotation.
+func ownerOf(keys []string, o metav1.Object) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(o.GetLabels()[k]); v != "" {
+			return v
+		}
+		if v := strings.TrimSpace(o.GetAnnotations()[k]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ownerResolver attributes secrets to owners. Owner references and
+// namespaces are looked up once per scan.
+type ownerResolver struct {
+	r          *CertificateMonitorReconciler
+	keys       []string
+	owners     map[types.UID]string
+	namespaces map[string]string
+}
+
+func (r *CertificateMonitorReconciler) newOwnerResolver() *ownerResolver {
+	return &ownerResolver{r: r, keys: ownerKeys(), owners: map[types.UID]string{}, namespaces: map[string]string{}}
+}
+
+// resolve returns the owner of a secret: from its own labels and annotations,
+// else from those of the objects owning it, else from its namespace. It is
+// empty when none of them names one.
+func (o *ownerResolver) resolve(ctx context.Context, secret metav1.Object) string {
+	if len(o.keys) == 0 {
+		return ""
+	}
+	if owner := ownerOf(o.keys, secret); owner != "" {
+		return owner
+	}
+	for _, ref := range secret.GetOwnerReferences() {
+		if owner := o.referenced(ctx, secret.GetNamespace(), ref); owner != "" {
+			return owner
+		}
+	}
+	return o.namespace(ctx, secret.GetNamespace())
+}
+
+// referenced returns the owner named by the object an owner reference points
+// to. The object is read as metadata from the API server; kinds the
+// controller may not read are skipped.
+func (o *ownerResolver) referenced(ctx context.Context, namespace string, ref metav1.OwnerReference) string {
+	if owner, ok := o.owners[ref.UID]; ok {
+		return owner
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return ""
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gv.WithKind(ref.Kind))
+	reader := client.Reader(o.r.Client)
+	if o.r.APIReader != nil {
+		reader = o.r.APIReader
+	}
+	owner := ""
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, obj); err == nil {
+		owner = ownerOf(o.keys, obj)
+	} else if !meta.IsNoMatchError(err) {
+		log.FromContext(ctx).V(1).Info("unable to read the owner of a secret", "kind", ref.Kind, "name", ref.Name, "namespace", namespace, "error", err.Error())
+	}
+	o.owners[ref.UID] = owner
+	return owner
+}
+
+// namespace returns the owner named by a namespace.
+func (o *ownerResolver) namespace(ctx context.Context, name string) string {
+	if owner, ok := o.namespaces[name]; ok {
+		return owner
+	}
+	ns := &corev1.Namespace{}
+	owner := ""
+	if err := o.r.Get(ctx, types.NamespacedName{Name: name}, ns); err == nil {
+		owner = ownerOf(o.keys, ns)
+	} else {
+		log.FromContext(ctx).V(1).Info("unable to read the namespace of a secret", "namespace", name, "error", err.Error())
+	}
+	o.namespaces[name] = owner
+	return owner
+}
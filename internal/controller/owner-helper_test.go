@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/config"
+)
+
+var _ = Describe("Owner resolution", func() {
+	var keys string
+	BeforeEach(func() {
+		keys = "team,example.com/owner"
+		config.OwnerKeys = &keys
+		DeferCleanup(func() { config.OwnerKeys = nil })
+	})
+
+	secret := func(name string, labels, annotations map[string]string, owners ...metav1.OwnerReference) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "shop", Name: name, Labels: labels, Annotations: annotations, OwnerReferences: owners,
+		}}
+	}
+
+	It("reads the secret, then its owners, then its namespace", func() {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"team": "shop-team"}}}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "shop", Name: "issuer", UID: "d1", Annotations: map[string]string{"example.com/owner": "pki-team"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(namespace, deployment).Build()
+		r := &CertificateMonitorReconciler{Client: c}
+		owners := r.newOwnerResolver()
+		ctx := context.Background()
+
+		Expect(owners.resolve(ctx, secret("web", map[string]string{"team": "web-team"}, nil))).To(Equal("web-team"))
+		Expect(owners.resolve(ctx, secret("api", nil, map[string]string{"example.com/owner": " api-team "}))).To(Equal("api-team"))
+		owned := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "issuer", UID: "d1"}
+		Expect(owners.resolve(ctx, secret("db", nil, nil, owned))).To(Equal("pki-team"))
+		gone := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "gone", UID: "d2"}
+		Expect(owners.resolve(ctx, secret("cache", nil, nil, gone))).To(Equal("shop-team"))
+
+		keys = ""
+		Expect(r.newOwnerResolver().resolve(ctx, secret("web", map[string]string{"team": "web-team"}, nil))).To(BeEmpty())
+	})
+
+	It("exports certificate expiry by owner", func() {
+		now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		monitor := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "owners"}}
+		recordCertificateMetrics(monitor, []monitoringv1alpha1.MonitoredCertificateStatus{
+			{Name: "internal-shop-web", Type: "internal", Namespace: "shop", Status: expiring, Expiry: "2024-06-11T12:00:00Z", Owner: "shop-team"},
+			{Name: "internal-shop-bad", Type: "internal", Namespace: "shop", Status: "error"},
+		}, now)
+		gauge := certificateExpiryDays.WithLabelValues("monitoring", "owners", "internal-shop-web", "shop", "internal", "shop-team")
+		Expect(testutil.ToFloat64(gauge)).To(Equal(10.0))
+
+		forgetCertificateMetrics("monitoring", "owners")
+		Expect(certificateExpiryDays.DeleteLabelValues("monitoring", "owners", "internal-shop-web", "shop", "internal", "shop-team")).To(BeFalse())
+	})
+})
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// destination is where the alerts of one certificate go.
+type destination struct {
+	channels   map[monitoringv1alpha1.NotificationChannel]bool
+	recipients []string
+}
+
+// deliverable reports whether any channel available in the batch receives
+// the alerts of the destination.
+func (c *channels) deliverable(d destination) bool {
+	if c.mail != nil && d.has(monitoringv1alpha1.ChannelEmail) && len(d.recipients) > 0 {
+		return true
+	}
+	for _, n := range c.notifiers {
+		if d.has(monitoringv1alpha1.NotificationChannel(n.Name())) {
+			return true
+		}
+	}
+	return false
+}
+
+// has reports whether the destination includes a channel.
+func (d destination) has(c monitoringv1alpha1.NotificationChannel) bool {
+	return d.channels[c]
+}
+
+// allChannels is the destination used without a policy: every configured
+// channel, and the legacy recipients for email.
+func allChannels(recipients []string) destination {
+	return destination{
+		channels: map[monitoringv1alpha1.NotificationChannel]bool{
+			monitoringv1alpha1.ChannelEmail:        true,
+			monitoringv1alpha1.ChannelWebhook:      true,
+			monitoringv1alpha1.ChannelSlack:        true,
+			monitoringv1alpha1.ChannelTeams:        true,
+			monitoringv1alpha1.ChannelAlertmanager: true,
+			monitoringv1alpha1.ChannelPagerDuty:    true,
+		},
+		recipients: recipients,
+	}
+}
+
+// loadPolicy fetches the NotificationPolicy a monitor references, if any.
+func (r *CertificateMonitorReconciler) loadPolicy(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (*monitoringv1alpha1.NotificationPolicy, error) {
+	if certMonitor.Spec.NotificationPolicy == "" {
+		return nil, nil
+	}
+	policy := &monitoringv1alpha1.NotificationPolicy{}
+	key := types.NamespacedName{Name: certMonitor.Spec.NotificationPolicy, Namespace: certMonitor.Namespace}
+	if err := r.Get(ctx, key, policy); err != nil {
+		return nil, fmt.Errorf("unable to fetch NotificationPolicy %s: %w", key, err)
+	}
+	return policy, nil
+}
+
+// route resolves the destination of a certificate alerting with the given
+// severity: the policy routes, or every channel without a policy, plus the
+// owners named by the notify annotations, who are always mailed.
+func (r *CertificateMonitorReconciler) route(ctx context.Context, ch *channels, s monitoringv1alpha1.MonitoredCertificateStatus, severity string) (destination, error) {
+	dest, err := r.policyRoute(ctx, ch, s, severity)
+	if err != nil {
+		return destination{}, err
+	}
+	owners, err := r.ownerRecipients(ctx, ch, s)
+	if err != nil {
+		return destination{}, err
+	}
+	if len(owners) > 0 {
+		dest.channels[monitoringv1alpha1.ChannelEmail] = true
+		dest.recipients = mergeRecipients(dest.recipients, owners)
+	}
+	return dest, nil
+}
+
+// policyRoute resolves the destination given by the policy of the monitor.
+func (r *CertificateMonitorReconciler) policyRoute(ctx context.Context, ch *channels, s monitoringv1alpha1.MonitoredCertificateStatus, severity string) (destination, error) {
+	log := log.FromContext(ctx)
+	if ch.policy == nil {
+		var recipients []string
+		if ch.mail != nil {
+			recipients = ch.mail.recipients
+		}
+		return allChannels(recipients), nil
+	}
+
+	dest := destination{channels: map[monitoringv1alpha1.NotificationChannel]bool{}}
+	for _, route := range ch.policy.Spec.Routes {
+		ok, err := r.matches(ctx, ch, route.Match, s, severity)
+		if err != nil {
+			return destination{}, fmt.Errorf("NotificationPolicy %s: %w", ch.policy.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		for _, c := range route.Channels {
+			dest.channels[c] = true
+		}
+		valid, invalid := parseRecipients(strings.Join(route.Recipients, ","))
+		for _, addr := range invalid {
+			log.Error(nil, "ignoring invalid address in notification policy", "policy", ch.policy.Name, "address", addr)
+		}
+		dest.recipients = mergeRecipients(dest.recipients, valid)
+		if !route.Continue {
+			break
+		}
+	}
+	return dest, nil
+}
+
+// matches reports whether a certificate satisfies every criterion of a match.
+// Labels are only looked up when the match has a selector.
+func (r *CertificateMonitorReconciler) matches(ctx context.Context, ch *channels, m monitoringv1alpha1.NotificationMatch, s monitoringv1alpha1.MonitoredCertificateStatus, severity string) (bool, error) {
+	if len(m.Severities) > 0 && !slices.Contains(m.Severities, severity) {
+		return false, nil
+	}
+	if len(m.Namespaces) > 0 && !slices.Contains(m.Namespaces, s.Namespace) {
+		return false, nil
+	}
+	if len(m.Types) > 0 && !slices.Contains(m.Types, s.Type) {
+		return false, nil
+	}
+	if len(m.Owners) > 0 && !slices.Contains(m.Owners, s.Owner) {
+		return false, nil
+	}
+	if m.Selector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(m.Selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid selector: %w", err)
+	}
+	meta, err := r.source(ctx, ch, s)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(meta.labels), nil
+}
+
+// sourceMeta is the metadata of the object holding a certificate.
+type sourceMeta struct {
+	labels      labels.Set
+	annotations map[string]string
+}
+
+// source returns the metadata of the object holding a certificate: the
+// Secret of an internal certificate or the Node of an external one. A source
+// that is gone has no metadata. Results are cached for the batch.
+func (r *CertificateMonitorReconciler) source(ctx context.Context, ch *channels, s monitoringv1alpha1.MonitoredCertificateStatus) (sourceMeta, error) {
+	if meta, ok := ch.sources[s.Name]; ok {
+		return meta, nil
+	}
+
+	obj, err := r.sourceObject(ctx, s)
+	if err != nil {
+		return sourceMeta{}, err
+	}
+	var meta sourceMeta
+	if obj != nil {
+		meta = sourceMeta{labels: obj.GetLabels(), annotations: obj.GetAnnotations()}
+	}
+
+	if ch.sources == nil {
+		ch.sources = map[string]sourceMeta{}
+	}
+	ch.sources[s.Name] = meta
+	return meta, nil
+}
+
+// sourceObject fetches the object holding a certificate, as its metadata only
+// when secrets are cached that way. It returns nil when the certificate has no
+// source in the cluster or the source is gone.
+func (r *CertificateMonitorReconciler) sourceObject(ctx context.Context, s monitoringv1alpha1.MonitoredCertificateStatus) (client.Object, error) {
+	var obj client.Object
+	var key types.NamespacedName
+	switch s.Type {
+	case "internal":
+		namespace, name, _ := strings.Cut(s.Path, "/")
+		key = types.NamespacedName{Namespace: namespace, Name: name}
+		if r.MetadataOnlySecrets {
+			partial := &metav1.PartialObjectMetadata{}
+			partial.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+			obj = partial
+		} else {
+			obj = &corev1.Secret{}
+		}
+	case "external":
+		key = types.NamespacedName{Name: s.Node}
+		obj = &corev1.Node{}
+	default:
+		return nil, nil
+	}
+
+	if err := r.Get(ctx, key, obj); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return obj, nil
+}
+
+// namespaceAnnotations returns the annotations of a namespace, cached for the
+// batch. A namespace that is gone has none.
+func (r *CertificateMonitorReconciler) namespaceAnnotations(ctx context.Context, ch *channels, name string) (map[string]string, error) {
+	if annotations, ok := ch.namespaces[name]; ok {
+		return annotations, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, ns); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if ch.namespaces == nil {
+		ch.namespaces = map[string]map[string]string{}
+	}
+	ch.namespaces[name] = ns.Annotations
+	return ns.Annotations, nil
+}
+
+// alertSeverity is the severity an alert is routed by: its status, or for a
+// resolved alert the status it resolves.
+func alertSeverity(s monitoringv1alpha1.MonitoredCertificateStatus) string {
+	if !isAlerting(s.Status) && isAlerting(s.LastNotifiedStatus) {
+		return s.LastNotifiedStatus
+	}
+	return s.Status
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var _ = Describe("Notification policy", func() {
+	ctx := context.Background()
+
+	policy := &monitoringv1alpha1.NotificationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "routing"},
+		Spec: monitoringv1alpha1.NotificationPolicySpec{Routes: []monitoringv1alpha1.NotificationRoute{
+			{
+				Match:    monitoringv1alpha1.NotificationMatch{Severities: []string{critical, expired}},
+				Channels: []monitoringv1alpha1.NotificationChannel{monitoringv1alpha1.ChannelPagerDuty},
+				Continue: true,
+			},
+			{
+				Match: monitoringv1alpha1.NotificationMatch{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "shop"}},
+				},
+				Channels:   []monitoringv1alpha1.NotificationChannel{monitoringv1alpha1.ChannelEmail},
+				Recipients: []string{"shop@example.com"},
+			},
+			{
+				Match:      monitoringv1alpha1.NotificationMatch{Types: []string{"external"}},
+				Channels:   []monitoringv1alpha1.NotificationChannel{monitoringv1alpha1.ChannelSlack},
+				Recipients: []string{"platform@example.com"},
+			},
+		}},
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Labels: map[string]string{"team": "shop"}}}
+	r := &CertificateMonitorReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()}
+
+	internalEntry := func(status string) monitoringv1alpha1.MonitoredCertificateStatus {
+		return monitoringv1alpha1.MonitoredCertificateStatus{Name: "internal-shop-web", Type: "internal", Path: "shop/web", Namespace: "shop", Status: status}
+	}
+
+	It("sends every alert everywhere without a policy", func() {
+		dest, err := r.route(ctx, &channels{mail: &mailer{recipients: []string{"admin@example.com"}}}, internalEntry(expiring), expiring)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dest.has(monitoringv1alpha1.ChannelSlack)).To(BeTrue())
+		Expect(dest.recipients).To(Equal([]string{"admin@example.com"}))
+	})
+
+	It("continues past matching routes that ask for it", func() {
+		dest, err := r.route(ctx, &channels{policy: policy}, internalEntry(critical), critical)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dest.has(monitoringv1alpha1.ChannelPagerDuty)).To(BeTrue())
+		Expect(dest.has(monitoringv1alpha1.ChannelEmail)).To(BeTrue())
+		Expect(dest.recipients).To(Equal([]string{"shop@example.com"}))
+	})
+
+	It("stops at the first matching route", func() {
+		dest, err := r.route(ctx, &channels{policy: policy}, internalEntry(expiring), expiring)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dest.has(monitoringv1alpha1.ChannelPagerDuty)).To(BeFalse())
+		Expect(dest.has(monitoringv1alpha1.ChannelSlack)).To(BeFalse())
+	})
+
+	It("routes by source type", func() {
+		entry := monitoringv1alpha1.MonitoredCertificateStatus{Name: "external-cp-1-apiserver.crt", Type: "external", Node: "cp-1", Status: expiring}
+		dest, err := r.route(ctx, &channels{policy: policy}, entry, expiring)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dest.has(monitoringv1alpha1.ChannelSlack)).To(BeTrue())
+	})
+
+	It("routes by owner", func() {
+		match := monitoringv1alpha1.NotificationMatch{Owners: []string{"shop-team"}}
+		entry := internalEntry(expiring)
+		ok, err := r.matches(ctx, &channels{}, match, entry, expiring)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		entry.Owner = "shop-team"
+		ok, err = r.matches(ctx, &channels{}, match, entry, expiring)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+	})
+
+	It("routes resolved alerts by the severity they resolve", func() {
+		entry := internalEntry(valid)
+		entry.LastNotifiedStatus = expired
+		Expect(alertSeverity(entry)).To(Equal(expired))
+	})
+
+	Describe("owner annotations", func() {
+		annotated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: "web", Namespace: "shop",
+			Annotations: map[string]string{monitoringv1alpha1.NotifyAnnotation: "Shop Team <team@example.com>, not-an-address"},
+		}}
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "shop",
+			Annotations: map[string]string{monitoringv1alpha1.NotifyAnnotation: "oncall@example.com,team@example.com"},
+		}}
+		owned := &CertificateMonitorReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(annotated, ns).Build()}
+
+		It("merges the secret and namespace owners with the global list", func() {
+			dest, err := owned.route(ctx, &channels{mail: &mailer{recipients: []string{"admin@example.com"}}}, internalEntry(expiring), expiring)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dest.recipients).To(Equal([]string{"admin@example.com", "team@example.com", "oncall@example.com"}))
+		})
+
+		It("mails owners even when no route matches", func() {
+			ch := &channels{policy: &monitoringv1alpha1.NotificationPolicy{}}
+			dest, err := owned.route(ctx, ch, internalEntry(expiring), expiring)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dest.has(monitoringv1alpha1.ChannelEmail)).To(BeTrue())
+			Expect(dest.recipients).To(ConsistOf("team@example.com", "oncall@example.com"))
+		})
+
+		It("separates invalid addresses", func() {
+			valid, invalid := parseRecipients(" a@example.com, ,B <b@example.com>,nope")
+			Expect(valid).To(Equal([]string{"a@example.com", "b@example.com"}))
+			Expect(invalid).To(Equal([]string{"nope"}))
+		})
+	})
+
+	Describe("unroutable certificates", func() {
+		ch := func() *channels {
+			return &channels{
+				mail:   &mailer{},
+				policy: &monitoringv1alpha1.NotificationPolicy{Spec: policy.Spec},
+			}
+		}
+
+		It("reports alerting certificates nobody receives", func() {
+			// Email is the only channel: the critical route to PagerDuty and the
+			// external route to Slack reach nobody.
+			external := monitoringv1alpha1.MonitoredCertificateStatus{Name: "external-cp-1-apiserver.crt", Type: "external", Node: "cp-1", Status: expiring}
+			current := []monitoringv1alpha1.MonitoredCertificateStatus{internalEntry(expiring), external, {Name: "internal-shop-ok", Type: "internal", Path: "shop/ok", Namespace: "shop", Status: valid}}
+			Expect(r.unroutable(ctx, ch(), current, time.Now())).To(Equal([]string{"external-cp-1-apiserver.crt"}))
+		})
+
+		It("reports nothing when notifications are off", func() {
+			Expect(r.unroutable(ctx, nil, []monitoringv1alpha1.MonitoredCertificateStatus{internalEntry(expired)}, time.Now())).To(BeEmpty())
+		})
+	})
+})
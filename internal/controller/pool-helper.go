@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"time"
+
+	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/workerpool"
+)
+
+const (
+	defaultScanWorkers   = 8
+	defaultTargetTimeout = 10 * time.Second
+	defaultScanTimeout   = 5 * time.Minute
+)
+
+// poolOptions returns the worker pool settings from the manager flags. The
+// scan deadline is applied to the reconcile context instead, see scanTimeout.
+func poolOptions() workerpool.Options {
+	opts := workerpool.Options{Parallelism: defaultScanWorkers, TaskTimeout: defaultTargetTimeout}
+	if config.ScanWorkers != nil && *config.ScanWorkers > 0 {
+		opts.Parallelism = *config.ScanWorkers
+	}
+	if config.TargetTimeout != nil && *config.TargetTimeout > 0 {
+		opts.TaskTimeout = *config.TargetTimeout
+	}
+	return opts
+}
+
+// scanTimeout is the deadline of a complete scan.
+func scanTimeout() time.Duration {
+	if config.ScanTimeout != nil && *config.ScanTimeout > 0 {
+		return *config.ScanTimeout
+	}
+	return defaultScanTimeout
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/workerpool"
+)
+
+// probeError is the status of an endpoint that could not be probed.
+const probeError string = "error"
+
+// discoverEndpointCerts probes the serving certificate of every endpoint
+// through the worker pool. Unreachable endpoints are reported with an error
+// status instead of being dropped.
+func (r *CertificateMonitorReconciler) discoverEndpointCerts(ctx context.Context, endpoints []string) []monitoringv1alpha1.MonitoredCertificateStatus {
+	log := log.FromContext(ctx)
+	results := workerpool.Run(ctx, poolOptions(), len(endpoints), func(ctx context.Context, i int) (*x509.Certificate, error) {
+		return probeEndpoint(ctx, endpoints[i])
+	})
+
+	certStatuses := make([]monitoringv1alpha1.MonitoredCertificateStatus, 0, len(endpoints))
+	for i, res := range results {
+		certStatus := monitoringv1alpha1.MonitoredCertificateStatus{
+			Name: "endpoint-" + endpoints[i],
+			Type: "endpoint",
+			Path: endpoints[i],
+		}
+		if res.Err != nil {
+			log.Error(res.Err, "failed to probe endpoint", "endpoint", endpoints[i])
+			certStatus.Status = probeError
+		} else {
+			certStatus.Status = certeval.Status(res.Value.NotAfter)
+			certStatus.Expiry = res.Value.NotAfter.Format(time.RFC3339)
+			certeval.SetDetails(&certStatus, res.Value)
+		}
+		certStatuses = append(certStatuses, certStatus)
+	}
+	return certStatuses
+}
+
+// probeEndpoint dials an HTTPS endpoint and returns its leaf certificate.
+// Verification is skipped on purpose: expired or self-signed certificates
+// have to be reported, not rejected.
+func probeEndpoint(ctx context.Context, endpoint string) (*x509.Certificate, error) {
+	addr, serverName, err := endpointAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}} //nolint:gosec
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("endpoint %s presented no certificate", endpoint)
+	}
+	return certs[0], nil
+}
+
+// endpointAddress turns "https://host[:port]/path" or "host[:port]" into a
+// dial address and the TLS server name.
+func endpointAddress(endpoint string) (string, string, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", "", fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	return net.JoinHostPort(host, port), host, nil
+}
@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/email"
+	"egarciam.com/checkcert/internal/notify"
+	"egarciam.com/checkcert/internal/queue"
+	"egarciam.com/checkcert/internal/templates"
+)
+
+const (
+	// queueKey is the ConfigMap key holding the serialized queue.
+	queueKey = "queue.json"
+	// rateLimitWindow is the window of the per-channel rate limits.
+	rateLimitWindow = time.Minute
+	// maxQueuedMessages bounds the queue of a monitor, keeping its ConfigMap
+	// well below the 1 MiB object size limit.
+	maxQueuedMessages = 200
+
+	defaultNotificationRateLimits = "email=60,webhook=60,slack=60,teams=60,alertmanager=120,pagerduty=60"
+)
+
+var (
+	notificationsQueued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "certificatemonitor_notifications_queued",
+			Help: "Notifications waiting for delivery or retry",
+		},
+		[]string{"namespace", "monitor", "channel"},
+	)
+	notificationsFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "certificatemonitor_notifications_failed_total",
+			Help: "Failed notification delivery attempts",
+		},
+		[]string{"channel"},
+	)
+	notificationsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "certificatemonitor_notifications_dropped_total",
+			Help: "Notifications given up after exhausting their retries",
+		},
+		[]string{"channel"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(notificationsQueued, notificationsFailed, notificationsDropped)
+}
+
+// newLimiter builds the per-channel rate limiter from the manager flags.
+func newLimiter() (*queue.Limiter, error) {
+	spec := defaultNotificationRateLimits
+	if config.NotificationRateLimits != nil {
+		spec = *config.NotificationRateLimits
+	}
+	limits, err := queue.ParseLimits(spec)
+	if err != nil {
+		return nil, err
+	}
+	return queue.NewLimiter(rateLimitWindow, limits), nil
+}
+
+// queuePolicy returns the retry policy from the manager flags.
+func queuePolicy() queue.Policy {
+	p := queue.DefaultPolicy()
+	if config.NotificationMaxAttempts != nil && *config.NotificationMaxAttempts > 0 {
+		p.MaxAttempts = *config.NotificationMaxAttempts
+	}
+	return p
+}
+
+// queueName is the ConfigMap persisting the notification queue of a monitor.
+func queueName(certMonitor *monitoringv1alpha1.CertificateMonitor) string {
+	return certMonitor.Name + "-notifications"
+}
+
+// loadQueue reads the notification queue of a monitor, bypassing the cache so
+// a message delivered by the previous reconcile is never sent twice. The
+// ConfigMap is nil when the monitor has no queue yet.
+func (r *CertificateMonitorReconciler) loadQueue(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (*queue.Queue, *corev1.ConfigMap, error) {
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: queueName(certMonitor), Namespace: certMonitor.Namespace}
+	if err := reader.Get(ctx, key, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return &queue.Queue{}, nil, nil
+		}
+		return nil, nil, fmt.Errorf("unable to fetch notification queue %s: %w", key, err)
+	}
+	q, err := queue.Decode([]byte(cm.Data[queueKey]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ConfigMap %s: %w", key, err)
+	}
+	return q, cm, nil
+}
+
+// saveQueue persists the queue, creating its ConfigMap, owned by the monitor,
+// on first use. The oldest messages are dropped past maxQueuedMessages.
+func (r *CertificateMonitorReconciler) saveQueue(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, cm *corev1.ConfigMap, q *queue.Queue) error {
+	log := log.FromContext(ctx)
+	for _, m := range q.Trim(maxQueuedMessages) {
+		notificationsDropped.WithLabelValues(m.Channel).Inc()
+		log.Error(nil, "notification dropped, the queue is full", "channel", m.Channel, "recipient", m.Recipient, "id", m.ID)
+	}
+	setQueuedMetric(certMonitor, q)
+	if cm == nil && q.Len() == 0 {
+		return nil
+	}
+	data, err := q.Encode()
+	if err != nil {
+		return err
+	}
+	if cm == nil {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:            queueName(certMonitor),
+			Namespace:       certMonitor.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(certMonitor, monitoringv1alpha1.GroupVersion.WithKind("CertificateMonitor"))},
+		}}
+		cm.Data = map[string]string{queueKey: string(data)}
+		return r.Create(ctx, cm)
+	}
+	cm.Data = map[string]string{queueKey: string(data)}
+	return r.Update(ctx, cm)
+}
+
+// setQueuedMetric publishes the queue length of a monitor per channel.
+func setQueuedMetric(certMonitor *monitoringv1alpha1.CertificateMonitor, q *queue.Queue) {
+	notificationsQueued.DeletePartialMatch(prometheus.Labels{"namespace": certMonitor.Namespace, "monitor": certMonitor.Name})
+	for channel, n := range q.Counts() {
+		notificationsQueued.WithLabelValues(certMonitor.Namespace, certMonitor.Name, channel).Set(float64(n))
+	}
+}
+
+// mailPayload is the queued content of an email.
+type mailPayload struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// enqueueMail queues one mail per recipient and returns the message IDs.
+// about tells apart the mails of one recipient, e.g. the certificate name.
+func enqueueMail(q *queue.Queue, recipients []string, about string, msg templates.Message, now time.Time) ([]string, error) {
+	payload, err := json.Marshal(mailPayload{Subject: msg.Subject, Text: msg.Text, HTML: msg.HTML})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(recipients))
+	for _, rcpt := range recipients {
+		id := fmt.Sprintf("%s/%s/%s", monitoringv1alpha1.ChannelEmail, rcpt, about)
+		q.Add(queue.Message{ID: id, Channel: string(monitoringv1alpha1.ChannelEmail), Recipient: rcpt, Payload: payload}, now)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// enqueueNotification queues an alert for a notifier and returns the message
+// ID. about tells apart the alerts of one channel; a positive maxAttempts
+// overrides the queue policy.
+func enqueueNotification(q *queue.Queue, channel, about string, a notify.Alert, maxAttempts int, now time.Time) (string, error) {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("%s/%s", channel, about)
+	q.Add(queue.Message{ID: id, Channel: channel, Payload: payload, MaxAttempts: maxAttempts}, now)
+	return id, nil
+}
+
+// maxAttempts returns the delivery attempts a monitor sets for a channel,
+// zero to use the queue policy. Only webhooks set their own.
+func maxAttempts(certMonitor *monitoringv1alpha1.CertificateMonitor, channel string) int {
+	wh := certMonitor.Spec.Webhook
+	if channel != string(monitoringv1alpha1.ChannelWebhook) || wh == nil || wh.MaxRetries == nil {
+		return 0
+	}
+	return int(*wh.MaxRetries) + 1
+}
+
+// send delivers one queued message on its channel.
+func (c *channels) send(ctx context.Context, m queue.Message) error {
+	if m.Channel == string(monitoringv1alpha1.ChannelEmail) {
+		if c.mail == nil {
+			return fmt.Errorf("email is not configured")
+		}
+		var p mailPayload
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return err
+		}
+		return c.mail.sender.SendMessage(email.Message{To: m.Recipient, Subject: p.Subject, Text: p.Text, HTML: p.HTML})
+	}
+	for _, n := range c.notifiers {
+		if n.Name() != m.Channel {
+			continue
+		}
+		var a notify.Alert
+		if err := json.Unmarshal(m.Payload, &a); err != nil {
+			return err
+		}
+		err := n.Notify(ctx, a)
+		if errors.Is(err, notify.ErrRejected) {
+			return queue.Permanent(err)
+		}
+		return err
+	}
+	return fmt.Errorf("channel %s is not configured", m.Channel)
+}
+
+// deliver sends the due messages of the queue and returns when the next one
+// is due.
+func (r *CertificateMonitorReconciler) deliver(ctx context.Context, ch *channels, q *queue.Queue, now time.Time) time.Time {
+	log := log.FromContext(ctx)
+	out := q.Deliver(now, queuePolicy(), r.limiter, func(m queue.Message) error { return ch.send(ctx, m) })
+	for _, m := range out.Sent {
+		log.Info("Notification sent", "channel", m.Channel, "recipient", m.Recipient, "id", m.ID)
+	}
+	for _, m := range out.Failed {
+		notificationsFailed.WithLabelValues(m.Channel).Inc()
+		log.Error(fmt.Errorf("%s", m.LastError), "notification failed, will retry", "channel", m.Channel, "recipient", m.Recipient, "id", m.ID, "attempts", m.Attempts, "nextAttempt", m.NextAttempt)
+	}
+	for _, m := range out.Dropped {
+		notificationsFailed.WithLabelValues(m.Channel).Inc()
+		notificationsDropped.WithLabelValues(m.Channel).Inc()
+		if m.Channel == string(monitoringv1alpha1.ChannelEmail) {
+			log.Error(fmt.Errorf("%s", m.LastError), "notification dropped", "channel", m.Channel, "recipient", m.Recipient, "id", m.ID, "attempts", m.Attempts)
+			continue
+		}
+		// The payload is logged so the alert can be replayed by hand.
+		log.WithName("dead-letter").Error(fmt.Errorf("%s", m.LastError), "notification dropped", "channel", m.Channel, "id", m.ID, "attempts", m.Attempts, "payload", string(m.Payload))
+	}
+	return out.Next
+}
+
+// flushQueue delivers the queued messages of a monitor that are due, outside
+// of a scan, and returns when the next one is due. When the queue or the
+// channels cannot be read, it is tried again after the retry backoff.
+func (r *CertificateMonitorReconciler) flushQueue(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, now time.Time) time.Time {
+	log := log.FromContext(ctx)
+	q, cm, err := r.loadQueue(ctx, certMonitor)
+	if err != nil {
+		log.Error(err, "failed to load notification queue")
+		return now.Add(queuePolicy().Backoff)
+	}
+	if next := q.Next(); next.IsZero() || next.After(now) {
+		return next
+	}
+
+	ch := r.newChannels(ctx, certMonitor)
+	if ch == nil {
+		return now.Add(queuePolicy().Backoff)
+	}
+	defer ch.close()
+	next := r.deliver(ctx, ch, q, now)
+	if err := r.saveQueue(ctx, certMonitor, cm, q); err != nil {
+		log.Error(err, "failed to save notification queue")
+	}
+	return next
+}
+
+// requeueAfter is the delay until the next scan, or until the next queued
+// notification or alert is due when that comes first.
+func requeueAfter(now, nextScan, retry time.Time) time.Duration {
+	if !retry.IsZero() && retry.Before(nextScan) {
+		if retry.Before(now) {
+			return time.Second
+		}
+		return retry.Sub(now)
+	}
+	return nextScan.Sub(now)
+}
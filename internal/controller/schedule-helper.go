@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"time"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/schedule"
+)
+
+// defaultScanInterval is used when neither the monitor nor the
+// --check-interval-minutes flag provide a schedule.
+const defaultScanInterval = 7 * 24 * time.Hour
+
+// scanInterval returns the manager-wide default interval between scans.
+func scanInterval() time.Duration {
+	if config.DefaultCheckIntervalMinutes != nil && *config.DefaultCheckIntervalMinutes > 0 {
+		return time.Duration(*config.DefaultCheckIntervalMinutes) * time.Minute
+	}
+	return defaultScanInterval
+}
+
+// scheduleFor parses the monitor schedule. On error the default interval is
+// returned together with the error so the caller can keep scanning.
+func scheduleFor(certMonitor *monitoringv1alpha1.CertificateMonitor) (schedule.Schedule, error) {
+	s, err := schedule.Parse(certMonitor.Spec.Schedule, scanInterval())
+	if err != nil {
+		return schedule.Interval(scanInterval()), err
+	}
+	return s, nil
+}
+
+// rescanRequested reports whether the monitor carries the force-rescan annotation.
+func rescanRequested(certMonitor *monitoringv1alpha1.CertificateMonitor) bool {
+	_, ok := certMonitor.Annotations[monitoringv1alpha1.RescanAnnotation]
+	return ok
+}
+
+// scanDue reports whether a full scan has to run now: the monitor was never
+// scanned, its spec changed since the last scan, or the next scan time passed.
+func scanDue(certMonitor *monitoringv1alpha1.CertificateMonitor, now time.Time) bool {
+	status := certMonitor.Status
+	if status.LastScanTime == nil || status.NextScanTime == nil {
+		return true
+	}
+	if status.ObservedGeneration != certMonitor.Generation {
+		return true
+	}
+	return !now.Before(status.NextScanTime.Time)
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/workerpool"
+)
+
+const (
+	// bulkLoadThreshold is the number of uncached secrets above which a
+	// metadata-only scan lists the TLS secrets instead of fetching each one.
+	bulkLoadThreshold = 20
+	// secretPageSize is the page size of that list.
+	secretPageSize = 500
+)
+
+// internalCert is a TLS secret together with its parsed certificate.
+type internalCert struct {
+	key       types.NamespacedName
+	cert      *x509.Certificate
+	err       error
+	managedBy string
+	// meta is the metadata of the secret, used to resolve its owner.
+	meta metav1.Object
+}
+
+// listInternalCerts returns the certificate of every kubernetes.io/tls secret
+// in the cluster, using the parsed-certificate cache where possible.
+func (r *CertificateMonitorReconciler) listInternalCerts(ctx context.Context) ([]internalCert, error) {
+	if r.MetadataOnlySecrets {
+		return r.listInternalCertsLazily(ctx)
+	}
+
+	secretList := &corev1.SecretList{}
+	if err := r.List(ctx, secretList, client.MatchingFields{"type": string(corev1.SecretTypeTLS)}); err != nil {
+		return nil, err
+	}
+
+	results := workerpool.Run(ctx, poolOptions(), len(secretList.Items), func(_ context.Context, i int) (internalCert, error) {
+		secret := &secretList.Items[i]
+		cert, err := r.certs.get(secret)
+		return internalCert{key: client.ObjectKeyFromObject(secret), cert: cert, err: err, managedBy: certeval.ManagedBy(secret.Annotations), meta: secret}, nil
+	})
+
+	certs := make([]internalCert, 0, len(secretList.Items))
+	seen := make(map[types.UID]struct{}, len(secretList.Items))
+	for i, res := range results {
+		secret := &secretList.Items[i]
+		seen[secret.UID] = struct{}{}
+		if res.Err != nil {
+			res.Value = internalCert{key: client.ObjectKeyFromObject(secret), err: res.Err}
+		}
+		certs = append(certs, res.Value)
+	}
+	r.certs.retain(seen)
+	return certs, nil
+}
+
+// listInternalCertsLazily lists secret metadata from the cache and fetches the
+// full secret from the API server only when its resourceVersion changed since
+// it was last seen. Secret data is never kept in the informer cache.
+func (r *CertificateMonitorReconciler) listInternalCertsLazily(ctx context.Context) ([]internalCert, error) {
+	log := log.FromContext(ctx)
+	metaList := &metav1.PartialObjectMetadataList{}
+	metaList.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("SecretList"))
+	if err := r.List(ctx, metaList); err != nil {
+		return nil, err
+	}
+
+	// On the first scan, or after many changes, listing the TLS secrets in
+	// pages is far cheaper than fetching every secret one by one.
+	var misses []*metav1.PartialObjectMetadata
+	for i := range metaList.Items {
+		m := &metaList.Items[i]
+		if _, ok := r.certs.lookup(m.UID, m.ResourceVersion); !ok {
+			misses = append(misses, m)
+		}
+	}
+	if len(misses) > bulkLoadThreshold {
+		if err := r.loadCerts(ctx, misses); err != nil {
+			log.Error(err, "failed to list TLS secrets, fetching them one by one")
+		}
+	}
+
+	results := workerpool.Run(ctx, poolOptions(), len(metaList.Items), func(ctx context.Context, i int) (cachedCert, error) {
+		m := &metaList.Items[i]
+		if entry, ok := r.certs.lookup(m.UID, m.ResourceVersion); ok {
+			return entry, nil
+		}
+		return r.loadCert(ctx, client.ObjectKeyFromObject(m))
+	})
+
+	var certs []internalCert
+	seen := make(map[types.UID]struct{}, len(metaList.Items))
+	for i, res := range results {
+		m := &metaList.Items[i]
+		seen[m.UID] = struct{}{}
+		key := client.ObjectKeyFromObject(m)
+		if res.Err != nil {
+			// A secret that could not be fetched keeps its last entry, see
+			// discoverInternalCerts; a deleted one is gone.
+			if !apierrors.IsNotFound(res.Err) {
+				certs = append(certs, internalCert{key: key, err: res.Err})
+			}
+			continue
+		}
+		if res.Value.notTLS {
+			continue
+		}
+		certs = append(certs, internalCert{key: key, cert: res.Value.cert, err: res.Value.err, managedBy: certeval.ManagedBy(m.Annotations), meta: m})
+	}
+	r.certs.retain(seen)
+	return certs, nil
+}
+
+// loadCerts lists the TLS secrets from the API server in pages and caches
+// their parsed certificates. The missed secrets the list does not return are
+// cached as not being TLS secrets, so they are not fetched either.
+func (r *CertificateMonitorReconciler) loadCerts(ctx context.Context, misses []*metav1.PartialObjectMetadata) error {
+	reader := client.Reader(r.Client)
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	listed := map[types.UID]struct{}{}
+	opts := []client.ListOption{client.MatchingFields{"type": string(corev1.SecretTypeTLS)}, client.Limit(secretPageSize)}
+	for {
+		page := &corev1.SecretList{}
+		if err := reader.List(ctx, page, opts...); err != nil {
+			return err
+		}
+		for i := range page.Items {
+			secret := &page.Items[i]
+			listed[secret.UID] = struct{}{}
+			cert, err := certeval.ParsePEM(secret.Data[corev1.TLSCertKey])
+			r.certs.store(secret.UID, cachedCert{resourceVersion: secret.ResourceVersion, cert: cert, err: err})
+		}
+		if page.Continue == "" {
+			break
+		}
+		opts = append(opts[:2], client.Continue(page.Continue))
+	}
+	for _, m := range misses {
+		if _, ok := listed[m.UID]; !ok {
+			r.certs.store(m.UID, cachedCert{resourceVersion: m.ResourceVersion, notTLS: true})
+		}
+	}
+	return nil
+}
+
+// loadCert fetches a secret and caches its parsed certificate, or the fact
+// that it is not a TLS secret.
+func (r *CertificateMonitorReconciler) loadCert(ctx context.Context, key types.NamespacedName) (cachedCert, error) {
+	secret := &corev1.Secret{}
+	if err := r.fetchSecret(ctx, key, secret); err != nil {
+		return cachedCert{}, err
+	}
+
+	entry := cachedCert{resourceVersion: secret.ResourceVersion}
+	if secret.Type != corev1.SecretTypeTLS {
+		entry.notTLS = true
+	} else {
+		entry.cert, entry.err = certeval.ParsePEM(secret.Data[corev1.TLSCertKey])
+	}
+	r.certs.store(secret.UID, entry)
+	return entry, nil
+}
+
+// fetchSecret reads a full secret. In metadata-only mode it goes straight to
+// the API server, since a cached Get would start a full Secret informer.
+func (r *CertificateMonitorReconciler) fetchSecret(ctx context.Context, key types.NamespacedName, secret *corev1.Secret) error {
+	if r.MetadataOnlySecrets && r.APIReader != nil {
+		return r.APIReader.Get(ctx, key, secret)
+	}
+	return r.Get(ctx, key, secret)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+)
+
+var _ = Describe("Metadata-only secrets", func() {
+	It("lists the TLS secrets at once instead of fetching each secret", func() {
+		certPEM, _, err := selfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+		var objs []client.Object
+		for i := 0; i < bulkLoadThreshold; i++ {
+			objs = append(objs,
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: fmt.Sprintf("tls-%d", i), UID: types.UID(fmt.Sprintf("tls-%d", i))},
+					Type:       corev1.SecretTypeTLS,
+					Data:       map[string][]byte{corev1.TLSCertKey: certPEM},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: fmt.Sprintf("opaque-%d", i), UID: types.UID(fmt.Sprintf("opaque-%d", i))},
+					Type:       corev1.SecretTypeOpaque,
+				})
+		}
+
+		gets, lists := 0, 0
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(objs...).
+			WithIndex(&corev1.Secret{}, "type", func(o client.Object) []string {
+				return []string{string(o.(*corev1.Secret).Type)}
+			}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					gets++
+					return c.Get(ctx, key, obj, opts...)
+				},
+				List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					if _, ok := list.(*corev1.SecretList); ok {
+						lists++
+					}
+					return c.List(ctx, list, opts...)
+				},
+			}).Build()
+		r := &CertificateMonitorReconciler{Client: c, APIReader: c, MetadataOnlySecrets: true, certs: newCertCache()}
+
+		certs, err := r.listInternalCerts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certs).To(HaveLen(bulkLoadThreshold))
+		Expect(gets).To(BeZero())
+		Expect(lists).To(Equal(1))
+
+		// Every secret is cached now, TLS or not.
+		_, err = r.listInternalCerts(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gets).To(BeZero())
+		Expect(lists).To(Equal(1))
+	})
+
+	It("keeps the last entry of the secrets a scan fails to evaluate", func() {
+		certPEM, _, err := selfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+		secret := func(name string, data []byte) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, UID: types.UID(name)},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{corev1.TLSCertKey: data},
+			}
+		}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).
+			WithObjects(secret("api-tls", certPEM), secret("web-tls", []byte("garbage")), secret("new-tls", []byte("garbage"))).
+			WithIndex(&corev1.Secret{}, "type", func(o client.Object) []string {
+				return []string{string(o.(*corev1.Secret).Type)}
+			}).Build()
+		r := &CertificateMonitorReconciler{Client: c, certs: newCertCache()}
+		previous := []monitoringv1alpha1.MonitoredCertificateStatus{
+			{Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Status: valid, Fingerprint: "old"},
+		}
+
+		statuses, err := r.discoverInternalCerts(context.Background(), previous)
+		Expect(err).NotTo(HaveOccurred())
+		sortCertStatuses(statuses)
+		Expect(statuses).To(HaveLen(2))
+		Expect(statuses[0].Name).To(Equal(certeval.InternalName("shop", "api-tls")))
+		Expect(statuses[1]).To(Equal(previous[0]))
+	})
+})
@@ -0,0 +1,214 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// The secret scan benchmarks compare the memory held by the full Secret cache
+// against the metadata-only mode. They start their own envtest control plane
+// and create BENCH_SECRETS synthetic secrets (50000 by default, one in ten of
+// them kubernetes.io/tls), so they are slow and must be run explicitly:
+//
+//	go test ./internal/controller -run '^$' -bench SecretScan -benchtime 3x
+
+func BenchmarkSecretScan(b *testing.B) {
+	count := 50000
+	if v := os.Getenv("BENCH_SECRETS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.Fatalf("invalid BENCH_SECRETS %q: %v", v, err)
+		}
+		count = n
+	}
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+		BinaryAssetsDirectory: filepath.Join("..", "..", "bin", "k8s",
+			fmt.Sprintf("1.29.0-%s-%s", goruntime.GOOS, goruntime.GOARCH)),
+	}
+	restCfg, err := env.Start()
+	if err != nil {
+		b.Fatalf("starting envtest: %v", err)
+	}
+	defer func() { _ = env.Stop() }()
+
+	benchScheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(benchScheme)
+	_ = monitoringv1alpha1.AddToScheme(benchScheme)
+
+	c, err := client.New(restCfg, client.Options{Scheme: benchScheme})
+	if err != nil {
+		b.Fatalf("creating client: %v", err)
+	}
+	if err := createBenchSecrets(context.Background(), c, count); err != nil {
+		b.Fatalf("creating fixtures: %v", err)
+	}
+
+	b.Run("full", func(b *testing.B) { benchmarkSecretScan(b, restCfg, benchScheme, false) })
+	b.Run("metadata-only", func(b *testing.B) { benchmarkSecretScan(b, restCfg, benchScheme, true) })
+}
+
+// benchmarkSecretScan starts a manager in the given mode, waits for its cache
+// to sync and reports the heap retained after scanning as heap-MB.
+func benchmarkSecretScan(b *testing.B, restCfg *rest.Config, benchScheme *runtime.Scheme, metadataOnly bool) {
+	before := heapInUse()
+
+	mgr, err := ctrl.NewManager(restCfg, ctrl.Options{
+		Scheme:  benchScheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		b.Fatalf("creating manager: %v", err)
+	}
+	r := &CertificateMonitorReconciler{
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		MetadataOnlySecrets: metadataOnly,
+		APIReader:           mgr.GetAPIReader(),
+	}
+	if err := r.SetupWithManager(mgr); err != nil {
+		b.Fatalf("setting up reconciler: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = mgr.Start(ctx) }()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		b.Fatal("cache did not sync")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		certs, err := r.listInternalCerts(ctx)
+		if err != nil {
+			b.Fatalf("scanning: %v", err)
+		}
+		b.ReportMetric(float64(len(certs)), "certs")
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(heapInUse()-before)/(1<<20), "heap-MB")
+}
+
+func heapInUse() uint64 {
+	goruntime.GC()
+	var m goruntime.MemStats
+	goruntime.ReadMemStats(&m)
+	return m.HeapInuse
+}
+
+// createBenchSecrets creates count opaque secrets with a 2KiB payload, one in
+// ten replaced by a TLS secret carrying a self-signed certificate.
+func createBenchSecrets(ctx context.Context, c client.Client, count int) error {
+	certPEM, keyPEM, err := selfSignedCert()
+	if err != nil {
+		return err
+	}
+	payload := make([]byte, 2048)
+
+	const workers = 32
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				secret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("bench-%d", i), Namespace: "default"},
+					Type:       corev1.SecretTypeOpaque,
+					Data:       map[string][]byte{"payload": payload},
+				}
+				if i%10 == 0 {
+					secret.Type = corev1.SecretTypeTLS
+					secret.Data = map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+				}
+				if err := c.Create(ctx, secret); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case jobs <- i:
+		case err := <-errs:
+			close(jobs)
+			wg.Wait()
+			return err
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func selfSignedCert() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bench.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// parseSilenceUntil reads the value of the silence annotation: an RFC 3339
+// time or a date, meaning midnight UTC.
+func parseSilenceUntil(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q, expected an RFC 3339 time or a date", monitoringv1alpha1.SilenceUntilAnnotation, v)
+	}
+	return t, nil
+}
+
+// silenced reports whether a certificate is silenced at the given time.
+func silenced(s monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) bool {
+	return s.SilencedUntil != nil && now.Before(s.SilencedUntil.Time)
+}
+
+// applySilences records on each entry when the silences covering it end: the
+// annotation on its Secret or Node and the CertificateSilences of the monitor
+// namespace. The latest end wins; entries without an active silence are
+// cleared.
+func (r *CertificateMonitorReconciler) applySilences(ctx context.Context, ch *channels, certMonitor *monitoringv1alpha1.CertificateMonitor, current []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) error {
+	log := log.FromContext(ctx)
+	var list monitoringv1alpha1.CertificateSilenceList
+	if err := r.List(ctx, &list, client.InNamespace(certMonitor.Namespace)); err != nil {
+		return fmt.Errorf("unable to list CertificateSilences: %w", err)
+	}
+
+	for i := range current {
+		s := current[i]
+		var until time.Time
+		meta, err := r.source(ctx, ch, s)
+		if err != nil {
+			return err
+		}
+		if v, ok := meta.annotations[monitoringv1alpha1.SilenceUntilAnnotation]; ok {
+			t, err := parseSilenceUntil(v)
+			if err != nil {
+				log.Error(err, "ignoring silence annotation", "certificate", s.Name)
+			} else if t.After(until) {
+				until = t
+			}
+		}
+
+		for _, silence := range list.Items {
+			spec := silence.Spec
+			if !spec.Until.After(now) || !spec.Until.After(until) {
+				continue
+			}
+			if len(spec.Certificates) > 0 && !slices.Contains(spec.Certificates, s.Name) {
+				continue
+			}
+			ok, err := r.matches(ctx, ch, spec.Match, s, s.Status)
+			if err != nil {
+				log.Error(err, "ignoring CertificateSilence", "silence", silence.Name)
+				continue
+			}
+			if ok {
+				until = spec.Until.Time
+			}
+		}
+
+		current[i].SilencedUntil = nil
+		if until.After(now) {
+			current[i].SilencedUntil = &metav1.Time{Time: until}
+		}
+	}
+	return nil
+}
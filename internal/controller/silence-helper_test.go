@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+)
+
+var _ = Describe("Silences", func() {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	monitor := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "monitoring"}}
+	entry := func(namespace, name string) monitoringv1alpha1.MonitoredCertificateStatus {
+		return monitoringv1alpha1.MonitoredCertificateStatus{
+			Name: certeval.InternalName(namespace, name), Type: "internal", Path: namespace + "/" + name, Namespace: namespace, Status: expiring,
+		}
+	}
+	silence := func(name string, until time.Time, spec monitoringv1alpha1.CertificateSilenceSpec) *monitoringv1alpha1.CertificateSilence {
+		spec.Until = metav1.Time{Time: until}
+		return &monitoringv1alpha1.CertificateSilence{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "monitoring"}, Spec: spec}
+	}
+
+	It("parses the annotation as a time or a date", func() {
+		t, err := parseSilenceUntil("2024-07-01")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)))
+		t, err = parseSilenceUntil("2024-07-01T08:00:00+02:00")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.UTC()).To(Equal(time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)))
+		_, err = parseSilenceUntil("next week")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("applies annotations and matching silences, the latest end winning", func() {
+		annotated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: "web", Namespace: "shop",
+			Annotations: map[string]string{monitoringv1alpha1.SilenceUntilAnnotation: "2024-06-10"},
+		}}
+		objs := []*monitoringv1alpha1.CertificateSilence{
+			silence("shop", now.Add(24*time.Hour), monitoringv1alpha1.CertificateSilenceSpec{
+				Match: monitoringv1alpha1.NotificationMatch{Namespaces: []string{"shop"}},
+			}),
+			silence("expired", now.Add(-time.Hour), monitoringv1alpha1.CertificateSilenceSpec{}),
+		}
+		builder := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(annotated)
+		for _, o := range objs {
+			builder = builder.WithObjects(o)
+		}
+		r := &CertificateMonitorReconciler{Client: builder.Build()}
+
+		current := []monitoringv1alpha1.MonitoredCertificateStatus{entry("shop", "web"), entry("shop", "api"), entry("payments", "api")}
+		Expect(r.applySilences(ctx, &channels{}, monitor, current, now)).To(Succeed())
+		Expect(current[0].SilencedUntil.Time).To(Equal(time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)))
+		Expect(current[1].SilencedUntil.Time).To(BeTemporally("==", now.Add(24*time.Hour)))
+		Expect(current[2].SilencedUntil).To(BeNil())
+		Expect(silenced(current[1], now)).To(BeTrue())
+		Expect(silenced(current[1], now.Add(48*time.Hour))).To(BeFalse())
+	})
+})
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/config"
+	"egarciam.com/checkcert/internal/templates"
+)
+
+// loadTemplates returns the notification templates of a monitor: the built-in
+// ones, overridden by the keys of the ConfigMap it references. A broken
+// template is rejected as a whole so recipients never get a half-rendered mail.
+func (r *CertificateMonitorReconciler) loadTemplates(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor) (*templates.Set, error) {
+	if certMonitor.Spec.Templates == "" {
+		return templates.Builtin(), nil
+	}
+	var configMap corev1.ConfigMap
+	key := types.NamespacedName{Name: certMonitor.Spec.Templates, Namespace: certMonitor.Namespace}
+	if err := r.Get(ctx, key, &configMap); err != nil {
+		return nil, fmt.Errorf("unable to fetch templates ConfigMap %s: %w", key, err)
+	}
+	set, err := templates.Load(configMap.Data)
+	if err != nil {
+		return nil, fmt.Errorf("templates ConfigMap %s: %w", key, err)
+	}
+	return set, nil
+}
+
+// clusterName is the cluster name shown in notifications.
+func clusterName() string {
+	if config.ClusterName == nil {
+		return ""
+	}
+	return *config.ClusterName
+}
+
+// thresholds returns the limits a monitor evaluates certificates against.
+func thresholds(certMonitor *monitoringv1alpha1.CertificateMonitor) templates.Thresholds {
+	return templates.Thresholds{
+		WarningDays:      certeval.WarningDays(),
+		CriticalDays:     certeval.CriticalDays(),
+		ReminderInterval: reminderInterval(certMonitor),
+	}
+}
+
+// templateCert converts a status entry into the template view of a certificate.
+func templateCert(s monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) templates.Certificate {
+	c := templates.Certificate{
+		Name:         s.Name,
+		Namespace:    s.Namespace,
+		Type:         s.Type,
+		Path:         s.Path,
+		Status:       s.Status,
+		Expiry:       s.Expiry,
+		Fingerprint:  s.Fingerprint,
+		Subject:      s.Subject,
+		Issuer:       s.Issuer,
+		DNSNames:     s.DNSNames,
+		NotBefore:    s.NotBefore,
+		SerialNumber: s.SerialNumber,
+		Owner:        s.Owner,
+	}
+	for _, ref := range s.UsedBy {
+		c.UsedBy = append(c.UsedBy, fmt.Sprintf("%s %s in namespace %s", strings.ToLower(ref.Kind), ref.Name, ref.Namespace))
+	}
+	if expiry, err := time.Parse(time.RFC3339, s.Expiry); err == nil {
+		c.DaysLeft = int(expiry.Sub(now).Hours() / 24)
+	}
+	return c
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/config"
+)
+
+// gatewayListGVK is the Gateway API list kind. Gateways are read as
+// unstructured objects so the Gateway API types are not a dependency, and
+// skipped on clusters without the CRD.
+var gatewayListGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "GatewayList"}
+
+// usageListPageSize is how many objects each List of the workload usage
+// mapping returns, so a scan never holds every Pod of the cluster at once.
+const usageListPageSize = 500
+
+// usageIndex maps secrets to the workloads referencing them.
+type usageIndex map[types.NamespacedName][]monitoringv1alpha1.WorkloadReference
+
+// mapWorkloadUsage reports whether full scans record the workloads using
+// each secret.
+func mapWorkloadUsage() bool {
+	return config.WorkloadUsage == nil || *config.WorkloadUsage
+}
+
+// add records that a workload references a secret of its own namespace.
+func (u usageIndex) add(secret, kind string, obj metav1.Object) {
+	u.addIn(obj.GetNamespace(), secret, kind, obj)
+}
+
+// addIn records that a workload references a secret of the given namespace.
+func (u usageIndex) addIn(namespace, secret, kind string, obj metav1.Object) {
+	if secret == "" {
+		return
+	}
+	key := types.NamespacedName{Namespace: namespace, Name: secret}
+	ref := monitoringv1alpha1.WorkloadReference{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	for _, existing := range u[key] {
+		if existing == ref {
+			return
+		}
+	}
+	u[key] = append(u[key], ref)
+}
+
+// usedBy returns the workloads referencing a secret, in a stable order.
+func (u usageIndex) usedBy(key types.NamespacedName) []monitoringv1alpha1.WorkloadReference {
+	refs := u[key]
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return refs
+}
+
+// buildUsageIndex lists the Pods, Deployments, StatefulSets, Ingresses,
+// Gateways and ServiceAccounts of the cluster and indexes the secrets they
+// reference. The lists are read from the API server rather than the cache,
+// which would otherwise keep every Pod of the cluster in memory between
+// scans, one page at a time.
+func (r *CertificateMonitorReconciler) buildUsageIndex(ctx context.Context) (usageIndex, error) {
+	reader := client.Reader(r.Client)
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	u := usageIndex{}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := listPages(ctx, reader, deployments, func() {
+		for i := range deployments.Items {
+			d := &deployments.Items[i]
+			u.addPodSpec("Deployment", d, &d.Spec.Template.Spec)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := listPages(ctx, reader, statefulSets, func() {
+		for i := range statefulSets.Items {
+			s := &statefulSets.Items[i]
+			u.addPodSpec("StatefulSet", s, &s.Spec.Template.Spec)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	pods := &corev1.PodList{}
+	if err := listPages(ctx, reader, pods, func() {
+		for i := range pods.Items {
+			p := &pods.Items[i]
+			// The pods of Deployments and StatefulSets are reported through
+			// their workload.
+			if owner := metav1.GetControllerOf(p); owner != nil && (owner.Kind == "ReplicaSet" || owner.Kind == "StatefulSet") {
+				continue
+			}
+			u.addPodSpec("Pod", p, &p.Spec)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	ingresses := &networkingv1.IngressList{}
+	if err := listPages(ctx, reader, ingresses, func() {
+		for i := range ingresses.Items {
+			ing := &ingresses.Items[i]
+			for _, tls := range ing.Spec.TLS {
+				u.add(tls.SecretName, "Ingress", ing)
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	serviceAccounts := &corev1.ServiceAccountList{}
+	if err := listPages(ctx, reader, serviceAccounts, func() {
+		for i := range serviceAccounts.Items {
+			sa := &serviceAccounts.Items[i]
+			for _, s := range sa.Secrets {
+				u.add(s.Name, "ServiceAccount", sa)
+			}
+			for _, s := range sa.ImagePullSecrets {
+				u.add(s.Name, "ServiceAccount", sa)
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	gateways := &unstructured.UnstructuredList{}
+	gateways.SetGroupVersionKind(gatewayListGVK)
+	err := listPages(ctx, reader, gateways, func() {
+		for i := range gateways.Items {
+			u.addGateway(&gateways.Items[i])
+		}
+	})
+	if err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	return u, nil
+}
+
+// listPages lists objects in pages of usageListPageSize, calling visit once
+// list holds each page.
+func listPages(ctx context.Context, reader client.Reader, list client.ObjectList, visit func()) error {
+	cont := ""
+	for {
+		if err := reader.List(ctx, list, client.Limit(usageListPageSize), client.Continue(cont)); err != nil {
+			return err
+		}
+		visit()
+		if cont = list.GetContinue(); cont == "" {
+			return nil
+		}
+	}
+}
+
+// addPodSpec records the secrets a pod template mounts, reads into the
+// environment or pulls images with.
+func (u usageIndex) addPodSpec(kind string, obj metav1.Object, spec *corev1.PodSpec) {
+	for _, v := range spec.Volumes {
+		if v.Secret != nil {
+			u.add(v.Secret.SecretName, kind, obj)
+		}
+		if v.Projected != nil {
+			for _, src := range v.Projected.Sources {
+				if src.Secret != nil {
+					u.add(src.Secret.Name, kind, obj)
+				}
+			}
+		}
+	}
+	for _, s := range spec.ImagePullSecrets {
+		u.add(s.Name, kind, obj)
+	}
+	containers := append(append([]corev1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if from.SecretRef != nil {
+				u.add(from.SecretRef.Name, kind, obj)
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				u.add(env.ValueFrom.SecretKeyRef.Name, kind, obj)
+			}
+		}
+	}
+}
+
+// addGateway records the secrets of the TLS listeners of a Gateway. A
+// listener may reference a secret of another namespace.
+func (u usageIndex) addGateway(gw *unstructured.Unstructured) {
+	listeners, _, _ := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+	for _, l := range listeners {
+		listener, ok := l.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		refs, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+		for _, ref := range refs {
+			m, ok := ref.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			group, _, _ := unstructured.NestedString(m, "group")
+			kind, _, _ := unstructured.NestedString(m, "kind")
+			if group != "" || (kind != "" && kind != "Secret") {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(m, "name")
+			namespace, _, _ := unstructured.NestedString(m, "namespace")
+			if namespace == "" {
+				namespace = gw.GetNamespace()
+			}
+			u.addIn(namespace, name, "Gateway", gw)
+		}
+	}
+}
+
+// carryUsage keeps the workloads found by the last full scan on an entry
+// re-evaluated after a secret change, until the next full scan maps them
+// again.
+func carryUsage(previous []monitoringv1alpha1.MonitoredCertificateStatus, s *monitoringv1alpha1.MonitoredCertificateStatus) {
+	for _, p := range previous {
+		if p.Name == s.Name {
+			s.UsedBy = p.UsedBy
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+)
+
+var _ = Describe("Workload usage", func() {
+	meta := func(namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: namespace, Name: name}
+	}
+	secretVolume := func(name string) corev1.Volume {
+		return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: name}}}
+	}
+	ref := func(kind, namespace, name string) monitoringv1alpha1.WorkloadReference {
+		return monitoringv1alpha1.WorkloadReference{Kind: kind, Namespace: namespace, Name: name}
+	}
+
+	It("maps secrets to the workloads referencing them", func() {
+		deployment := &appsv1.Deployment{ObjectMeta: meta("shop", "web")}
+		deployment.Spec.Template.Spec.Volumes = []corev1.Volume{secretVolume("web-tls")}
+		statefulSet := &appsv1.StatefulSet{ObjectMeta: meta("shop", "db")}
+		statefulSet.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name:    "db",
+			EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db-tls"}}}},
+		}}
+		pod := &corev1.Pod{ObjectMeta: meta("shop", "debug")}
+		pod.Spec.InitContainers = []corev1.Container{{
+			Name: "init",
+			Env: []corev1.EnvVar{{Name: "KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "web-tls"}, Key: "tls.key",
+			}}}},
+		}}
+		replica := &corev1.Pod{ObjectMeta: meta("shop", "web-5d9c7-abcde")}
+		controller := true
+		replica.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d9c7", UID: "rs", Controller: &controller}}
+		replica.Spec.Volumes = []corev1.Volume{secretVolume("web-tls")}
+		ingress := &networkingv1.Ingress{ObjectMeta: meta("shop", "web")}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "web-tls"}, {SecretName: "web-tls"}}
+		serviceAccount := &corev1.ServiceAccount{ObjectMeta: meta("shop", "builder")}
+		serviceAccount.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+		gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"listeners": []interface{}{
+				map[string]interface{}{"name": "https", "tls": map[string]interface{}{"certificateRefs": []interface{}{
+					map[string]interface{}{"name": "web-tls", "namespace": "shop"},
+					map[string]interface{}{"kind": "ConfigMap", "name": "other"},
+				}}},
+			}},
+		}}
+		gateway.SetAPIVersion("gateway.networking.k8s.io/v1")
+		gateway.SetKind("Gateway")
+		gateway.SetNamespace("edge")
+		gateway.SetName("public")
+
+		c := fake.NewClientBuilder().WithScheme(testScheme()).
+			WithObjects(deployment, statefulSet, pod, replica, ingress, serviceAccount, gateway).Build()
+		r := &CertificateMonitorReconciler{Client: c}
+		usage, err := r.buildUsageIndex(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(usage.usedBy(types.NamespacedName{Namespace: "shop", Name: "web-tls"})).To(Equal([]monitoringv1alpha1.WorkloadReference{
+			ref("Deployment", "shop", "web"),
+			ref("Gateway", "edge", "public"),
+			ref("Ingress", "shop", "web"),
+			ref("Pod", "shop", "debug"),
+		}))
+		Expect(usage.usedBy(types.NamespacedName{Namespace: "shop", Name: "db-tls"})).To(Equal([]monitoringv1alpha1.WorkloadReference{ref("StatefulSet", "shop", "db")}))
+		Expect(usage.usedBy(types.NamespacedName{Namespace: "shop", Name: "registry"})).To(Equal([]monitoringv1alpha1.WorkloadReference{ref("ServiceAccount", "shop", "builder")}))
+		Expect(usage.usedBy(types.NamespacedName{Namespace: "edge", Name: "other"})).To(BeEmpty())
+	})
+
+	It("lists the workloads page by page", func() {
+		first, second := &corev1.Pod{ObjectMeta: meta("shop", "a")}, &corev1.Pod{ObjectMeta: meta("shop", "b")}
+		first.Spec.Volumes = []corev1.Volume{secretVolume("web-tls")}
+		second.Spec.Volumes = []corev1.Volume{secretVolume("web-tls")}
+		var limits []int64
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				o := (&client.ListOptions{}).ApplyOptions(opts)
+				limits = append(limits, o.Limit)
+				pods, ok := list.(*corev1.PodList)
+				if !ok {
+					return c.List(ctx, list, opts...)
+				}
+				// The fake client does not page: serve one pod per page.
+				if o.Continue == "" {
+					pods.Items, pods.Continue = []corev1.Pod{*first}, "b"
+				} else {
+					pods.Items, pods.Continue = []corev1.Pod{*second}, ""
+				}
+				return nil
+			},
+		}).Build()
+		r := &CertificateMonitorReconciler{Client: c}
+		usage, err := r.buildUsageIndex(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(usage.usedBy(types.NamespacedName{Namespace: "shop", Name: "web-tls"})).To(Equal([]monitoringv1alpha1.WorkloadReference{
+			ref("Pod", "shop", "a"), ref("Pod", "shop", "b"),
+		}))
+		Expect(limits).To(HaveLen(7))
+		Expect(limits).To(HaveEach(BeEquivalentTo(usageListPageSize)))
+	})
+
+	It("keeps the usage of re-evaluated secrets until the next full scan", func() {
+		certPEM, _, err := selfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+		secret := &corev1.Secret{ObjectMeta: meta("shop", "web-tls"), Type: corev1.SecretTypeTLS, Data: map[string][]byte{corev1.TLSCertKey: certPEM}}
+		monitor := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: meta("monitoring", "prod")}
+		monitor.Spec.DiscoverInternal = true
+		monitor.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{{
+			Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: valid,
+			UsedBy: []monitoringv1alpha1.WorkloadReference{ref("Deployment", "shop", "web")},
+		}}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(secret, monitor).WithStatusSubresource(monitor).Build()
+		r := &CertificateMonitorReconciler{Client: c, certs: newCertCache()}
+
+		_, err = r.applyChanges(context.Background(), monitor, []types.NamespacedName{client.ObjectKeyFromObject(secret)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(monitor.Status.MonitoredCertificates).To(HaveLen(1))
+		Expect(monitor.Status.MonitoredCertificates[0].UsedBy).To(Equal([]monitoringv1alpha1.WorkloadReference{ref("Deployment", "shop", "web")}))
+	})
+})
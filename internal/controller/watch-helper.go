@@ -0,0 +1,370 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+)
+
+// changeTracker remembers which secrets and nodes changed for each monitor
+// between reconciles, so a watch event only re-evaluates the affected
+// certificates. Secrets are namespaced, so a key without a namespace names a
+// node. Endpoints have no events and are only probed by full scans.
+type changeTracker struct {
+	mu      sync.Mutex
+	pending map[types.NamespacedName]map[types.NamespacedName]struct{}
+}
+
+func newChangeTracker() *changeTracker {
+	return &changeTracker{pending: map[types.NamespacedName]map[types.NamespacedName]struct{}{}}
+}
+
+// add records changed secrets or nodes for a monitor.
+func (t *changeTracker) add(monitor types.NamespacedName, secrets ...types.NamespacedName) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	set, ok := t.pending[monitor]
+	if !ok {
+		set = map[types.NamespacedName]struct{}{}
+		t.pending[monitor] = set
+	}
+	for _, s := range secrets {
+		set[s] = struct{}{}
+	}
+}
+
+// take returns and clears the changes recorded for a monitor.
+func (t *changeTracker) take(monitor types.NamespacedName) []types.NamespacedName {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	set := t.pending[monitor]
+	delete(t.pending, monitor)
+	secrets := make([]types.NamespacedName, 0, len(set))
+	for s := range set {
+		secrets = append(secrets, s)
+	}
+	return secrets
+}
+
+// isTLSSecret reports whether the object is a kubernetes.io/tls secret.
+func isTLSSecret(o client.Object) bool {
+	secret, ok := o.(*corev1.Secret)
+	return ok && secret.Type == corev1.SecretTypeTLS
+}
+
+// tlsSecretPredicate filters secret events down to TLS secrets. Updates are
+// let through when either side is a TLS secret so a type change is noticed.
+var tlsSecretPredicate = predicate.Funcs{
+	CreateFunc:  func(e event.CreateEvent) bool { return isTLSSecret(e.Object) },
+	DeleteFunc:  func(e event.DeleteEvent) bool { return isTLSSecret(e.Object) },
+	GenericFunc: func(e event.GenericEvent) bool { return isTLSSecret(e.Object) },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isTLSSecret(e.ObjectOld) || isTLSSecret(e.ObjectNew)
+	},
+}
+
+// secretMetadataPredicate is used when only secret metadata is watched. The
+// create events replayed by the initial list for secrets older than the
+// controller are dropped: the next full scan covers them, and relaying them
+// would fetch every secret in the cluster one by one.
+func secretMetadataPredicate(started time.Time) predicate.Predicate {
+	// Creation timestamps have second precision.
+	started = started.Truncate(time.Second)
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return !e.Object.GetCreationTimestamp().Time.Before(started)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetResourceVersion() != e.ObjectNew.GetResourceVersion()
+		},
+	}
+}
+
+// nodeReportPredicate lets through node events that change the certificate
+// reports left by the checker pods, see annotateNode.
+var nodeReportPredicate = predicate.Funcs{
+	CreateFunc:  func(e event.CreateEvent) bool { return hasNodeReport(e.Object) },
+	DeleteFunc:  func(e event.DeleteEvent) bool { return hasNodeReport(e.Object) },
+	GenericFunc: func(e event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return nodeReportChanged(e.ObjectOld.GetAnnotations(), e.ObjectNew.GetAnnotations())
+	},
+}
+
+// hasNodeReport reports whether a node carries certificate reports.
+func hasNodeReport(o client.Object) bool {
+	for key := range o.GetAnnotations() {
+		if strings.HasPrefix(key, nodeCertStatusPrefix) || strings.HasPrefix(key, nodeCertExpiryPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeReportChanged compares the certificate report annotations of a node.
+func nodeReportChanged(old, new map[string]string) bool {
+	report := func(annotations map[string]string) map[string]string {
+		out := map[string]string{}
+		for key, v := range annotations {
+			if strings.HasPrefix(key, nodeCertStatusPrefix) || strings.HasPrefix(key, nodeCertExpiryPrefix) {
+				out[key] = v
+			}
+		}
+		return out
+	}
+	return !reflect.DeepEqual(report(old), report(new))
+}
+
+// nodeToMonitors maps a node report event to every monitor discovering
+// external certificates and records the node as changed for each of them.
+func (r *CertificateMonitorReconciler) nodeToMonitors(ctx context.Context, o client.Object) []reconcile.Request {
+	log := log.FromContext(ctx)
+	monitors := &monitoringv1alpha1.CertificateMonitorList{}
+	if err := r.List(ctx, monitors); err != nil {
+		log.Error(err, "unable to list CertificateMonitors for node event", "node", o.GetName())
+		return nil
+	}
+
+	node := types.NamespacedName{Name: o.GetName()}
+	var requests []reconcile.Request
+	for _, m := range monitors.Items {
+		if !m.Spec.DiscoverExternal {
+			continue
+		}
+		key := client.ObjectKeyFromObject(&m)
+		r.changes.add(key, node)
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
+
+// secretToMonitors maps a TLS secret event to every monitor discovering
+// internal certificates and records the secret as changed for each of them.
+func (r *CertificateMonitorReconciler) secretToMonitors(ctx context.Context, o client.Object) []reconcile.Request {
+	log := log.FromContext(ctx)
+	monitors := &monitoringv1alpha1.CertificateMonitorList{}
+	if err := r.List(ctx, monitors); err != nil {
+		log.Error(err, "unable to list CertificateMonitors for secret event", "secret", client.ObjectKeyFromObject(o))
+		return nil
+	}
+
+	secret := client.ObjectKeyFromObject(o)
+	var requests []reconcile.Request
+	for _, m := range monitors.Items {
+		if !m.Spec.DiscoverInternal {
+			continue
+		}
+		key := client.ObjectKeyFromObject(&m)
+		r.changes.add(key, secret)
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
+
+// applyChanges re-evaluates only the given secrets and nodes and patches
+// their entries in the monitor status, instead of relisting every TLS secret
+// and node. The alerts due are planned even without changes, so reminders and
+// digests go out between scans; the status is only written when it changed.
+// It returns when the next queued or deferred notification is due.
+func (r *CertificateMonitorReconciler) applyChanges(ctx context.Context, certMonitor *monitoringv1alpha1.CertificateMonitor, keys []types.NamespacedName) (time.Time, error) {
+	log := log.FromContext(ctx)
+
+	before := certMonitor.Status.DeepCopy()
+	// Work on a copy: the current entries are the previous state for notifyAlerts.
+	statuses := append([]monitoringv1alpha1.MonitoredCertificateStatus(nil), certMonitor.Status.MonitoredCertificates...)
+	owners := r.newOwnerResolver()
+	var changed []monitoringv1alpha1.MonitoredCertificateStatus
+	for _, key := range keys {
+		if key.Namespace == "" {
+			if !certMonitor.Spec.DiscoverExternal {
+				continue
+			}
+			reports, err := r.nodeReports(ctx, key.Name)
+			if err != nil {
+				return time.Time{}, err
+			}
+			statuses = removeNodeStatuses(statuses, key.Name)
+			for _, s := range reports {
+				statuses = append(statuses, s)
+				changed = append(changed, s)
+			}
+			log.Info("Node certificates re-read after report change", "node", key.Name, "certificates", len(reports))
+			continue
+		}
+		if !certMonitor.Spec.DiscoverInternal {
+			continue
+		}
+		name := certeval.InternalName(key.Namespace, key.Name)
+
+		secret := &corev1.Secret{}
+		err := r.fetchSecret(ctx, key, secret)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return time.Time{}, err
+		}
+		if apierrors.IsNotFound(err) || secret.Type != corev1.SecretTypeTLS {
+			// The cache entry of a deleted secret is pruned by the next full
+			// scan. In metadata-only mode every secret is watched, so most of
+			// them were never TLS secrets and have no entry.
+			if hasCertStatus(statuses, name) {
+				log.Info("Certificate secret removed", "secret", key)
+				statuses = removeCertStatus(statuses, name)
+			}
+			continue
+		}
+
+		cert, err := r.certs.get(secret)
+		ic := internalCert{key: key, cert: cert, err: err, managedBy: certeval.ManagedBy(secret.Annotations), meta: secret}
+		certStatus, err := r.evaluateInternalCert(ctx, ic)
+		if err != nil {
+			// Only a deleted secret, or one no longer TLS, loses its entry;
+			// the next scan retries the evaluation.
+			log.Error(err, "failed to evaluate changed secret, keeping its last entry", "secret", key)
+			continue
+		}
+		carryUsage(certMonitor.Status.MonitoredCertificates, &certStatus)
+		certStatus.Owner = owners.resolve(ctx, secret)
+		log.Info("Certificate re-evaluated after secret change", "secret", key, "status", certStatus.Status)
+		statuses = upsertCertStatus(statuses, certStatus)
+		changed = append(changed, certStatus)
+	}
+
+	sortCertStatuses(statuses)
+	// A certificate may have crossed a threshold since it was evaluated.
+	refreshStatuses(statuses)
+
+	now := time.Now()
+	ch := r.newChannels(ctx, certMonitor)
+	defer ch.close()
+	retry := r.notifyAlerts(ctx, ch, certMonitor, statuses, now, false)
+	r.recordEvents(ctx, certMonitor, statuses, now)
+	recordCertificateMetrics(certMonitor, statuses, now)
+
+	certMonitor.Status.MonitoredCertificates = statuses
+	if equality.Semantic.DeepEqual(before, &certMonitor.Status) {
+		return retry, nil
+	}
+	if err := r.updateStatus(ctx, certMonitor); err != nil {
+		return time.Time{}, err
+	}
+	r.recordHistory(ctx, certMonitor, changed, now, false)
+	return retry, nil
+}
+
+// nodeReports returns the external certificates reported on a node. Deleted
+// nodes and nodes that are not part of the control plane report none, as in a
+// full scan.
+func (r *CertificateMonitorReconciler) nodeReports(ctx context.Context, name string) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
+	node := &corev1.Node{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !isControlPlaneNode(*node) {
+		return nil, nil
+	}
+	return nodeReport(*node), nil
+}
+
+// removeNodeStatuses drops the external entries of a node.
+func removeNodeStatuses(statuses []monitoringv1alpha1.MonitoredCertificateStatus, node string) []monitoringv1alpha1.MonitoredCertificateStatus {
+	out := statuses[:0]
+	for _, s := range statuses {
+		if s.Type != "external" || s.Node != node {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// sortCertStatuses orders status entries by name, so scans that collect
+// results concurrently always produce the same status.
+func sortCertStatuses(statuses []monitoringv1alpha1.MonitoredCertificateStatus) {
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+}
+
+// refreshStatuses recomputes the status of the entries from their expiry,
+// so a threshold crossing is alerted on between scans.
+func refreshStatuses(statuses []monitoringv1alpha1.MonitoredCertificateStatus) {
+	for i := range statuses {
+		if expiry, ok := refreshable(statuses[i]); ok {
+			statuses[i].Status = certeval.Status(expiry)
+		}
+	}
+}
+
+// refreshable returns the expiry of an entry whose status the controller
+// derives itself. The status of node certificates is the one the node
+// reported.
+func refreshable(s monitoringv1alpha1.MonitoredCertificateStatus) (time.Time, bool) {
+	if s.Type == "external" {
+		return time.Time{}, false
+	}
+	expiry, err := time.Parse(time.RFC3339, s.Expiry)
+	return expiry, err == nil
+}
+
+// upsertCertStatus replaces the entry with the same name or appends it.
+func upsertCertStatus(statuses []monitoringv1alpha1.MonitoredCertificateStatus, s monitoringv1alpha1.MonitoredCertificateStatus) []monitoringv1alpha1.MonitoredCertificateStatus {
+	for i := range statuses {
+		if statuses[i].Name == s.Name {
+			statuses[i] = s
+			return statuses
+		}
+	}
+	return append(statuses, s)
+}
+
+// findCertStatus returns the entry with the given name.
+func findCertStatus(statuses []monitoringv1alpha1.MonitoredCertificateStatus, name string) (monitoringv1alpha1.MonitoredCertificateStatus, bool) {
+	for _, s := range statuses {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return monitoringv1alpha1.MonitoredCertificateStatus{}, false
+}
+
+// hasCertStatus reports whether an entry has the given name.
+func hasCertStatus(statuses []monitoringv1alpha1.MonitoredCertificateStatus, name string) bool {
+	for _, s := range statuses {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeCertStatus drops the entry with the given name, if present.
+func removeCertStatus(statuses []monitoringv1alpha1.MonitoredCertificateStatus, name string) []monitoringv1alpha1.MonitoredCertificateStatus {
+	out := statuses[:0]
+	for _, s := range statuses {
+		if s.Name != name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
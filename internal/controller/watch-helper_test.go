@@ -0,0 +1,284 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/certeval"
+	"egarciam.com/checkcert/internal/notify"
+)
+
+var _ = Describe("Watch events", func() {
+	var (
+		ctx     context.Context
+		certPEM []byte
+	)
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		certPEM, _, err = selfSignedCert()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	tlsSecret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, UID: types.UID(name)},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM},
+		}
+	}
+	monitor := func(name string, internal, external bool) *monitoringv1alpha1.CertificateMonitor {
+		m := &monitoringv1alpha1.CertificateMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: name}}
+		m.Spec.DiscoverInternal = internal
+		m.Spec.DiscoverExternal = external
+		return m
+	}
+	reconciler := func(objs ...client.Object) (*CertificateMonitorReconciler, client.Client) {
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(objs...).
+			WithStatusSubresource(&monitoringv1alpha1.CertificateMonitor{}).Build()
+		return &CertificateMonitorReconciler{Client: c, changes: newChangeTracker(), certs: newCertCache()}, c
+	}
+
+	It("routes secret events to the monitors discovering internal certificates", func() {
+		internal := monitor("internal", true, false)
+		external := monitor("external", false, true)
+		r, _ := reconciler(internal, external)
+		secret := tlsSecret("web-tls")
+
+		Expect(r.secretToMonitors(ctx, secret)).To(Equal([]reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(internal)}}))
+		Expect(r.changes.take(client.ObjectKeyFromObject(internal))).To(Equal([]types.NamespacedName{client.ObjectKeyFromObject(secret)}))
+		Expect(r.changes.take(client.ObjectKeyFromObject(external))).To(BeEmpty())
+	})
+
+	It("ignores secrets no monitor covers", func() {
+		r, _ := reconciler(monitor("external", false, true))
+		Expect(r.secretToMonitors(ctx, tlsSecret("web-tls"))).To(BeEmpty())
+
+		opaque := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "creds"}, Type: corev1.SecretTypeOpaque}
+		Expect(tlsSecretPredicate.Create(event.CreateEvent{Object: opaque})).To(BeFalse())
+		Expect(tlsSecretPredicate.Update(event.UpdateEvent{ObjectOld: opaque, ObjectNew: tlsSecret("creds")})).To(BeTrue())
+	})
+
+	It("re-evaluates an updated secret and drops a deleted one", func() {
+		web, api := tlsSecret("web-tls"), tlsSecret("api-tls")
+		m := monitor("prod", true, false)
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{
+			{Name: certeval.InternalName("shop", "api-tls"), Type: "internal", Path: "shop/api-tls", Namespace: "shop", Status: valid},
+			{Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: expired, Fingerprint: "old"},
+		}
+		r, c := reconciler(m, web, api)
+
+		Expect(c.Delete(ctx, api)).To(Succeed())
+		_, err := r.applyChanges(ctx, m, []types.NamespacedName{client.ObjectKeyFromObject(web), client.ObjectKeyFromObject(api)})
+		Expect(err).NotTo(HaveOccurred())
+
+		stored := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), stored)).To(Succeed())
+		Expect(stored.Status.MonitoredCertificates).To(HaveLen(1))
+		Expect(stored.Status.MonitoredCertificates[0].Name).To(Equal(certeval.InternalName("shop", "web-tls")))
+		Expect(stored.Status.MonitoredCertificates[0].Status).To(Equal(valid))
+		Expect(stored.Status.MonitoredCertificates[0].Fingerprint).NotTo(Equal("old"))
+	})
+
+	It("keeps the entry of a changed secret that fails to evaluate", func() {
+		broken := tlsSecret("web-tls")
+		broken.Data[corev1.TLSCertKey] = []byte("garbage")
+		m := monitor("prod", true, false)
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{
+			{Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: valid, Fingerprint: "old"},
+		}
+		r, c := reconciler(m, broken)
+
+		_, err := r.applyChanges(ctx, m, []types.NamespacedName{client.ObjectKeyFromObject(broken)})
+		Expect(err).NotTo(HaveOccurred())
+
+		stored := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), stored)).To(Succeed())
+		Expect(stored.Status.MonitoredCertificates).To(HaveLen(1))
+		Expect(stored.Status.MonitoredCertificates[0].Fingerprint).To(Equal("old"))
+	})
+
+	It("sends the reminders due between scans", func() {
+		var kinds []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			kinds = append(kinds, req.Header.Get(notify.EventHeader))
+		}))
+		defer srv.Close()
+
+		m := monitor("prod", true, false)
+		m.Spec.Webhook = &monitoringv1alpha1.WebhookConfig{URL: srv.URL}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{{
+			Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: expiring,
+			LastNotifiedStatus: expiring, LastNotified: &metav1.Time{Time: time.Now().Add(-25 * time.Hour)},
+		}}
+		r, c := reconciler(m)
+
+		retry, err := r.applyChanges(ctx, m, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retry.IsZero()).To(BeTrue())
+		Expect(kinds).To(Equal([]string{string(alertReminder)}))
+		stored := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), stored)).To(Succeed())
+		Expect(stored.Status.MonitoredCertificates[0].LastNotified.Time).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(nextAlertDue(stored, time.Now())).To(BeTemporally("~", time.Now().Add(24*time.Hour), time.Minute))
+
+		// Nothing is due now: no alert and no status write.
+		_, err = r.applyChanges(ctx, stored, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kinds).To(HaveLen(1))
+		again := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), again)).To(Succeed())
+		Expect(again.ResourceVersion).To(Equal(stored.ResourceVersion))
+	})
+
+	It("alerts on a threshold crossed since the last scan", func() {
+		var kinds []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			kinds = append(kinds, req.Header.Get(notify.EventHeader))
+		}))
+		defer srv.Close()
+
+		m := monitor("prod", true, false)
+		m.Spec.Webhook = &monitoringv1alpha1.WebhookConfig{URL: srv.URL}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{{
+			Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: valid,
+			Expiry: time.Now().Add(29 * 24 * time.Hour).Format(time.RFC3339),
+		}}
+		r, c := reconciler(m)
+
+		_, err := r.applyChanges(ctx, m, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kinds).To(Equal([]string{string(alertTransition)}))
+		stored := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), stored)).To(Succeed())
+		Expect(stored.Status.MonitoredCertificates[0].Status).To(Equal(expiring))
+	})
+
+	It("keeps the notification state when the status write conflicts", func() {
+		var kinds []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			kinds = append(kinds, req.Header.Get(notify.EventHeader))
+		}))
+		defer srv.Close()
+
+		m := monitor("prod", true, false)
+		m.Spec.Webhook = &monitoringv1alpha1.WebhookConfig{URL: srv.URL}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{{
+			Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: critical,
+		}}
+		conflicts := 1
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(m).
+			WithStatusSubresource(&monitoringv1alpha1.CertificateMonitor{}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceUpdate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+					if _, ok := obj.(*monitoringv1alpha1.CertificateMonitor); ok && conflicts > 0 {
+						conflicts--
+						return apierrors.NewConflict(monitoringv1alpha1.GroupVersion.WithResource("certificatemonitors").GroupResource(), obj.GetName(), nil)
+					}
+					return c.SubResource(subResourceName).Update(ctx, obj, opts...)
+				},
+			}).Build()
+		r := &CertificateMonitorReconciler{Client: c, changes: newChangeTracker(), certs: newCertCache()}
+
+		_, err := r.applyChanges(ctx, m, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kinds).To(Equal([]string{string(alertTransition)}))
+		Expect(conflicts).To(BeZero())
+
+		stored := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), stored)).To(Succeed())
+		Expect(stored.Status.MonitoredCertificates[0].LastNotifiedStatus).To(Equal(critical))
+
+		// The next reconcile starts from the stored status and sends nothing.
+		_, err = r.applyChanges(ctx, stored, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kinds).To(HaveLen(1))
+	})
+
+	It("returns when a failed reminder is retried", func() {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		m := monitor("prod", true, false)
+		m.Spec.Webhook = &monitoringv1alpha1.WebhookConfig{URL: srv.URL}
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{{
+			Name: certeval.InternalName("shop", "web-tls"), Type: "internal", Path: "shop/web-tls", Namespace: "shop", Status: critical,
+		}}
+		r, _ := reconciler(m)
+
+		retry, err := r.applyChanges(ctx, m, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retry).To(BeTemporally("~", time.Now().Add(queuePolicy().Backoff), time.Minute))
+	})
+
+	It("re-reads the certificates reported on a changed node", func() {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   "cp-1",
+			Labels: map[string]string{"node-role.kubernetes.io/control-plane": ""},
+			Annotations: map[string]string{
+				nodeCertStatusPrefix + "apiserver.crt": "EXPIRING",
+				nodeCertExpiryPrefix + "apiserver.crt": "2030-01-01T00:00:00Z",
+			},
+		}}
+		m := monitor("nodes", false, true)
+		m.Status.MonitoredCertificates = []monitoringv1alpha1.MonitoredCertificateStatus{
+			{Name: "external-cp-1-etcd.crt", Type: "external", Path: "etcd.crt", Node: "cp-1", Status: valid},
+			{Name: "external-cp-2-etcd.crt", Type: "external", Path: "etcd.crt", Node: "cp-2", Status: valid},
+		}
+		r, c := reconciler(m, node)
+
+		updated := node.DeepCopy()
+		updated.Annotations[nodeCertStatusPrefix+"apiserver.crt"] = "CRITICAL"
+		Expect(nodeReportPredicate.Update(event.UpdateEvent{ObjectOld: node, ObjectNew: updated})).To(BeTrue())
+		relabeled := node.DeepCopy()
+		relabeled.Labels["zone"] = "a"
+		Expect(nodeReportPredicate.Update(event.UpdateEvent{ObjectOld: node, ObjectNew: relabeled})).To(BeFalse())
+
+		Expect(r.nodeToMonitors(ctx, node)).To(HaveLen(1))
+		_, err := r.applyChanges(ctx, m, r.changes.take(client.ObjectKeyFromObject(m)))
+		Expect(err).NotTo(HaveOccurred())
+
+		stored := &monitoringv1alpha1.CertificateMonitor{}
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(m), stored)).To(Succeed())
+		var names []string
+		for _, s := range stored.Status.MonitoredCertificates {
+			names = append(names, s.Name)
+		}
+		Expect(names).To(Equal([]string{"external-cp-1-apiserver.crt", "external-cp-2-etcd.crt"}))
+		Expect(stored.Status.MonitoredCertificates[0].Status).To(Equal(expiring))
+	})
+})
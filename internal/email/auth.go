@@ -0,0 +1,69 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// errPlainAuth is returned instead of sending credentials on a connection
+// that is not encrypted, e.g. when a server in starttls mode does not offer
+// STARTTLS.
+var errPlainAuth = errors.New("SMTP server connection is not encrypted, refusing to send credentials")
+
+// tlsAuth authenticates with the strongest mechanism the server offers, the
+// way gomail picks one, but only once the connection is encrypted.
+type tlsAuth struct {
+	username string
+	password string
+	host     string
+	auth     smtp.Auth
+}
+
+// Start implements smtp.Auth.
+func (a *tlsAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errPlainAuth
+	}
+	mechanisms := strings.Join(server.Auth, " ")
+	switch {
+	case strings.Contains(mechanisms, "CRAM-MD5"):
+		a.auth = smtp.CRAMMD5Auth(a.username, a.password)
+	case strings.Contains(mechanisms, "LOGIN") && !strings.Contains(mechanisms, "PLAIN"):
+		a.auth = &loginAuth{username: a.username, password: a.password}
+	default:
+		a.auth = smtp.PlainAuth("", a.username, a.password, a.host)
+	}
+	return a.auth.Start(server)
+}
+
+// Next implements smtp.Auth.
+func (a *tlsAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	return a.auth.Next(fromServer, more)
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(*smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch {
+	case bytes.Equal(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.Equal(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected SMTP server challenge: %s", fromServer)
+	}
+}
@@ -0,0 +1,128 @@
+package email
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strconv"
+)
+
+// TLSMode selects how the connection to the SMTP server is secured.
+type TLSMode string
+
+const (
+	// TLSModeStartTLS upgrades a plain connection when the server offers
+	// STARTTLS. This is the default and what MailHog expects. Credentials are
+	// only sent once the connection is encrypted, so a server without
+	// STARTTLS is refused when a username is set.
+	TLSModeStartTLS TLSMode = "starttls"
+	// TLSModeImplicit opens a TLS connection from the start (usually port 465).
+	TLSModeImplicit TLSMode = "tls"
+)
+
+// Keys read from the referenced ConfigMap/Secret data.
+const (
+	HostKey               = "host"
+	PortKey               = "port"
+	FromKey               = "from"
+	UsernameKey           = "username"
+	PasswordKey           = "password"
+	TLSKey                = "tls"
+	CAKey                 = "ca.crt"
+	InsecureSkipVerifyKey = "insecureSkipVerify"
+)
+
+// Config describes the SMTP transport.
+type Config struct {
+	Host     string
+	Port     int
+	From     string
+	Username string
+	Password string
+	TLS      TLSMode
+	// CAData is a PEM bundle used to verify the server instead of the
+	// system roots.
+	CAData             []byte
+	InsecureSkipVerify bool
+}
+
+// DefaultConfig is the in-cluster MailHog test server.
+func DefaultConfig() Config {
+	return Config{
+		Host: "mailhog-service",
+		Port: 1025, // SMTP port (MailHog default)
+		From: "no-reply@example.com",
+		TLS:  TLSModeStartTLS,
+	}
+}
+
+// ConfigFromData overlays the keys present in data on top of DefaultConfig.
+// Credentials and the CA are usually kept in a Secret and the rest in a
+// ConfigMap; the caller merges both into data.
+func ConfigFromData(data map[string][]byte) (Config, error) {
+	cfg := DefaultConfig()
+	if v, ok := data[HostKey]; ok {
+		cfg.Host = string(v)
+	}
+	if v, ok := data[PortKey]; ok {
+		port, err := strconv.Atoi(string(v))
+		if err != nil || port <= 0 || port > 65535 {
+			return Config{}, fmt.Errorf("invalid SMTP port %q", v)
+		}
+		cfg.Port = port
+	}
+	if v, ok := data[FromKey]; ok {
+		cfg.From = string(v)
+	}
+	if v, ok := data[UsernameKey]; ok {
+		cfg.Username = string(v)
+	}
+	if v, ok := data[PasswordKey]; ok {
+		cfg.Password = string(v)
+	}
+	if v, ok := data[TLSKey]; ok {
+		cfg.TLS = TLSMode(v)
+	}
+	if v, ok := data[CAKey]; ok {
+		cfg.CAData = v
+	}
+	if v, ok := data[InsecureSkipVerifyKey]; ok {
+		skip, err := strconv.ParseBool(string(v))
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q", InsecureSkipVerifyKey, v)
+		}
+		cfg.InsecureSkipVerify = skip
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the configuration is usable.
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("SMTP host is required")
+	}
+	if c.From == "" {
+		return fmt.Errorf("SMTP sender address is required")
+	}
+	switch c.TLS {
+	case TLSModeStartTLS, TLSModeImplicit:
+	default:
+		return fmt.Errorf("unknown SMTP tls mode %q, expected %q or %q", c.TLS, TLSModeStartTLS, TLSModeImplicit)
+	}
+	if c.Password != "" && c.Username == "" {
+		return fmt.Errorf("SMTP password set without username")
+	}
+	return nil
+}
+
+func (c Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.InsecureSkipVerify} //nolint:gosec
+	if len(c.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CAData) {
+			return nil, fmt.Errorf("no certificates found in SMTP CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,104 @@
+package email
+
+import (
+	"net/smtp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	DescribeTable("parses the ConfigMap and Secret data",
+		func(data map[string]string, want Config) {
+			raw := map[string][]byte{}
+			for k, v := range data {
+				raw[k] = []byte(v)
+			}
+			cfg, err := ConfigFromData(raw)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg).To(Equal(want))
+		},
+		Entry("defaults", map[string]string{}, DefaultConfig()),
+		Entry("every key",
+			map[string]string{
+				HostKey: "smtp.example.com", PortKey: "465", FromKey: "certs@example.com",
+				UsernameKey: "certs", PasswordKey: "s3cret", TLSKey: "tls",
+				CAKey: "ca", InsecureSkipVerifyKey: "true",
+			},
+			Config{
+				Host: "smtp.example.com", Port: 465, From: "certs@example.com",
+				Username: "certs", Password: "s3cret", TLS: TLSModeImplicit,
+				CAData: []byte("ca"), InsecureSkipVerify: true,
+			}),
+		Entry("starttls with credentials",
+			map[string]string{HostKey: "smtp.example.com", PortKey: "587", UsernameKey: "certs", PasswordKey: "s3cret"},
+			Config{Host: "smtp.example.com", Port: 587, From: "no-reply@example.com", Username: "certs", Password: "s3cret", TLS: TLSModeStartTLS}),
+	)
+
+	DescribeTable("rejects invalid data",
+		func(data map[string]string, message string) {
+			raw := map[string][]byte{}
+			for k, v := range data {
+				raw[k] = []byte(v)
+			}
+			_, err := ConfigFromData(raw)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("port not a number", map[string]string{PortKey: "smtp"}, "invalid SMTP port"),
+		Entry("port out of range", map[string]string{PortKey: "70000"}, "invalid SMTP port"),
+		Entry("empty host", map[string]string{HostKey: ""}, "SMTP host is required"),
+		Entry("empty sender", map[string]string{FromKey: ""}, "SMTP sender address is required"),
+		Entry("unknown tls mode", map[string]string{TLSKey: "ssl"}, "unknown SMTP tls mode"),
+		Entry("password without username", map[string]string{PasswordKey: "s3cret"}, "SMTP password set without username"),
+		Entry("bad insecureSkipVerify", map[string]string{InsecureSkipVerifyKey: "maybe"}, "invalid insecureSkipVerify"),
+	)
+
+	It("rejects a CA bundle without certificates", func() {
+		cfg := DefaultConfig()
+		cfg.CAData = []byte("not a certificate")
+		_, err := NewSender(cfg)
+		Expect(err).To(MatchError(ContainSubstring("no certificates found")))
+	})
+})
+
+var _ = Describe("SMTP authentication", func() {
+	auth := func() *tlsAuth {
+		return &tlsAuth{username: "certs", password: "s3cret", host: "smtp.example.com"}
+	}
+
+	It("is only set up when a username is configured", func() {
+		s, err := NewSender(DefaultConfig())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.dialer.Auth).To(BeNil())
+
+		cfg := DefaultConfig()
+		cfg.Username, cfg.Password = "certs", "s3cret"
+		s, err = NewSender(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.dialer.Auth).To(BeAssignableToTypeOf(&tlsAuth{}))
+	})
+
+	It("refuses to send credentials on a plain connection", func() {
+		_, _, err := auth().Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: false, Auth: []string{"LOGIN", "PLAIN"}})
+		Expect(err).To(MatchError(errPlainAuth))
+	})
+
+	DescribeTable("picks the mechanism offered over TLS",
+		func(offered []string, mechanism string) {
+			proto, _, err := auth().Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: offered})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proto).To(Equal(mechanism))
+		},
+		Entry("CRAM-MD5 first", []string{"PLAIN", "CRAM-MD5"}, "CRAM-MD5"),
+		Entry("PLAIN over LOGIN", []string{"LOGIN", "PLAIN"}, "PLAIN"),
+		Entry("LOGIN alone", []string{"LOGIN"}, "LOGIN"),
+	)
+
+	It("answers the LOGIN challenges", func() {
+		a := &loginAuth{username: "certs", password: "s3cret"}
+		Expect(a.Next([]byte("Username:"), true)).To(Equal([]byte("certs")))
+		Expect(a.Next([]byte("Password:"), true)).To(Equal([]byte("s3cret")))
+		_, err := a.Next([]byte("Token:"), true)
+		Expect(err).To(HaveOccurred())
+	})
+})
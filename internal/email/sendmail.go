@@ -1,30 +1,145 @@
 package email
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/textproto"
 
 	"gopkg.in/gomail.v2"
 )
 
-func SendMail(subject, body, recipient string) error {
-	// Internal SMTP server details
-	// smtpHost := "mailhog-service.default.svc.cluster.local" // Internal mail server service
-	smtpHost := "mailhog-service"
-	smtpPort := 1025 // SMTP port (MailHog default)
+// Sender delivers mails through one SMTP server. The connection is opened on
+// the first message and reused for the following ones until Close, so a batch
+// of notifications costs a single dial and authentication.
+type Sender struct {
+	from   string
+	dialer *gomail.Dialer
+	conn   *session
+}
+
+// NewSender builds a Sender for the given transport configuration.
+func NewSender(cfg Config) (*Sender, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	d := gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
+	d.SSL = cfg.TLS == TLSModeImplicit
+	d.TLSConfig = tlsConfig
+	if cfg.Username != "" {
+		// gomail would authenticate on a plain connection when the server
+		// does not offer STARTTLS, leaking the credentials.
+		d.Auth = &tlsAuth{username: cfg.Username, password: cfg.Password, host: cfg.Host}
+	}
+	return &Sender{from: cfg.From, dialer: d}, nil
+}
+
+// Message is a mail to a single recipient. HTML is optional; when set the
+// mail is sent as multipart/alternative with Text as the plain part.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Send mails a plain text message to a single recipient.
+func (s *Sender) Send(subject, body, recipient string) error {
+	return s.SendMessage(Message{To: recipient, Subject: subject, Text: body})
+}
 
+// SendMessage mails a message, adding the HTML alternative when present.
+func (s *Sender) SendMessage(msg Message) error {
 	// Create the email
 	m := gomail.NewMessage()
-	m.SetHeader("From", "no-reply@example.com") // Sender address
-	m.SetHeader("To", recipient)                // Recipient address
-	m.SetHeader("Subject", subject)             // Email subject
-	m.SetBody("text/plain", body)               // Email body
-
-	// Set up the SMTP server
-	d := gomail.NewDialer(smtpHost, smtpPort, "", "") // No authentication required for MailHog
+	m.SetHeader("From", s.from)         // Sender address
+	m.SetHeader("To", msg.To)           // Recipient address
+	m.SetHeader("Subject", msg.Subject) // Email subject
+	m.SetBody("text/plain", msg.Text)   // Email body
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
 
-	// Send the email
-	if err := d.DialAndSend(m); err != nil {
+	if err := s.send(m); err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 	return nil
 }
+
+// send writes the message on the open connection. A connection the server
+// dropped in the meantime is redialled once. Any other failure is returned
+// as is, so a rejected message is not sent twice; the session is still
+// closed, as the server may be left in the middle of the transaction.
+func (s *Sender) send(m *gomail.Message) error {
+	if s.conn != nil {
+		err := gomail.Send(s.conn, m)
+		if err == nil {
+			return nil
+		}
+		lost := connectionLost(s.conn.err)
+		_ = s.Close()
+		if !lost {
+			return err
+		}
+	}
+
+	conn, err := s.dialer.Dial()
+	if err != nil {
+		return err
+	}
+	s.conn = &session{SendCloser: conn}
+	err = gomail.Send(s.conn, m)
+	if err != nil {
+		_ = s.Close()
+	}
+	return err
+}
+
+// session is an open SMTP connection. It keeps the error of the last send,
+// which gomail only returns formatted.
+type session struct {
+	gomail.SendCloser
+	err error
+}
+
+func (c *session) Send(from string, to []string, msg io.WriterTo) error {
+	c.err = c.SendCloser.Send(from, to, msg)
+	return c.err
+}
+
+// connectionLost reports whether a send failed because the server closed the
+// connection, rather than because it rejected the message.
+func connectionLost(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code == 421
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+// Close ends the SMTP session, if one is open.
+func (s *Sender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// SendMail sends a single message through the default MailHog transport.
+func SendMail(subject, body, recipient string) error {
+	s, err := NewSender(DefaultConfig())
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return s.Send(subject, body, recipient)
+}
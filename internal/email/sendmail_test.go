@@ -0,0 +1,72 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/gomail.v2"
+)
+
+// fakeConn fails every send with err.
+type fakeConn struct {
+	err    error
+	sends  int
+	closed bool
+}
+
+func (c *fakeConn) Send(string, []string, io.WriterTo) error {
+	c.sends++
+	return c.err
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+var _ = Describe("Sender", func() {
+	// Nothing listens on the port, so a redial fails with a dial error.
+	sender := func(conn *fakeConn) *Sender {
+		return &Sender{from: "certs@example.com", dialer: gomail.NewDialer("127.0.0.1", 1, "", ""), conn: &session{SendCloser: conn}}
+	}
+	message := func() *gomail.Message {
+		m := gomail.NewMessage()
+		m.SetHeader("From", "certs@example.com")
+		m.SetHeader("To", "ops@example.com")
+		return m
+	}
+
+	It("returns a rejection without sending the message again", func() {
+		conn := &fakeConn{err: &textproto.Error{Code: 550, Msg: "mailbox unavailable"}}
+		s := sender(conn)
+		Expect(s.send(message())).To(MatchError(ContainSubstring("mailbox unavailable")))
+		Expect(conn.sends).To(Equal(1))
+		Expect(conn.closed).To(BeTrue())
+		Expect(s.conn).To(BeNil())
+	})
+
+	It("redials a connection the server dropped", func() {
+		conn := &fakeConn{err: io.EOF}
+		s := sender(conn)
+		err := s.send(message())
+		var opErr *net.OpError
+		Expect(errors.As(err, &opErr)).To(BeTrue())
+		Expect(opErr.Op).To(Equal("dial"))
+		Expect(conn.sends).To(Equal(1))
+	})
+
+	DescribeTable("tells a dropped connection from a rejection",
+		func(err error, lost bool) {
+			Expect(connectionLost(err)).To(Equal(lost))
+		},
+		Entry("EOF", io.EOF, true),
+		Entry("closed connection", net.ErrClosed, true),
+		Entry("service closing", &textproto.Error{Code: 421, Msg: "closing"}, true),
+		Entry("rejected recipient", &textproto.Error{Code: 550, Msg: "no such user"}, false),
+		Entry("other error", errors.New("boom"), false),
+	)
+})
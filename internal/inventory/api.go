@@ -0,0 +1,186 @@
+package inventory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/report"
+)
+
+const (
+	apiPrefix = "/api/v1/certificates"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// The API is read-only JSON, served under /api/v1 when enabled:
+//
+//	GET /api/v1/certificates         the certificates, filtered like the page
+//	GET /api/v1/certificates/{name}  one certificate, of the namespace given
+//	                                 with ?namespace=, or of a node without it
+//
+// Callers authenticate like on the other routes, and only see the
+// certificates of the namespaces they may get or list certificates in.
+
+// Certificate is a certificate of the API. It only carries the inventory
+// fields of a status entry, not the notification state of the controller.
+type Certificate struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Path      string `json:"path"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Status    string `json:"status"`
+	Expiry    string `json:"expiry,omitempty"`
+	// DaysRemaining is the number of whole days until expiry, negative once
+	// expired.
+	DaysRemaining *int                                   `json:"daysRemaining,omitempty"`
+	Subject       string                                 `json:"subject,omitempty"`
+	Issuer        string                                 `json:"issuer,omitempty"`
+	ManagedBy     string                                 `json:"managedBy,omitempty"`
+	Owner         string                                 `json:"owner,omitempty"`
+	UsedBy        []monitoringv1alpha1.WorkloadReference `json:"usedBy,omitempty"`
+}
+
+// CertificateList is a page of certificates.
+type CertificateList struct {
+	Items []Certificate `json:"items"`
+	// Total is the number of certificates matching the request, across all
+	// pages.
+	Total int `json:"total"`
+	// Continue is passed back as the continue parameter to get the next page,
+	// empty on the last one.
+	Continue string `json:"continue,omitempty"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, apiError{Error: msg})
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, apiPrefix), "/")
+	if name != "" {
+		s.getCertificate(w, req, name)
+		return
+	}
+	certs, filter, ok := s.load(w, req, writeError)
+	if !ok {
+		return
+	}
+	s.listCertificates(w, req, certs, filter)
+}
+
+func (s *Server) getCertificate(w http.ResponseWriter, req *http.Request, name string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	user, ok := s.authenticate(w, req, writeError)
+	if !ok {
+		return
+	}
+	// The namespace is authorized before the lookup, so callers cannot tell
+	// the certificates of other namespaces exist.
+	namespace := req.URL.Query().Get("namespace")
+	if err := s.authorize(req.Context(), user, "get", namespace); err != nil {
+		s.failAuthorization(w, req, writeError, err)
+		return
+	}
+	certs, err := s.Source(req.Context())
+	if err != nil {
+		log.FromContext(req.Context()).Error(err, "unable to read certificates")
+		writeError(w, http.StatusInternalServerError, "unable to read certificates")
+		return
+	}
+	i := slices.IndexFunc(certs, func(c monitoringv1alpha1.MonitoredCertificateStatus) bool {
+		return c.Name == name && c.Namespace == namespace
+	})
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "certificate not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.apiCertificate(certs[i], s.now()))
+}
+
+func (s *Server) listCertificates(w http.ResponseWriter, req *http.Request, certs []monitoringv1alpha1.MonitoredCertificateStatus, filter Filter) {
+	q := req.URL.Query()
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			writeError(w, http.StatusBadRequest, "limit must be a number between 1 and "+strconv.Itoa(maxPageSize))
+			return
+		}
+	}
+	after := ""
+	if v := q.Get("continue"); v != "" {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid continue token")
+			return
+		}
+		after = string(b)
+	}
+
+	now := s.now()
+	matched := filter.Apply(certs, now)
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+
+	list := CertificateList{Items: []Certificate{}, Total: len(matched)}
+	start := sort.Search(len(matched), func(i int) bool { return matched[i].Name > after })
+	if after == "" {
+		start = 0
+	}
+	end := min(start+limit, len(matched))
+	for _, c := range matched[start:end] {
+		list.Items = append(list.Items, s.apiCertificate(c, now))
+	}
+	if end < len(matched) {
+		list.Continue = base64.RawURLEncoding.EncodeToString([]byte(matched[end-1].Name))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) apiCertificate(c monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) Certificate {
+	out := Certificate{
+		Name:      c.Name,
+		Type:      c.Type,
+		Path:      c.Path,
+		Namespace: c.Namespace,
+		Node:      c.Node,
+		Status:    c.Status,
+		Expiry:    c.Expiry,
+		Subject:   c.Subject,
+		Issuer:    c.Issuer,
+		ManagedBy: c.ManagedBy,
+		Owner:     c.Owner,
+		UsedBy:    c.UsedBy,
+	}
+	if days, ok := report.DaysRemaining(c, now); ok {
+		out.DaysRemaining = &days
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// namespaceAuthorizer allows the namespaces listed for each user.
+type namespaceAuthorizer map[string][]string
+
+func (a namespaceAuthorizer) Authorize(_ context.Context, user *User, _, namespace string) (bool, error) {
+	for _, ns := range a[user.Name] {
+		if ns == namespace {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var _ = Describe("API", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	certs := []monitoringv1alpha1.MonitoredCertificateStatus{
+		{Name: "internal-shop-web", Type: "internal", Path: "shop/web", Namespace: "shop", Status: "expiring", Expiry: "2024-06-11T12:00:00Z",
+			LastNotifiedStatus: "expiring", LastNotified: &metav1.Time{Time: now.Add(-time.Hour)}},
+		{Name: "internal-shop-api", Type: "internal", Path: "shop/api", Namespace: "shop", Status: "valid", Expiry: "2025-06-01T12:00:00Z"},
+		{Name: "internal-shop-db", Type: "internal", Path: "shop/db", Namespace: "shop", Status: "error"},
+		{Name: "internal-pay-db", Type: "internal", Path: "pay/db", Namespace: "pay", Status: "expired", Expiry: "2024-05-30T12:00:00Z"},
+		{Name: "external-cp1-/etc/kubernetes/pki/ca.crt", Type: "external", Path: "/etc/kubernetes/pki/ca.crt", Node: "cp1", Status: "critical", Expiry: "2024-06-04T12:00:00Z"},
+	}
+	tokens := &StaticTokens{tokens: map[string]*User{
+		"shop-token":  {Name: "shop-reader"},
+		"admin-token": {Name: "admin"},
+	}}
+	server := &Server{
+		Source:        func(context.Context) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) { return certs, nil },
+		Authenticator: tokens,
+		Authorizer:    namespaceAuthorizer{"shop-reader": {"shop"}, "admin": {"shop", "pay", ""}},
+		EnableAPI:     true,
+		Now:           func() time.Time { return now },
+	}
+	get := func(url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(url, token string) CertificateList {
+		rec := get(url, token)
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		var l CertificateList
+		Expect(json.Unmarshal(rec.Body.Bytes(), &l)).To(Succeed())
+		return l
+	}
+	names := func(l CertificateList) []string {
+		var out []string
+		for _, c := range l.Items {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+
+	It("is only served when configured", func() {
+		plain := &Server{Source: server.Source, SkipAuth: true}
+		rec := httptest.NewRecorder()
+		plain.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/certificates", nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("requires a known bearer token on every route", func() {
+		rec := get("/api/v1/certificates", "")
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		Expect(rec.Header().Get("WWW-Authenticate")).To(HavePrefix("Bearer"))
+		Expect(rec.Body.String()).To(ContainSubstring(`"error"`))
+		Expect(get("/api/v1/certificates", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(get("/api/v1/certificates/internal-shop-web", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(get("/", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(get("/report", "wrong").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("shows the page and reports of the namespaces the caller may read", func() {
+		rec := get("/", "shop-token")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("Showing 3 of 3 certificates"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("internal-pay-db"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring(`<option value="pay"`))
+
+		rec = get("/report?format=json", "shop-token")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("internal-shop-web"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("internal-pay-db"))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("cp1"))
+
+		Expect(get("/?namespace=pay", "shop-token").Code).To(Equal(http.StatusForbidden))
+		Expect(get("/report?namespace=pay", "shop-token").Code).To(Equal(http.StatusForbidden))
+		Expect(get("/report?namespace=pay", "admin-token").Code).To(Equal(http.StatusOK))
+	})
+
+	It("lists the certificates of the namespaces the caller may read", func() {
+		Expect(names(list("/api/v1/certificates", "shop-token"))).To(Equal([]string{"internal-shop-api", "internal-shop-db", "internal-shop-web"}))
+		Expect(names(list("/api/v1/certificates", "admin-token"))).To(HaveLen(5))
+
+		l := list("/api/v1/certificates?status=expiring,expired", "admin-token")
+		Expect(names(l)).To(Equal([]string{"internal-pay-db", "internal-shop-web"}))
+		Expect(*l.Items[0].DaysRemaining).To(Equal(-2))
+		Expect(l.Items[0].Namespace).To(Equal("pay"))
+	})
+
+	It("leaves the notification state out", func() {
+		rec := get("/api/v1/certificates/internal-shop-web?namespace=shop", "shop-token")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`"daysRemaining": 10`))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("lastNotified"))
+	})
+
+	It("forbids namespaces asked for explicitly", func() {
+		rec := get("/api/v1/certificates?namespace=pay", "shop-token")
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring(`cannot list certificates in namespace \"pay\"`))
+	})
+
+	It("pages through the certificates", func() {
+		first := list("/api/v1/certificates?limit=2", "admin-token")
+		Expect(first.Total).To(Equal(5))
+		Expect(names(first)).To(Equal([]string{"external-cp1-/etc/kubernetes/pki/ca.crt", "internal-pay-db"}))
+		Expect(first.Continue).NotTo(BeEmpty())
+
+		second := list("/api/v1/certificates?limit=2&continue="+first.Continue, "admin-token")
+		Expect(names(second)).To(Equal([]string{"internal-shop-api", "internal-shop-db"}))
+		third := list("/api/v1/certificates?limit=2&continue="+second.Continue, "admin-token")
+		Expect(names(third)).To(Equal([]string{"internal-shop-web"}))
+		Expect(third.Continue).To(BeEmpty())
+
+		Expect(get("/api/v1/certificates?limit=0", "admin-token").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/api/v1/certificates?continue=!", "admin-token").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("gets a single certificate", func() {
+		rec := get("/api/v1/certificates/external-cp1-/etc/kubernetes/pki/ca.crt", "admin-token")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var c Certificate
+		Expect(json.Unmarshal(rec.Body.Bytes(), &c)).To(Succeed())
+		Expect(c.Node).To(Equal("cp1"))
+		Expect(*c.DaysRemaining).To(Equal(3))
+
+		rec = get("/api/v1/certificates/internal-shop-web?namespace=shop", "shop-token")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(get("/api/v1/certificates/internal-shop-web", "admin-token").Code).To(Equal(http.StatusNotFound))
+		Expect(get("/api/v1/certificates/missing?namespace=shop", "admin-token").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("authorizes the namespace before looking the certificate up", func() {
+		// Existing and missing certificates of a forbidden namespace look alike.
+		for _, name := range []string{"internal-pay-db", "missing"} {
+			rec := get("/api/v1/certificates/"+name+"?namespace=pay", "shop-token")
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(rec.Body.String()).To(ContainSubstring(`cannot get certificates in namespace \"pay\"`))
+		}
+		Expect(get("/api/v1/certificates/external-cp1-/etc/kubernetes/pki/ca.crt", "shop-token").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("loads token files", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "tokens")
+		Expect(os.WriteFile(path, []byte("# readers\nabc, alice, team-a, team-b\n\ndef,bob\n"), 0o600)).To(Succeed())
+		tokens, err := LoadTokenFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		user, err := tokens.Authenticate(context.Background(), "abc")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal(&User{Name: "alice", Groups: []string{"team-a", "team-b"}}))
+		Expect(tokens.Authenticate(context.Background(), "xyz")).To(BeNil())
+
+		Expect(os.WriteFile(path, []byte("abc\n"), 0o600)).To(Succeed())
+		_, err = LoadTokenFile(path)
+		Expect(err).To(MatchError(ContainSubstring(":1: expected token,user")))
+		Expect(os.WriteFile(path, []byte("abc,alice\nabc,bob\n"), 0o600)).To(Succeed())
+		_, err = LoadTokenFile(path)
+		Expect(err).To(MatchError(ContainSubstring(":2: duplicate token")))
+	})
+
+	It("reviews tokens and access with the API server", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		reviews := 0
+		c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+				switch review := obj.(type) {
+				case *authenticationv1.TokenReview:
+					if review.Spec.Token == "sa-token" {
+						review.Status.Authenticated = true
+						review.Status.User = authenticationv1.UserInfo{Username: "system:serviceaccount:tools:reader", Groups: []string{"system:serviceaccounts"}}
+					}
+				case *authorizationv1.SubjectAccessReview:
+					reviews++
+					attrs := review.Spec.ResourceAttributes
+					review.Status.Allowed = review.Spec.User == "system:serviceaccount:tools:reader" &&
+						attrs.Group == "monitoring.egarciam.com" && attrs.Resource == "certificates" && attrs.Namespace == "shop"
+				}
+				return nil
+			},
+		}).Build()
+
+		user, err := (&TokenReviewer{Client: c}).Authenticate(context.Background(), "sa-token")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.Name).To(Equal("system:serviceaccount:tools:reader"))
+		Expect((&TokenReviewer{Client: c}).Authenticate(context.Background(), "other")).To(BeNil())
+
+		sar := &SubjectAccessReviewer{Client: c}
+		Expect(sar.Authorize(context.Background(), user, "list", "shop")).To(BeTrue())
+		Expect(sar.Authorize(context.Background(), user, "list", "shop")).To(BeTrue())
+		Expect(sar.Authorize(context.Background(), user, "list", "pay")).To(BeFalse())
+		Expect(reviews).To(Equal(2))
+	})
+})
@@ -0,0 +1,294 @@
+package inventory
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// User is an authenticated API caller.
+type User struct {
+	Name   string
+	UID    string
+	Groups []string
+	Extra  map[string]authorizationv1.ExtraValue
+}
+
+// Authenticator identifies the caller presenting a bearer token. It returns
+// nil when the token is not known to it.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*User, error)
+}
+
+// Authorizer decides whether a user may perform a verb on the certificates of
+// a namespace. An empty namespace stands for the certificates of nodes, which
+// belong to no namespace.
+type Authorizer interface {
+	Authorize(ctx context.Context, user *User, verb, namespace string) (bool, error)
+}
+
+// authenticate identifies the caller, answering the request when it cannot.
+// The user is nil when authentication is skipped.
+func (s *Server) authenticate(w http.ResponseWriter, req *http.Request, fail errorWriter) (*User, bool) {
+	if s.SkipAuth {
+		return nil, true
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="certificates"`)
+		fail(w, http.StatusUnauthorized, "a bearer token is required")
+		return nil, false
+	}
+	user, err := s.Authenticator.Authenticate(req.Context(), strings.TrimSpace(token))
+	if err != nil {
+		log.FromContext(req.Context()).Error(err, "unable to authenticate inventory request")
+		fail(w, http.StatusInternalServerError, "unable to authenticate")
+		return nil, false
+	}
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="certificates", error="invalid_token"`)
+		fail(w, http.StatusUnauthorized, "invalid bearer token")
+		return nil, false
+	}
+	return user, true
+}
+
+// forbiddenError is returned when a user may not read the certificates of a
+// namespace.
+type forbiddenError struct {
+	user      *User
+	verb      string
+	namespace string
+}
+
+// Error explains a denied request like the API server does.
+func (e *forbiddenError) Error() string {
+	if e.namespace == "" {
+		return "user \"" + e.user.Name + "\" cannot " + e.verb + " the certificates of nodes"
+	}
+	return "user \"" + e.user.Name + "\" cannot " + e.verb + " certificates in namespace \"" + e.namespace + "\""
+}
+
+// authorize returns a forbiddenError when the user may not perform verb on
+// the certificates of namespace. A nil user skipped authentication.
+func (s *Server) authorize(ctx context.Context, user *User, verb, namespace string) error {
+	if user == nil {
+		return nil
+	}
+	allowed, err := s.Authorizer.Authorize(ctx, user, verb, namespace)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &forbiddenError{user: user, verb: verb, namespace: namespace}
+	}
+	return nil
+}
+
+// visible returns the certificates of the namespaces the user may list. The
+// namespaces a request asks for explicitly have to be readable; others are
+// left out quietly.
+func (s *Server) visible(ctx context.Context, user *User, certs []monitoringv1alpha1.MonitoredCertificateStatus, requested []string) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) {
+	if user == nil {
+		return certs, nil
+	}
+	for _, ns := range requested {
+		if err := s.authorize(ctx, user, "list", ns); err != nil {
+			return nil, err
+		}
+	}
+	decisions := map[string]bool{}
+	var out []monitoringv1alpha1.MonitoredCertificateStatus
+	for _, c := range certs {
+		allowed, ok := decisions[c.Namespace]
+		if !ok {
+			err := s.authorize(ctx, user, "list", c.Namespace)
+			var denied *forbiddenError
+			if err != nil && !errors.As(err, &denied) {
+				return nil, err
+			}
+			allowed = err == nil
+			decisions[c.Namespace] = allowed
+		}
+		if allowed {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// failAuthorization answers a request whose authorization failed.
+func (s *Server) failAuthorization(w http.ResponseWriter, req *http.Request, fail errorWriter, err error) {
+	var denied *forbiddenError
+	if errors.As(err, &denied) {
+		fail(w, http.StatusForbidden, denied.Error())
+		return
+	}
+	log.FromContext(req.Context()).Error(err, "unable to authorize inventory request")
+	fail(w, http.StatusInternalServerError, "unable to authorize")
+}
+
+// Authenticators tries each authenticator in turn.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(ctx context.Context, token string) (*User, error) {
+	for _, auth := range a {
+		user, err := auth.Authenticate(ctx, token)
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+	return nil, nil
+}
+
+// StaticTokens authenticates the tokens of a token file.
+type StaticTokens struct {
+	tokens map[string]*User
+}
+
+// LoadTokenFile reads a token file: one "token,user[,group...]" line per
+// caller. Blank lines and lines starting with # are ignored.
+func LoadTokenFile(path string) (*StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &StaticTokens{tokens: map[string]*User{}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if len(fields) < 2 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("%s:%d: expected token,user[,group...]", path, n)
+		}
+		if _, ok := s.tokens[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate token", path, n)
+		}
+		s.tokens[fields[0]] = &User{Name: fields[1], Groups: fields[2:]}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *StaticTokens) Authenticate(_ context.Context, token string) (*User, error) {
+	for t, user := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+// TokenReviewer authenticates Kubernetes tokens, such as service account
+// tokens, with a TokenReview.
+type TokenReviewer struct {
+	Client client.Client
+	// Audiences the token must be issued for. Empty accepts the audiences
+	// of the API server.
+	Audiences []string
+}
+
+func (t *TokenReviewer) Authenticate(ctx context.Context, token string) (*User, error) {
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: t.Audiences}}
+	if err := t.Client.Create(ctx, review); err != nil {
+		return nil, fmt.Errorf("unable to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+	info := review.Status.User
+	user := &User{Name: info.Username, UID: info.UID, Groups: info.Groups}
+	if len(info.Extra) > 0 {
+		user.Extra = map[string]authorizationv1.ExtraValue{}
+		for k, v := range info.Extra {
+			user.Extra[k] = authorizationv1.ExtraValue(v)
+		}
+	}
+	return user, nil
+}
+
+// certificatesResource is the resource checked by SubjectAccessReviews. It is
+// not served by the API server, so it only exists in RBAC rules.
+const certificatesResource = "certificates"
+
+// accessReviewTTL is how long a SubjectAccessReview decision is reused.
+const accessReviewTTL = 30 * time.Second
+
+// SubjectAccessReviewer authorizes with a SubjectAccessReview on the
+// "certificates" resource of the monitoring group, in the namespace of the
+// certificates. Decisions are cached briefly.
+type SubjectAccessReviewer struct {
+	Client client.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedDecision
+}
+
+type cachedDecision struct {
+	allowed bool
+	expires time.Time
+}
+
+func (s *SubjectAccessReviewer) Authorize(ctx context.Context, user *User, verb, namespace string) (bool, error) {
+	key := strings.Join([]string{user.Name, user.UID, strings.Join(user.Groups, ","), verb, namespace}, "\x00")
+	now := time.Now()
+	s.mu.Lock()
+	if d, ok := s.cache[key]; ok && now.Before(d.expires) {
+		s.mu.Unlock()
+		return d.allowed, nil
+	}
+	s.mu.Unlock()
+
+	review := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		User:   user.Name,
+		UID:    user.UID,
+		Groups: user.Groups,
+		Extra:  user.Extra,
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      verb,
+			Group:     monitoringv1alpha1.GroupVersion.Group,
+			Resource:  certificatesResource,
+		},
+	}}
+	if err := s.Client.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("unable to review access: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache == nil {
+		s.cache = map[string]cachedDecision{}
+	}
+	for k, d := range s.cache {
+		if !now.Before(d.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = cachedDecision{allowed: review.Status.Allowed, expires: now.Add(accessReviewTTL)}
+	return review.Status.Allowed, nil
+}
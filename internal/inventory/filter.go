@@ -0,0 +1,136 @@
+package inventory
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/report"
+)
+
+// Filter selects certificates of the inventory. Zero fields match
+// everything.
+type Filter struct {
+	// Namespaces keeps the certificates of these namespaces.
+	Namespaces []string
+	// Statuses keeps the certificates in one of these statuses.
+	Statuses []string
+	// Owners keeps the certificates of these owners.
+	Owners []string
+	// Issuer keeps the certificates whose issuer contains it, ignoring case.
+	Issuer string
+	// MinDays and MaxDays bound the days remaining until expiry, inclusive.
+	// Certificates of unknown expiry only match when both are unset.
+	MinDays *int
+	MaxDays *int
+}
+
+// ParseFilter reads a filter from query parameters: namespace, status and
+// owner, repeatable or comma separated, issuer, minDays and maxDays.
+func ParseFilter(q url.Values) (Filter, error) {
+	f := Filter{
+		Namespaces: listParam(q, "namespace"),
+		Statuses:   listParam(q, "status"),
+		Owners:     listParam(q, "owner"),
+		Issuer:     strings.TrimSpace(q.Get("issuer")),
+	}
+	var err error
+	if f.MinDays, err = intParam(q, "minDays"); err != nil {
+		return Filter{}, err
+	}
+	if f.MaxDays, err = intParam(q, "maxDays"); err != nil {
+		return Filter{}, err
+	}
+	if f.MinDays != nil && f.MaxDays != nil && *f.MinDays > *f.MaxDays {
+		return Filter{}, fmt.Errorf("minDays %d is greater than maxDays %d", *f.MinDays, *f.MaxDays)
+	}
+	return f, nil
+}
+
+// listParam collects the values of a repeatable, comma separated parameter.
+func listParam(q url.Values, key string) []string {
+	var out []string
+	for _, v := range q[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func intParam(q url.Values, key string) (*int, error) {
+	v := strings.TrimSpace(q.Get(key))
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q, expected a number of days", key, v)
+	}
+	return &n, nil
+}
+
+// Query encodes the filter as query parameters, the inverse of ParseFilter.
+func (f Filter) Query() url.Values {
+	q := url.Values{}
+	for _, ns := range f.Namespaces {
+		q.Add("namespace", ns)
+	}
+	for _, s := range f.Statuses {
+		q.Add("status", s)
+	}
+	for _, o := range f.Owners {
+		q.Add("owner", o)
+	}
+	if f.Issuer != "" {
+		q.Set("issuer", f.Issuer)
+	}
+	if f.MinDays != nil {
+		q.Set("minDays", strconv.Itoa(*f.MinDays))
+	}
+	if f.MaxDays != nil {
+		q.Set("maxDays", strconv.Itoa(*f.MaxDays))
+	}
+	return q
+}
+
+// Matches reports whether a certificate passes the filter at the given time.
+func (f Filter) Matches(c monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) bool {
+	if len(f.Namespaces) > 0 && !slices.Contains(f.Namespaces, c.Namespace) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, c.Status) {
+		return false
+	}
+	if len(f.Owners) > 0 && !slices.Contains(f.Owners, c.Owner) {
+		return false
+	}
+	if f.Issuer != "" && !strings.Contains(strings.ToLower(c.Issuer), strings.ToLower(f.Issuer)) {
+		return false
+	}
+	if f.MinDays == nil && f.MaxDays == nil {
+		return true
+	}
+	days, ok := report.DaysRemaining(c, now)
+	if !ok {
+		return false
+	}
+	return (f.MinDays == nil || days >= *f.MinDays) && (f.MaxDays == nil || days <= *f.MaxDays)
+}
+
+// Apply returns the certificates passing the filter.
+func (f Filter) Apply(certs []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) []monitoringv1alpha1.MonitoredCertificateStatus {
+	var out []monitoringv1alpha1.MonitoredCertificateStatus
+	for _, c := range certs {
+		if f.Matches(c, now) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
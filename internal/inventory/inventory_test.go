@@ -0,0 +1,133 @@
+package inventory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var _ = Describe("Inventory", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	certs := []monitoringv1alpha1.MonitoredCertificateStatus{
+		{Name: "internal-shop-web", Type: "internal", Path: "shop/web", Namespace: "shop", Status: "expiring", Expiry: "2024-06-11T12:00:00Z", Issuer: "CN=Let's Encrypt R3", Owner: "shop-team"},
+		{Name: "internal-shop-api", Type: "internal", Path: "shop/api", Namespace: "shop", Status: "valid", Expiry: "2025-06-01T12:00:00Z", Issuer: "CN=internal-ca"},
+		{Name: "internal-pay-db", Type: "internal", Path: "pay/db", Namespace: "pay", Status: "expired", Expiry: "2024-05-30T12:00:00Z", Issuer: "CN=internal-ca"},
+		{Name: "external-cp1-ca.crt", Type: "external", Path: "ca.crt", Node: "cp1", Status: "critical", Expiry: "2024-06-04T12:00:00Z", Issuer: "CN=kubernetes"},
+	}
+	names := func(certs []monitoringv1alpha1.MonitoredCertificateStatus) []string {
+		var out []string
+		for _, c := range certs {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+	filter := func(query string) Filter {
+		q, err := url.ParseQuery(query)
+		Expect(err).NotTo(HaveOccurred())
+		f, err := ParseFilter(q)
+		Expect(err).NotTo(HaveOccurred())
+		return f
+	}
+
+	Describe("Filter", func() {
+		It("matches namespaces, statuses, owners and issuers", func() {
+			Expect(names(filter("namespace=shop").Apply(certs, now))).To(Equal([]string{"internal-shop-web", "internal-shop-api"}))
+			Expect(names(filter("status=expired,critical").Apply(certs, now))).To(Equal([]string{"internal-pay-db", "external-cp1-ca.crt"}))
+			Expect(names(filter("issuer=INTERNAL&namespace=shop&namespace=pay").Apply(certs, now))).To(Equal([]string{"internal-shop-api", "internal-pay-db"}))
+			Expect(names(filter("owner=shop-team").Apply(certs, now))).To(Equal([]string{"internal-shop-web"}))
+		})
+
+		It("bounds the days remaining", func() {
+			Expect(names(filter("maxDays=30").Apply(certs, now))).To(Equal([]string{"internal-shop-web", "internal-pay-db", "external-cp1-ca.crt"}))
+			Expect(names(filter("minDays=0&maxDays=5").Apply(certs, now))).To(Equal([]string{"external-cp1-ca.crt"}))
+		})
+
+		It("round-trips through the query", func() {
+			f := filter("namespace=shop&status=valid&owner=shop-team&issuer=ca&minDays=1&maxDays=90")
+			Expect(filter(f.Query().Encode())).To(Equal(f))
+		})
+
+		It("rejects invalid bounds", func() {
+			_, err := ParseFilter(url.Values{"maxDays": {"soon"}})
+			Expect(err).To(HaveOccurred())
+			_, err = ParseFilter(url.Values{"minDays": {"10"}, "maxDays": {"5"}})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Server", func() {
+		server := &Server{
+			Source:   func(context.Context) ([]monitoringv1alpha1.MonitoredCertificateStatus, error) { return certs, nil },
+			SkipAuth: true,
+			Now:      func() time.Time { return now },
+		}
+		get := func(url string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+			return rec
+		}
+
+		It("renders the filtered inventory, most urgent first", func() {
+			rec := get("/?namespace=shop&namespace=pay&issuer=<script>")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(ContainSubstring("No certificates match."))
+			Expect(rec.Body.String()).NotTo(ContainSubstring("<script>"))
+
+			rec = get("/?namespace=shop&namespace=pay")
+			Expect(rec.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+			body := rec.Body.String()
+			Expect(body).To(ContainSubstring("Showing 3 of 4 certificates: 1 expired, 1 expiring, 1 valid."))
+			Expect(body).To(ContainSubstring(`<option value="shop" selected>`))
+			Expect(strings.Index(body, "internal-pay-db")).To(BeNumerically("<", strings.Index(body, "internal-shop-web")))
+			Expect(body).NotTo(ContainSubstring("external-cp1-ca.crt"))
+			Expect(body).To(ContainSubstring(`href="report?format=csv&amp;namespace=shop&amp;namespace=pay"`))
+		})
+
+		It("exports the filtered inventory as a report", func() {
+			rec := get("/report?format=csv&status=critical")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(strings.Count(rec.Body.String(), "\n")).To(Equal(2))
+			Expect(rec.Body.String()).To(ContainSubstring("external-cp1-ca.crt"))
+		})
+
+		It("answers bad requests", func() {
+			Expect(get("/?maxDays=x").Code).To(Equal(http.StatusBadRequest))
+			Expect(get("/report?format=pdf").Code).To(Equal(http.StatusBadRequest))
+			Expect(get("/other").Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Validate", func() {
+		authenticated := func(addr string) *Server {
+			return &Server{Addr: addr, Authenticator: Authenticators{}, Authorizer: namespaceAuthorizer{}}
+		}
+
+		It("requires TLS unless bound to a loopback address", func() {
+			Expect(authenticated("127.0.0.1:8082").Validate()).To(Succeed())
+			Expect(authenticated("localhost:8082").Validate()).To(Succeed())
+			Expect(authenticated("[::1]:8082").Validate()).To(Succeed())
+			Expect(authenticated(":8082").Validate()).To(MatchError(ContainSubstring("TLS")))
+			Expect(authenticated("0.0.0.0:8082").Validate()).To(MatchError(ContainSubstring("TLS")))
+
+			s := authenticated(":8082")
+			s.CertFile, s.KeyFile = "tls.crt", "tls.key"
+			Expect(s.Validate()).To(Succeed())
+			s.KeyFile = ""
+			Expect(s.Validate()).To(MatchError(ContainSubstring("both")))
+		})
+
+		It("only skips authentication on a loopback address", func() {
+			Expect((&Server{Addr: "127.0.0.1:8082", SkipAuth: true}).Validate()).To(Succeed())
+			Expect((&Server{Addr: ":8082", SkipAuth: true, CertFile: "tls.crt", KeyFile: "tls.key"}).Validate()).To(MatchError(ContainSubstring("loopback")))
+			Expect((&Server{Addr: "127.0.0.1:8082"}).Validate()).To(MatchError(ContainSubstring("authenticator")))
+		})
+	})
+})
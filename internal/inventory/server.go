@@ -0,0 +1,426 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+	"egarciam.com/checkcert/internal/report"
+)
+
+// Server serves the certificate inventory: an HTML page at "/" and the
+// report formats at "/report", both taking the filter parameters, and the
+// JSON API when EnableAPI is set. It is a manager Runnable.
+//
+// Every route authenticates the caller with a bearer token and only shows
+// the certificates of the namespaces the caller may list, unless SkipAuth is
+// set.
+type Server struct {
+	// Addr is the address to listen on, e.g. ":8082".
+	Addr string
+	// Source returns the certificates, usually those of every
+	// CertificateMonitor status.
+	Source report.Source
+	// Authenticator identifies the callers. Required unless SkipAuth is set.
+	Authenticator Authenticator
+	// Authorizer decides which namespaces a caller sees. Required unless
+	// SkipAuth is set.
+	Authorizer Authorizer
+	// SkipAuth shows every certificate to anyone who can connect. It is only
+	// accepted on a loopback address.
+	SkipAuth bool
+	// EnableAPI serves /api/v1.
+	EnableAPI bool
+	// CertFile and KeyFile hold the serving certificate. TLS is required
+	// unless Addr is a loopback address.
+	CertFile string
+	KeyFile  string
+	// TLSOpts customize the TLS configuration.
+	TLSOpts []func(*tls.Config)
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NeedLeaderElection is false: every replica serves the inventory from its
+// cache.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Validate checks that the inventory is not served in the clear or without
+// authentication on a reachable address.
+func (s *Server) Validate() error {
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return fmt.Errorf("the inventory needs both a certificate and a key file to serve TLS")
+	}
+	loopback := isLoopback(s.Addr)
+	if s.CertFile == "" && !loopback {
+		return fmt.Errorf("the inventory on %s needs a certificate and key to serve TLS, or a loopback address", s.Addr)
+	}
+	if s.SkipAuth {
+		if !loopback {
+			return fmt.Errorf("the inventory on %s can only skip authentication on a loopback address", s.Addr)
+		}
+		return nil
+	}
+	if s.Authenticator == nil || s.Authorizer == nil {
+		return fmt.Errorf("the inventory needs an authenticator and an authorizer")
+	}
+	return nil
+}
+
+// isLoopback reports whether an address only accepts local connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Start serves until the context is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	log := log.FromContext(ctx).WithName("inventory")
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", s.Addr, err)
+	}
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	if s.CertFile != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		for _, opt := range s.TLSOpts {
+			opt(srv.TLSConfig)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "unable to shut down the inventory server")
+		}
+	}()
+
+	log.Info("Serving certificate inventory", "address", ln.Addr().String(), "tls", s.CertFile != "", "authentication", !s.SkipAuth)
+	if s.CertFile != "" {
+		err = srv.ServeTLS(ln, s.CertFile, s.KeyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// Handler routes the inventory pages.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/report", s.serveReport)
+	if s.EnableAPI {
+		mux.HandleFunc(apiPrefix, s.serveAPI)
+		mux.HandleFunc(apiPrefix+"/", s.serveAPI)
+	}
+	return mux
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// errorWriter answers a request with an error, as text or as JSON.
+type errorWriter func(w http.ResponseWriter, code int, msg string)
+
+func textError(w http.ResponseWriter, code int, msg string) {
+	http.Error(w, msg, code)
+}
+
+// load authenticates a request and reads its filter and the certificates the
+// caller may list, answering the request itself on failure.
+func (s *Server) load(w http.ResponseWriter, req *http.Request, fail errorWriter) ([]monitoringv1alpha1.MonitoredCertificateStatus, Filter, bool) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		fail(w, http.StatusMethodNotAllowed, "method not allowed")
+		return nil, Filter{}, false
+	}
+	filter, err := ParseFilter(req.URL.Query())
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return nil, Filter{}, false
+	}
+	user, ok := s.authenticate(w, req, fail)
+	if !ok {
+		return nil, Filter{}, false
+	}
+	certs, err := s.Source(req.Context())
+	if err != nil {
+		log.FromContext(req.Context()).Error(err, "unable to read certificates")
+		fail(w, http.StatusInternalServerError, "unable to read certificates")
+		return nil, Filter{}, false
+	}
+	certs, err = s.visible(req.Context(), user, certs, filter.Namespaces)
+	if err != nil {
+		s.failAuthorization(w, req, fail, err)
+		return nil, Filter{}, false
+	}
+	return certs, filter, true
+}
+
+func (s *Server) serveReport(w http.ResponseWriter, req *http.Request) {
+	format := report.JSON
+	if v := req.URL.Query().Get("format"); v != "" {
+		f, err := report.ParseFormat(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format = f
+	}
+	certs, filter, ok := s.load(w, req, textError)
+	if !ok {
+		return
+	}
+	now := s.now()
+	var buf bytes.Buffer
+	if err := report.Write(&buf, format, report.New(filter.Apply(certs, now), now)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (s *Server) servePage(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	certs, filter, ok := s.load(w, req, textError)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, newPage(certs, filter, s.now())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// page is the data of the inventory template.
+type page struct {
+	Generated  string
+	Total      int
+	Summary    []statusCount
+	Namespaces []option
+	Statuses   []option
+	Owners     []option
+	Issuer     string
+	MinDays    string
+	MaxDays    string
+	Exports    []export
+	Rows       []row
+}
+
+type statusCount struct {
+	Status string
+	Count  int
+}
+
+type option struct {
+	Value    string
+	Selected bool
+}
+
+type export struct {
+	Format string
+	URL    string
+}
+
+type row struct {
+	Name      string
+	Scope     string
+	Location  string
+	Status    string
+	Expiry    string
+	Days      string
+	Subject   string
+	Issuer    string
+	ManagedBy string
+	Owner     string
+	days      int
+	known     bool
+}
+
+// statuses lists the certificate statuses from the most to the least urgent.
+var statuses = []string{"expired", "critical", "expiring", "valid"}
+
+func newPage(certs []monitoringv1alpha1.MonitoredCertificateStatus, filter Filter, now time.Time) page {
+	p := page{Generated: now.UTC().Format("2006-01-02 15:04 MST"), Total: len(certs), Issuer: filter.Issuer}
+	if filter.MinDays != nil {
+		p.MinDays = strconv.Itoa(*filter.MinDays)
+	}
+	if filter.MaxDays != nil {
+		p.MaxDays = strconv.Itoa(*filter.MaxDays)
+	}
+
+	namespaces, owners := map[string]bool{}, map[string]bool{}
+	for _, c := range certs {
+		if c.Namespace != "" {
+			namespaces[c.Namespace] = true
+		}
+		if c.Owner != "" {
+			owners[c.Owner] = true
+		}
+	}
+	p.Namespaces = options(sortedKeys(namespaces), filter.Namespaces)
+	p.Owners = options(sortedKeys(owners), filter.Owners)
+	p.Statuses = options(statuses, filter.Statuses)
+
+	shown := filter.Apply(certs, now)
+	counts := map[string]int{}
+	for _, c := range shown {
+		counts[c.Status]++
+		r := row{
+			Name: c.Name, Scope: c.Namespace, Location: c.Path, Status: c.Status, Expiry: c.Expiry,
+			Subject: c.Subject, Issuer: c.Issuer, ManagedBy: c.ManagedBy, Owner: c.Owner,
+		}
+		if c.Node != "" {
+			r.Scope = "node " + c.Node
+		}
+		if r.days, r.known = report.DaysRemaining(c, now); r.known {
+			r.Days = strconv.Itoa(r.days)
+		}
+		p.Rows = append(p.Rows, r)
+	}
+	// Most urgent first, certificates of unknown expiry last.
+	sort.SliceStable(p.Rows, func(i, j int) bool {
+		a, b := p.Rows[i], p.Rows[j]
+		if a.known != b.known {
+			return a.known
+		}
+		if a.days != b.days {
+			return a.days < b.days
+		}
+		return a.Name < b.Name
+	})
+	for _, s := range statuses {
+		if counts[s] > 0 {
+			p.Summary = append(p.Summary, statusCount{Status: s, Count: counts[s]})
+		}
+	}
+
+	for _, f := range report.Formats() {
+		q := filter.Query()
+		q.Set("format", string(f))
+		p.Exports = append(p.Exports, export{Format: string(f), URL: "report?" + q.Encode()})
+	}
+	return p
+}
+
+func options(values, selected []string) []option {
+	out := make([]option, 0, len(values))
+	for _, v := range values {
+		o := option{Value: v}
+		for _, s := range selected {
+			if s == v {
+				o.Selected = true
+			}
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var pageTemplate = template.Must(template.New("inventory").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Certificate inventory</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { text-align: left; padding: 0.4em 0.6em; border-bottom: 1px solid #ddd; }
+th { background: #f4f4f4; }
+td.days { text-align: right; }
+form { margin: 1em 0; display: flex; gap: 1em; align-items: end; flex-wrap: wrap; }
+label { display: flex; flex-direction: column; font-size: 0.85em; }
+.status { padding: 0.1em 0.5em; border-radius: 0.8em; color: #fff; }
+.expired, .critical { background: #c0392b; }
+.expiring { background: #e67e22; }
+.valid { background: #27ae60; }
+.status:not(.expired):not(.critical):not(.expiring):not(.valid) { background: #7f8c8d; }
+</style>
+</head>
+<body>
+<h1>Certificate inventory</h1>
+<p>Generated {{.Generated}}. Showing {{len .Rows}} of {{.Total}} certificates{{range $i, $s := .Summary}}{{if eq $i 0}}: {{else}}, {{end}}{{$s.Count}} {{$s.Status}}{{end}}.</p>
+<form method="get" action="">
+<label>Namespace
+<select name="namespace" multiple size="4">
+{{range .Namespaces}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Value}}</option>
+{{end}}</select>
+</label>
+<label>Status
+<select name="status" multiple size="4">
+{{range .Statuses}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Value}}</option>
+{{end}}</select>
+</label>
+{{if .Owners}}<label>Owner
+<select name="owner" multiple size="4">
+{{range .Owners}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Value}}</option>
+{{end}}</select>
+</label>
+{{end}}<label>Issuer contains <input type="text" name="issuer" value="{{.Issuer}}"></label>
+<label>Days left from <input type="number" name="minDays" value="{{.MinDays}}"></label>
+<label>to <input type="number" name="maxDays" value="{{.MaxDays}}"></label>
+<button type="submit">Filter</button>
+<a href="?">Reset</a>
+</form>
+<p>Export: {{range $i, $e := .Exports}}{{if $i}} · {{end}}<a href="{{$e.URL}}">{{$e.Format}}</a>{{end}}</p>
+<table>
+<thead><tr><th>Certificate</th><th>Namespace / node</th><th>Location</th><th>Status</th><th>Expiry</th><th>Days left</th><th>Subject</th><th>Issuer</th><th>Managed by</th><th>Owner</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr><td>{{.Name}}</td><td>{{.Scope}}</td><td>{{.Location}}</td><td><span class="status {{.Status}}">{{.Status}}</span></td><td>{{.Expiry}}</td><td class="days">{{.Days}}</td><td>{{.Subject}}</td><td>{{.Issuer}}</td><td>{{.ManagedBy}}</td><td>{{.Owner}}</td></tr>
+{{else}}<tr><td colspan="10">No certificates match.</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
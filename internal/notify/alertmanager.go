@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAlertTTL keeps an alert firing in Alertmanager when the caller does
+// not say for how long.
+const defaultAlertTTL = 48 * time.Hour
+
+// AlertmanagerConfig describes an Alertmanager.
+type AlertmanagerConfig struct {
+	// URL is the base URL; alerts are posted to URL/api/v2/alerts.
+	URL     string
+	Headers map[string]string
+	// TTL is how long a firing alert lasts without being sent again. The
+	// caller has to send it again before it ends.
+	TTL time.Duration
+}
+
+// Alertmanager pushes critical and expired certificates to the Alertmanager
+// v2 API and resolves them once the certificate is fine again.
+type Alertmanager struct {
+	cfg       AlertmanagerConfig
+	transport transport
+}
+
+// NewAlertmanager returns an Alertmanager notifier, filling in defaults.
+func NewAlertmanager(cfg AlertmanagerConfig) (*Alertmanager, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("alertmanager URL is required")
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultAlertTTL
+	}
+	return &Alertmanager{cfg: cfg}, nil
+}
+
+// Name implements Notifier.
+func (m *Alertmanager) Name() string {
+	return "alertmanager"
+}
+
+type postableAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt,omitempty"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// Notify implements Notifier. Alerts that neither fire nor follow a firing
+// one have nothing to resolve and are not sent.
+func (m *Alertmanager) Notify(ctx context.Context, a Alert) error {
+	if !firing(a) && !wasFiring(a) {
+		return nil
+	}
+	body, err := json.Marshal([]postableAlert{alertmanagerAlert(a, m.cfg.TTL)})
+	if err != nil {
+		return err
+	}
+	req, err := newJSONRequest(ctx, m.cfg.URL+"/api/v2/alerts", body)
+	if err != nil {
+		return err
+	}
+	for k, v := range m.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	return m.transport.post(req)
+}
+
+// alertmanagerAlert builds the alert of a certificate. The labels only carry
+// the certificate identity, which keeps the alert the same while its status
+// moves from critical to expired; the status goes into the annotations. A
+// resolved alert is the same alert ending now.
+func alertmanagerAlert(a Alert, ttl time.Duration) postableAlert {
+	c := a.Certificate
+	labels := map[string]string{
+		"alertname":   "CertificateExpiry",
+		"severity":    "critical",
+		"monitor":     a.Monitor,
+		"certificate": c.Name,
+		"dedup_key":   DedupKey(a),
+	}
+	if a.Cluster != "" {
+		labels["cluster"] = a.Cluster
+	}
+	if c.Namespace != "" {
+		labels["namespace"] = c.Namespace
+	}
+	if c.Owner != "" {
+		labels["owner"] = c.Owner
+	}
+	annotations := map[string]string{
+		"summary":        summary(a),
+		"status":         c.Status,
+		"expiry":         c.Expiry,
+		"days_remaining": strconv.Itoa(c.DaysLeft),
+	}
+	if c.Issuer != "" {
+		annotations["issuer"] = c.Issuer
+	}
+	if len(c.UsedBy) > 0 {
+		annotations["used_by"] = strings.Join(c.UsedBy, ", ")
+	}
+
+	pa := postableAlert{Labels: labels, Annotations: annotations, EndsAt: a.Timestamp}
+	if firing(a) {
+		pa.StartsAt = a.Timestamp
+		pa.EndsAt = a.Timestamp.Add(ttl)
+	}
+	return pa
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"egarciam.com/checkcert/internal/templates"
+)
+
+var _ = Describe("Chat notifiers", func() {
+	alert := Alert{
+		Kind:    "transition",
+		Monitor: "prod",
+		Cluster: "eu-1",
+		Certificate: templates.Certificate{
+			Name: "internal-shop-web", Namespace: "shop", Status: "expiring",
+			Expiry: "2024-06-11T12:00:00Z", DaysLeft: 10,
+		},
+	}
+
+	// receive starts a receiver decoding the posted JSON into out.
+	receive := func(out any) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, out)
+		}))
+	}
+
+	It("posts Block Kit messages to Slack", func() {
+		var got slackPayload
+		srv := receive(&got)
+		defer srv.Close()
+
+		s, err := NewSlack(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Notify(context.Background(), alert)).To(Succeed())
+
+		Expect(got.Text).To(Equal("Certificate internal-shop-web is expiring"))
+		Expect(got.Blocks).To(HaveLen(3))
+		Expect(got.Blocks[0].Type).To(Equal("header"))
+		Expect(got.Blocks[1].Fields).To(ContainElement(slackText{Type: "mrkdwn", Text: "*Namespace*\nshop"}))
+		Expect(got.Blocks[1].Fields).To(ContainElement(slackText{Type: "mrkdwn", Text: "*Days remaining*\n10"}))
+		Expect(got.Blocks[2].Elements[0].Text).To(Equal("Monitor prod in eu-1"))
+	})
+
+	It("posts Adaptive Cards to Teams", func() {
+		var got teamsPayload
+		srv := receive(&got)
+		defer srv.Close()
+
+		t, err := NewTeams(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.Notify(context.Background(), alert)).To(Succeed())
+
+		Expect(got.Attachments).To(HaveLen(1))
+		card := got.Attachments[0].Content
+		Expect(card.Type).To(Equal("AdaptiveCard"))
+		Expect(card.Body[0].Text).To(Equal("Certificate internal-shop-web is expiring"))
+		Expect(card.Body[0].Color).To(Equal("Warning"))
+		Expect(card.Body[1].Facts).To(ContainElement(teamsFact{Title: "Expiry", Value: "2024-06-11T12:00:00Z"}))
+	})
+
+	It("posts once and leaves throttled or failed messages to the queue", func() {
+		var calls int32
+		status := http.StatusTooManyRequests
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(status)
+		}))
+		defer srv.Close()
+
+		s, err := NewSlack(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		err = s.Notify(context.Background(), alert)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrRejected)).To(BeFalse())
+
+		t, err := NewTeams(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		status = http.StatusForbidden
+		Expect(t.Notify(context.Background(), alert)).To(MatchError(ErrRejected))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+	})
+})
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"egarciam.com/checkcert/internal/templates"
+)
+
+var _ = Describe("Incident notifiers", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	alert := func(kind, status string) Alert {
+		return Alert{
+			Kind: kind, Monitor: "prod", Cluster: "eu-1", Timestamp: now,
+			Certificate: templates.Certificate{Name: "internal-shop-web", Namespace: "shop", Status: status, DaysLeft: 3},
+		}
+	}
+	resolved := func(previous string) Alert {
+		a := alert("resolved", "valid")
+		a.PreviousStatus = previous
+		return a
+	}
+
+	var (
+		srv    *httptest.Server
+		path   string
+		bodies [][]byte
+	)
+	BeforeEach(func() {
+		bodies = nil
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, body)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+	})
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("derives the dedup key from the certificate identity", func() {
+		Expect(DedupKey(alert("transition", "critical"))).To(Equal("certcheck/eu-1/prod/internal-shop-web"))
+		Expect(DedupKey(alert("resolved", "valid"))).To(Equal(DedupKey(alert("reminder", "expired"))))
+	})
+
+	It("fires and resolves Alertmanager alerts with the same labels", func() {
+		m, err := NewAlertmanager(AlertmanagerConfig{URL: srv.URL + "/", TTL: time.Hour})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Notify(context.Background(), alert("transition", "critical"))).To(Succeed())
+		Expect(m.Notify(context.Background(), resolved("critical"))).To(Succeed())
+		Expect(path).To(Equal("/api/v2/alerts"))
+
+		var fired, resolved []postableAlert
+		Expect(json.Unmarshal(bodies[0], &fired)).To(Succeed())
+		Expect(json.Unmarshal(bodies[1], &resolved)).To(Succeed())
+		Expect(fired[0].Labels).To(Equal(resolved[0].Labels))
+		Expect(fired[0].EndsAt).To(Equal(now.Add(time.Hour)))
+		Expect(resolved[0].EndsAt).To(Equal(now))
+		Expect(fired[0].Annotations["status"]).To(Equal("critical"))
+	})
+
+	It("triggers and resolves PagerDuty incidents", func() {
+		p, err := NewPagerDuty("routing", srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Notify(context.Background(), alert("transition", "expired"))).To(Succeed())
+		Expect(p.Notify(context.Background(), resolved("expired"))).To(Succeed())
+
+		var trigger, resolve pagerDutyEvent
+		Expect(json.Unmarshal(bodies[0], &trigger)).To(Succeed())
+		Expect(json.Unmarshal(bodies[1], &resolve)).To(Succeed())
+		Expect(trigger.EventAction).To(Equal("trigger"))
+		Expect(trigger.Payload.Severity).To(Equal("critical"))
+		Expect(trigger.Payload.Source).To(Equal("eu-1/prod"))
+		Expect(resolve.EventAction).To(Equal("resolve"))
+		Expect(resolve.DedupKey).To(Equal(trigger.DedupKey))
+		Expect(resolve.Payload).To(BeNil())
+	})
+
+	It("only resolves alerts that fired", func() {
+		m, err := NewAlertmanager(AlertmanagerConfig{URL: srv.URL})
+		Expect(err).NotTo(HaveOccurred())
+		p, err := NewPagerDuty("routing", srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		for _, n := range []Notifier{m, p} {
+			Expect(n.Notify(context.Background(), alert("transition", "expiring"))).To(Succeed())
+			Expect(n.Notify(context.Background(), resolved("expiring"))).To(Succeed())
+		}
+		Expect(bodies).To(BeEmpty())
+	})
+})
@@ -0,0 +1,121 @@
+// Package notify delivers certificate alerts to channels other than email.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"egarciam.com/checkcert/internal/templates"
+)
+
+// SchemaVersion identifies the layout of Alert. It changes whenever a field is
+// renamed or removed; new optional fields keep the version.
+const SchemaVersion = "v1"
+
+// Alert is the payload sent for one alert transition.
+type Alert struct {
+	Version string `json:"version"`
+	// Kind is "transition", "reminder", "escalation" or "resolved".
+	Kind    string `json:"kind"`
+	Monitor string `json:"monitor"`
+	Cluster string `json:"cluster,omitempty"`
+	// PreviousStatus is what recipients were last notified about.
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	// Rotated is set when the certificate was replaced since the last scan.
+	Rotated     bool                  `json:"rotated"`
+	Timestamp   time.Time             `json:"timestamp"`
+	Certificate templates.Certificate `json:"certificate"`
+}
+
+// Notifier is a notification channel.
+type Notifier interface {
+	// Name identifies the channel in logs.
+	Name() string
+	// Notify delivers one alert.
+	Notify(ctx context.Context, a Alert) error
+}
+
+// summary is the one-line headline of an alert.
+func summary(a Alert) string {
+	c := a.Certificate
+	switch a.Kind {
+	case "reminder":
+		return fmt.Sprintf("Reminder: certificate %s is %s", c.Name, c.Status)
+	case "escalation":
+		return fmt.Sprintf("Escalation: certificate %s is still %s", c.Name, c.Status)
+	case "resolved":
+		if a.Rotated {
+			return fmt.Sprintf("Resolved: certificate %s was renewed", c.Name)
+		}
+		return fmt.Sprintf("Resolved: certificate %s is valid", c.Name)
+	default:
+		return fmt.Sprintf("Certificate %s is %s", c.Name, c.Status)
+	}
+}
+
+// fact is a labelled value shown in chat messages.
+type fact struct {
+	title string
+	value string
+}
+
+// facts are the details chat messages show for an alert.
+func facts(a Alert) []fact {
+	c := a.Certificate
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = "(cluster)"
+	}
+	fs := []fact{
+		{"Certificate", c.Name},
+		{"Namespace", namespace},
+		{"Status", c.Status},
+		{"Expiry", c.Expiry},
+		{"Days remaining", strconv.Itoa(c.DaysLeft)},
+	}
+	if c.Issuer != "" {
+		fs = append(fs, fact{"Issuer", c.Issuer})
+	}
+	if c.Owner != "" {
+		fs = append(fs, fact{"Owner", c.Owner})
+	}
+	if len(c.UsedBy) > 0 {
+		fs = append(fs, fact{"Used by", strings.Join(c.UsedBy, ", ")})
+	}
+	return fs
+}
+
+// origin tells which monitor and cluster an alert comes from.
+func origin(a Alert) string {
+	if a.Cluster == "" {
+		return "Monitor " + a.Monitor
+	}
+	return fmt.Sprintf("Monitor %s in %s", a.Monitor, a.Cluster)
+}
+
+// firing reports whether an incident channel should have an open alert for
+// the certificate: only critical and expired certificates page, anything
+// else resolves it.
+func firing(a Alert) bool {
+	return a.Certificate.Status == "critical" || a.Certificate.Status == "expired"
+}
+
+// wasFiring reports whether recipients were last told about a firing
+// certificate, so incident channels have an alert open for it.
+func wasFiring(a Alert) bool {
+	return a.PreviousStatus == "critical" || a.PreviousStatus == "expired"
+}
+
+// DedupKey identifies a certificate across scans and renewals, so repeated
+// and resolving notifications for it land on the same incident.
+func DedupKey(a Alert) string {
+	parts := []string{"certcheck"}
+	if a.Cluster != "" {
+		parts = append(parts, a.Cluster)
+	}
+	parts = append(parts, a.Monitor, a.Certificate.Name)
+	return strings.Join(parts, "/")
+}
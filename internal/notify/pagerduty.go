@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty triggers PagerDuty incidents through the Events API v2 for
+// critical and expired certificates and resolves them once the certificate
+// is fine again.
+type PagerDuty struct {
+	routingKey string
+	url        string
+	transport  transport
+}
+
+// NewPagerDuty returns a PagerDuty notifier for an integration routing key.
+// An empty url selects PagerDutyEventsURL.
+func NewPagerDuty(routingKey, url string) (*PagerDuty, error) {
+	if routingKey == "" {
+		return nil, fmt.Errorf("pagerduty routing key is required")
+	}
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+	return &PagerDuty{routingKey: routingKey, url: url}, nil
+}
+
+// Name implements Notifier.
+func (p *PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// Notify implements Notifier. Alerts that neither fire nor follow a firing
+// one have no incident to resolve and are not sent.
+func (p *PagerDuty) Notify(ctx context.Context, a Alert) error {
+	if !firing(a) && !wasFiring(a) {
+		return nil
+	}
+	body, err := json.Marshal(p.event(a))
+	if err != nil {
+		return err
+	}
+	req, err := newJSONRequest(ctx, p.url, body)
+	if err != nil {
+		return err
+	}
+	return p.transport.post(req)
+}
+
+// event builds a trigger event for critical and expired certificates and a
+// resolve event otherwise. Triggers for the same certificate update the open
+// incident thanks to the shared dedup key.
+func (p *PagerDuty) event(a Alert) pagerDutyEvent {
+	ev := pagerDutyEvent{RoutingKey: p.routingKey, EventAction: "resolve", DedupKey: DedupKey(a)}
+	if !firing(a) {
+		return ev
+	}
+
+	c := a.Certificate
+	severity := "error"
+	if c.Status == "expired" {
+		severity = "critical"
+	}
+	source := a.Monitor
+	if a.Cluster != "" {
+		source = a.Cluster + "/" + a.Monitor
+	}
+	details := map[string]string{
+		"status":         c.Status,
+		"expiry":         c.Expiry,
+		"days_remaining": fmt.Sprint(c.DaysLeft),
+		"type":           c.Type,
+	}
+	if c.Issuer != "" {
+		details["issuer"] = c.Issuer
+	}
+	if c.Fingerprint != "" {
+		details["fingerprint"] = c.Fingerprint
+	}
+	if c.Owner != "" {
+		details["owner"] = c.Owner
+	}
+	if len(c.UsedBy) > 0 {
+		details["used_by"] = strings.Join(c.UsedBy, ", ")
+	}
+
+	ev.EventAction = "trigger"
+	ev.Payload = &pagerDutyPayload{
+		Summary:       summary(a),
+		Source:        source,
+		Severity:      severity,
+		Timestamp:     a.Timestamp,
+		Component:     c.Name,
+		Group:         c.Namespace,
+		Class:         "certificate",
+		CustomDetails: details,
+	}
+	return ev
+}
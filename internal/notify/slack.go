@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Slack posts alerts to a Slack incoming webhook as Block Kit messages.
+type Slack struct {
+	url       string
+	transport transport
+}
+
+// NewSlack returns a Slack notifier for an incoming webhook URL.
+func NewSlack(url string) (*Slack, error) {
+	if url == "" {
+		return nil, fmt.Errorf("slack webhook URL is required")
+	}
+	return &Slack{url: url}, nil
+}
+
+// Name implements Notifier.
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(slackMessage(a))
+	if err != nil {
+		return err
+	}
+	req, err := newJSONRequest(ctx, s.url, body)
+	if err != nil {
+		return err
+	}
+	return s.transport.post(req)
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackPayload struct {
+	// Text is the fallback shown in notifications.
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// slackMessage lays an alert out as a header, the certificate details as
+// section fields, and its origin as context.
+func slackMessage(a Alert) slackPayload {
+	headline := summary(a)
+	var fields []slackText
+	for _, f := range facts(a) {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", f.title, f.value)})
+	}
+	return slackPayload{
+		Text: headline,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: headline}},
+			{Type: "section", Fields: fields},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: origin(a)}}},
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Teams posts alerts to a Microsoft Teams incoming webhook or workflow as
+// Adaptive Cards.
+type Teams struct {
+	url       string
+	transport transport
+}
+
+// NewTeams returns a Teams notifier for an incoming webhook URL.
+func NewTeams(url string) (*Teams, error) {
+	if url == "" {
+		return nil, fmt.Errorf("teams webhook URL is required")
+	}
+	return &Teams{url: url}, nil
+}
+
+// Name implements Notifier.
+func (t *Teams) Name() string {
+	return "teams"
+}
+
+// Notify implements Notifier.
+func (t *Teams) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(teamsMessage(a))
+	if err != nil {
+		return err
+	}
+	req, err := newJSONRequest(ctx, t.url, body)
+	if err != nil {
+		return err
+	}
+	return t.transport.post(req)
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type teamsElement struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Size   string      `json:"size,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []teamsElement `json:"body"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsPayload struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+// teamsMessage wraps an Adaptive Card with the headline, the certificate
+// details as a fact set, and its origin.
+func teamsMessage(a Alert) teamsPayload {
+	color := "Attention"
+	switch {
+	case a.Kind == "resolved":
+		color = "Good"
+	case a.Certificate.Status == "expiring":
+		color = "Warning"
+	}
+	var fs []teamsFact
+	for _, f := range facts(a) {
+		fs = append(fs, teamsFact{Title: f.title, Value: f.value})
+	}
+	return teamsPayload{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body: []teamsElement{
+					{Type: "TextBlock", Text: summary(a), Weight: "Bolder", Size: "Medium", Color: color, Wrap: true},
+					{Type: "FactSet", Facts: fs},
+					{Type: "TextBlock", Text: origin(a), Size: "Small", Wrap: true},
+				},
+			},
+		}},
+	}
+}
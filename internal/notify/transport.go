@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// ErrRejected marks answers that retrying cannot fix, such as a 4xx other
+// than 429.
+var ErrRejected = errors.New("request rejected")
+
+// transport POSTs requests. It tries once: failed alerts are retried by the
+// notification queue of the caller, not while it waits.
+type transport struct {
+	client *http.Client
+}
+
+// post sends one request. Network errors, 429 and 5xx answers are worth
+// retrying; any other failure wraps ErrRejected. Errors only name the host:
+// incoming webhook URLs carry their credentials in the path.
+func (t transport) post(req *http.Request) error {
+	client := t.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("POST %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("POST %s: %s", req.URL.Host, resp.Status)
+	}
+	return fmt.Errorf("POST %s: %s: %w", req.URL.Host, resp.Status, ErrRejected)
+}
+
+// newJSONRequest builds a POST request with a JSON body.
+func newJSONRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
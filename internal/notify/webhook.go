@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers set on every webhook request.
+const (
+	EventHeader     = "X-Certcheck-Event"
+	TimestampHeader = "X-Certcheck-Timestamp"
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" with the signing key.
+	SignatureHeader = "X-Certcheck-Signature"
+)
+
+// SigningKeyKey is the Secret key holding the HMAC signing key. Every other
+// key of the Secret is sent as a request header.
+const SigningKeyKey = "signing-key"
+
+// WebhookConfig describes a webhook receiver.
+type WebhookConfig struct {
+	URL     string
+	Headers map[string]string
+	// SigningKey enables request signing when set.
+	SigningKey []byte
+	Client     *http.Client
+}
+
+// WebhookConfigFromData builds a WebhookConfig from the data of the
+// referenced Secret.
+func WebhookConfigFromData(url string, data map[string][]byte) WebhookConfig {
+	cfg := WebhookConfig{URL: url, Headers: map[string]string{}}
+	for k, v := range data {
+		if k == SigningKeyKey {
+			cfg.SigningKey = v
+			continue
+		}
+		cfg.Headers[k] = string(v)
+	}
+	return cfg
+}
+
+func (cfg WebhookConfig) transport() transport {
+	return transport{client: cfg.Client}
+}
+
+// Webhook POSTs every alert as JSON to a URL.
+type Webhook struct {
+	cfg WebhookConfig
+}
+
+// NewWebhook returns a webhook notifier, filling in defaults.
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+	return &Webhook{cfg: cfg}, nil
+}
+
+// Name implements Notifier.
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, a Alert) error {
+	a.Version = SchemaVersion
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := newJSONRequest(ctx, w.cfg.URL, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(EventHeader, a.Kind)
+	if len(w.cfg.SigningKey) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.cfg.SigningKey, ts, body))
+	}
+	return w.cfg.transport().post(req)
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>". Receivers
+// compute the same value to verify SignatureHeader.
+func Sign(key []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"egarciam.com/checkcert/internal/templates"
+)
+
+var _ = Describe("Webhook", func() {
+	alert := Alert{
+		Kind:        "transition",
+		Monitor:     "prod",
+		Timestamp:   time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Certificate: templates.Certificate{Name: "internal-default-web", Status: "expiring", DaysLeft: 10},
+	}
+
+	It("posts a signed, versioned JSON payload with the configured headers", func() {
+		var got Alert
+		var header http.Header
+		var body []byte
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Clone()
+			body, _ = io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &got)
+		}))
+		defer srv.Close()
+
+		w, err := NewWebhook(WebhookConfigFromData(srv.URL, map[string][]byte{
+			SigningKeyKey:   []byte("s3cret"),
+			"Authorization": []byte("Bearer token"),
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Notify(context.Background(), alert)).To(Succeed())
+
+		Expect(got.Version).To(Equal(SchemaVersion))
+		Expect(got.Certificate.Name).To(Equal("internal-default-web"))
+		Expect(header.Get("Authorization")).To(Equal("Bearer token"))
+		Expect(header.Get(EventHeader)).To(Equal("transition"))
+		Expect(header.Get(SignatureHeader)).To(Equal("sha256=" + Sign([]byte("s3cret"), header.Get(TimestampHeader), body)))
+	})
+
+	It("tries once and leaves server errors to the caller's retries", func() {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		w, err := NewWebhook(WebhookConfig{URL: srv.URL})
+		Expect(err).NotTo(HaveOccurred())
+		err = w.Notify(context.Background(), alert)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrRejected)).To(BeFalse())
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+	})
+
+	It("marks client errors as rejected", func() {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		w, err := NewWebhook(WebhookConfig{URL: srv.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Notify(context.Background(), alert)).To(MatchError(ErrRejected))
+	})
+})
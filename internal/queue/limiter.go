@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter caps the number of messages sent per channel in a sliding window.
+// It is safe for concurrent use, so one limiter can pace every monitor
+// sharing the same SMTP server or webhook endpoints.
+type Limiter struct {
+	window time.Duration
+	limits map[string]int
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+// NewLimiter builds a limiter allowing limits[channel] messages per window.
+// Channels without a limit are not paced.
+func NewLimiter(window time.Duration, limits map[string]int) *Limiter {
+	return &Limiter{window: window, limits: limits, sent: map[string][]time.Time{}}
+}
+
+// Allow reports whether a message may be sent on the channel now, recording
+// it if so. Otherwise it returns when the next slot frees up. A nil limiter
+// allows everything.
+func (l *Limiter) Allow(channel string, now time.Time) (bool, time.Time) {
+	if l == nil {
+		return true, time.Time{}
+	}
+	limit, ok := l.limits[channel]
+	if !ok || limit <= 0 {
+		return true, time.Time{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recent := l.sent[channel][:0]
+	for _, t := range l.sent[channel] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	l.sent[channel] = recent
+	if len(recent) >= limit {
+		return false, recent[0].Add(l.window)
+	}
+	l.sent[channel] = append(recent, now)
+	return true, time.Time{}
+}
+
+// ParseLimits parses per-channel limits written as "email=30,slack=60".
+func ParseLimits(s string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		channel, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, expected channel=count", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid rate limit %q, expected a non-negative count", part)
+		}
+		limits[strings.TrimSpace(channel)] = n
+	}
+	return limits, nil
+}
@@ -0,0 +1,219 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Message is one outbound notification: a single payload for a single
+// recipient on a single channel, so recipients fail and retry independently.
+type Message struct {
+	// ID identifies what the message is about. A newer message with the same
+	// ID replaces a pending one, so a stale alert is never sent after a fresh
+	// one.
+	ID        string `json:"id"`
+	Channel   string `json:"channel"`
+	Recipient string `json:"recipient,omitempty"`
+	// Payload is the channel-specific content, opaque to the queue.
+	Payload  json.RawMessage `json:"payload"`
+	Enqueued time.Time       `json:"enqueued"`
+	// MaxAttempts overrides the attempts of the policy when set.
+	MaxAttempts int       `json:"maxAttempts,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Policy controls how failed messages are retried.
+type Policy struct {
+	// MaxAttempts is how many deliveries are tried before a message is
+	// dropped.
+	MaxAttempts int
+	// Backoff is the delay after the first failure, doubled on every further
+	// failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultPolicy retries for roughly a day before giving up.
+func DefaultPolicy() Policy {
+	return Policy{MaxAttempts: 10, Backoff: time.Minute, MaxBackoff: 4 * time.Hour}
+}
+
+// delay is the wait before the next attempt after the given number of failed
+// attempts.
+func (p Policy) delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// permanentError marks a failure retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error a send function returns when retrying cannot
+// help, such as a rejected request. The message is dropped at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Queue holds the messages waiting for delivery, oldest first. It serializes
+// to JSON so callers can persist it between deliveries.
+type Queue struct {
+	Messages []Message `json:"messages"`
+}
+
+// Decode reads a queue serialized with Encode. Empty data is an empty queue.
+func Decode(data []byte) (*Queue, error) {
+	q := &Queue{}
+	if len(data) == 0 {
+		return q, nil
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("invalid notification queue: %w", err)
+	}
+	return q, nil
+}
+
+// Encode serializes the queue.
+func (q *Queue) Encode() ([]byte, error) {
+	return json.Marshal(q)
+}
+
+// Len is the number of pending messages.
+func (q *Queue) Len() int {
+	return len(q.Messages)
+}
+
+// Has reports whether a message with the given ID is pending.
+func (q *Queue) Has(id string) bool {
+	for _, m := range q.Messages {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Add enqueues a message for immediate delivery, replacing a pending message
+// with the same ID.
+func (q *Queue) Add(m Message, now time.Time) {
+	m.Enqueued = now
+	m.NextAttempt = now
+	m.Attempts = 0
+	m.LastError = ""
+	for i := range q.Messages {
+		if q.Messages[i].ID == m.ID {
+			q.Messages[i] = m
+			return
+		}
+	}
+	q.Messages = append(q.Messages, m)
+}
+
+// Trim drops the oldest messages until at most max are left, and returns
+// the dropped ones.
+func (q *Queue) Trim(max int) []Message {
+	if len(q.Messages) <= max {
+		return nil
+	}
+	sort.SliceStable(q.Messages, func(i, j int) bool { return q.Messages[i].Enqueued.Before(q.Messages[j].Enqueued) })
+	n := len(q.Messages) - max
+	dropped := append([]Message(nil), q.Messages[:n]...)
+	q.Messages = append(q.Messages[:0], q.Messages[n:]...)
+	return dropped
+}
+
+// Next is when the earliest pending message is due, zero when the queue is
+// empty.
+func (q *Queue) Next() time.Time {
+	var next time.Time
+	for _, m := range q.Messages {
+		next = earliest(next, m.NextAttempt)
+	}
+	return next
+}
+
+// Counts returns the number of pending messages per channel.
+func (q *Queue) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, m := range q.Messages {
+		counts[m.Channel]++
+	}
+	return counts
+}
+
+// Outcome is the result of a delivery round.
+type Outcome struct {
+	Sent    []Message
+	Failed  []Message
+	Dropped []Message
+	// Next is when the earliest pending message becomes due, zero when the
+	// queue is empty.
+	Next time.Time
+}
+
+// Deliver sends every due message the limiter allows. A failed message is
+// retried after an exponential backoff, and dropped once it used up the
+// attempts of the policy, or its own, or at once when the error is
+// Permanent. Messages held back by the limiter stay due.
+func (q *Queue) Deliver(now time.Time, policy Policy, limiter *Limiter, send func(Message) error) Outcome {
+	var out Outcome
+	pending := q.Messages[:0]
+	for _, m := range q.Messages {
+		if m.NextAttempt.After(now) {
+			pending = append(pending, m)
+			out.Next = earliest(out.Next, m.NextAttempt)
+			continue
+		}
+		if ok, retry := limiter.Allow(m.Channel, now); !ok {
+			pending = append(pending, m)
+			out.Next = earliest(out.Next, retry)
+			continue
+		}
+
+		err := send(m)
+		if err == nil {
+			out.Sent = append(out.Sent, m)
+			continue
+		}
+		m.Attempts++
+		m.LastError = err.Error()
+		maxAttempts := policy.MaxAttempts
+		if m.MaxAttempts > 0 {
+			maxAttempts = m.MaxAttempts
+		}
+		if m.Attempts >= maxAttempts || errors.As(err, &permanentError{}) {
+			out.Dropped = append(out.Dropped, m)
+			continue
+		}
+		m.NextAttempt = now.Add(policy.delay(m.Attempts))
+		out.Failed = append(out.Failed, m)
+		pending = append(pending, m)
+		out.Next = earliest(out.Next, m.NextAttempt)
+	}
+	q.Messages = pending
+	sort.SliceStable(q.Messages, func(i, j int) bool { return q.Messages[i].Enqueued.Before(q.Messages[j].Enqueued) })
+	return out
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
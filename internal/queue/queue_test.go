@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Queue", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	policy := Policy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 3 * time.Minute}
+
+	msg := func(id, channel, recipient string) Message {
+		return Message{ID: id, Channel: channel, Recipient: recipient, Payload: []byte(`{}`)}
+	}
+	ok := func(Message) error { return nil }
+
+	It("sends due messages and empties the queue", func() {
+		q := &Queue{}
+		q.Add(msg("a", "email", "a@example.com"), now)
+		q.Add(msg("b", "slack", ""), now)
+		out := q.Deliver(now, policy, nil, ok)
+		Expect(out.Sent).To(HaveLen(2))
+		Expect(q.Len()).To(BeZero())
+		Expect(out.Next.IsZero()).To(BeTrue())
+	})
+
+	It("replaces a pending message with the same ID", func() {
+		q := &Queue{}
+		q.Add(msg("a", "email", "a@example.com"), now)
+		newer := msg("a", "email", "a@example.com")
+		newer.Payload = []byte(`{"kind":"reminder"}`)
+		q.Add(newer, now.Add(time.Minute))
+		Expect(q.Len()).To(Equal(1))
+		Expect(string(q.Messages[0].Payload)).To(ContainSubstring("reminder"))
+	})
+
+	It("retries only the recipients that failed, backing off exponentially", func() {
+		q := &Queue{}
+		q.Add(msg("a", "email", "ok@example.com"), now)
+		q.Add(msg("b", "email", "down@example.com"), now)
+		send := func(m Message) error {
+			if m.Recipient == "down@example.com" {
+				return errors.New("connection refused")
+			}
+			return nil
+		}
+
+		out := q.Deliver(now, policy, nil, send)
+		Expect(out.Sent).To(HaveLen(1))
+		Expect(out.Failed).To(HaveLen(1))
+		Expect(q.Messages).To(HaveLen(1))
+		Expect(q.Messages[0].LastError).To(Equal("connection refused"))
+		Expect(out.Next).To(Equal(now.Add(time.Minute)))
+
+		// Not due yet.
+		Expect(q.Deliver(now.Add(30*time.Second), policy, nil, send).Failed).To(BeEmpty())
+
+		out = q.Deliver(now.Add(time.Minute), policy, nil, send)
+		Expect(out.Next).To(Equal(now.Add(3 * time.Minute)))
+	})
+
+	It("drops a message once its attempts are used up", func() {
+		q := &Queue{}
+		q.Add(msg("a", "webhook", ""), now)
+		fail := func(Message) error { return errors.New("500") }
+		t := now
+		for i := 0; i < 2; i++ {
+			out := q.Deliver(t, policy, nil, fail)
+			t = out.Next
+		}
+		out := q.Deliver(t, policy, nil, fail)
+		Expect(out.Dropped).To(HaveLen(1))
+		Expect(q.Len()).To(BeZero())
+	})
+
+	It("drops a message at once on a permanent error or its own attempt limit", func() {
+		q := &Queue{}
+		q.Add(msg("a", "webhook", ""), now)
+		once := msg("b", "webhook", "")
+		once.MaxAttempts = 1
+		q.Add(once, now)
+		out := q.Deliver(now, policy, nil, func(m Message) error {
+			if m.ID == "a" {
+				return Permanent(errors.New("400 Bad Request"))
+			}
+			return errors.New("500")
+		})
+		Expect(out.Dropped).To(HaveLen(2))
+		Expect(out.Dropped[0].LastError).To(Equal("400 Bad Request"))
+		Expect(q.Len()).To(BeZero())
+	})
+
+	It("holds back messages over the channel rate limit", func() {
+		q := &Queue{}
+		for _, id := range []string{"a", "b", "c"} {
+			q.Add(msg(id, "email", id+"@example.com"), now)
+		}
+		q.Add(msg("d", "slack", ""), now)
+		limiter := NewLimiter(time.Minute, map[string]int{"email": 2})
+
+		out := q.Deliver(now, policy, limiter, ok)
+		Expect(out.Sent).To(HaveLen(3))
+		Expect(q.Messages).To(HaveLen(1))
+		Expect(q.Messages[0].ID).To(Equal("c"))
+		Expect(out.Next).To(Equal(now.Add(time.Minute)))
+
+		Expect(q.Deliver(now.Add(time.Minute), policy, limiter, ok).Sent).To(HaveLen(1))
+	})
+
+	It("trims the oldest messages", func() {
+		q := &Queue{}
+		q.Add(msg("a", "email", "a@example.com"), now)
+		q.Add(msg("b", "slack", ""), now.Add(-time.Minute))
+		q.Add(msg("c", "webhook", ""), now.Add(time.Minute))
+		Expect(q.Trim(3)).To(BeEmpty())
+
+		dropped := q.Trim(1)
+		Expect(dropped).To(HaveLen(2))
+		Expect(dropped[0].ID).To(Equal("b"))
+		Expect(dropped[1].ID).To(Equal("a"))
+		Expect(q.Messages).To(HaveLen(1))
+		Expect(q.Messages[0].ID).To(Equal("c"))
+	})
+
+	It("round-trips through its encoding", func() {
+		q := &Queue{}
+		q.Add(msg("a", "email", "a@example.com"), now)
+		data, err := q.Encode()
+		Expect(err).NotTo(HaveOccurred())
+		decoded, err := Decode(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.Has("a")).To(BeTrue())
+		Expect(decoded.Counts()).To(Equal(map[string]int{"email": 1}))
+	})
+
+	It("parses rate limits", func() {
+		limits, err := ParseLimits("email=30, slack=60")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(map[string]int{"email": 30, "slack": 60}))
+		_, err = ParseLimits("email")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,14 @@
+package queue
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestQueue(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Queue Suite")
+}
@@ -0,0 +1,286 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var csvHeader = []string{
+	"name", "type", "namespace", "node", "path", "status", "expiry", "daysRemaining",
+	"notBefore", "subject", "issuer", "dnsNames", "serialNumber", "fingerprint", "managedBy",
+	"owner",
+}
+
+func writeCSV(w io.Writer, r *Document) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, c := range r.Certificates {
+		days := ""
+		if d, ok := DaysRemaining(c, r.GeneratedAt); ok {
+			days = strconv.Itoa(d)
+		}
+		record := []string{
+			c.Name, c.Type, c.Namespace, c.Node, c.Path, c.Status, c.Expiry, days,
+			c.NotBefore, c.Subject, c.Issuer, strings.Join(c.DNSNames, ";"), c.SerialNumber, c.Fingerprint, c.ManagedBy,
+			c.Owner,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeMarkdown(w io.Writer, r *Document) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Certificate report\n\n")
+	fmt.Fprintf(&b, "Generated %s, %d certificates", r.GeneratedAt.Format("2006-01-02 15:04 MST"), len(r.Certificates))
+	if summary := r.summaryText(); summary != "" {
+		fmt.Fprintf(&b, ": %s", summary)
+	}
+	b.WriteString(".\n\n")
+	if len(r.Certificates) > 0 {
+		b.WriteString("| Certificate | Location | Status | Expiry | Days left | Subject | Issuer |\n")
+		b.WriteString("|---|---|---|---|---:|---|---|\n")
+		for _, c := range r.Certificates {
+			days := ""
+			if d, ok := DaysRemaining(c, r.GeneratedAt); ok {
+				days = strconv.Itoa(d)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n",
+				mdCell(c.Name), mdCell(location(c)), mdCell(c.Status), mdCell(c.Expiry), days, mdCell(c.Subject), mdCell(c.Issuer))
+		}
+	}
+	if len(r.Owners) > 0 {
+		owners := make([]string, 0, len(r.Owners))
+		for o := range r.Owners {
+			owners = append(owners, o)
+		}
+		sort.Strings(owners)
+		b.WriteString("\n## By owner\n\n| Owner | Certificates |\n|---|---|\n")
+		for _, o := range owners {
+			fmt.Fprintf(&b, "| %s | %s |\n", mdCell(o), countsText(r.Owners[o]))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mdCell escapes a value for a Markdown table cell.
+func mdCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// JUnit XML, in the subset understood by CI servers: one test case per
+// certificate, failing when it is not valid.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, r *Document) error {
+	suite := junitTestSuite{Name: "certificates", Timestamp: r.GeneratedAt.Format("2006-01-02T15:04:05")}
+	for _, c := range r.Certificates {
+		tc := junitTestCase{ClassName: className(c), Name: location(c)}
+		problem := &junitProblem{Message: describe(c, r.GeneratedAt), Type: c.Status, Text: details(c)}
+		switch c.Status {
+		case "valid":
+		case "expiring", "critical", "expired":
+			tc.Failure = problem
+			suite.Failures++
+		default:
+			tc.Error = problem
+			suite.Errors++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+
+	doc := junitTestSuites{Name: "certificates", Tests: suite.Tests, Failures: suite.Failures, Errors: suite.Errors, Suites: []junitTestSuite{suite}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// className groups test cases by namespace or node.
+func className(c monitoringv1alpha1.MonitoredCertificateStatus) string {
+	switch {
+	case c.Namespace != "":
+		return c.Namespace
+	case c.Node != "":
+		return c.Node
+	}
+	return c.Type
+}
+
+// details lists the identifying fields of a certificate, one per line.
+func details(c monitoringv1alpha1.MonitoredCertificateStatus) string {
+	var b strings.Builder
+	for _, f := range [][2]string{
+		{"Subject", c.Subject}, {"Issuer", c.Issuer}, {"DNS names", strings.Join(c.DNSNames, ", ")},
+		{"Not before", c.NotBefore}, {"Not after", c.Expiry}, {"Serial number", c.SerialNumber}, {"Fingerprint", c.Fingerprint},
+	} {
+		if f[1] != "" {
+			fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+		}
+	}
+	return b.String()
+}
+
+// SARIF 2.1.0, in the subset read by code scanning dashboards. Only
+// certificates that need attention are reported.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifRules maps the statuses worth reporting to rules and levels.
+var sarifRules = []struct {
+	status, id, level, text string
+}{
+	{"expired", "certificate-expired", "error", "The certificate has expired."},
+	{"critical", "certificate-critical", "error", "The certificate expires within the critical threshold."},
+	{"expiring", "certificate-expiring", "warning", "The certificate expires within the warning threshold."},
+	{"error", "certificate-unreadable", "error", "The certificate could not be read or evaluated."},
+}
+
+func writeSARIF(w io.Writer, r *Document) error {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "certcheck"}}, Results: []sarifResult{}}
+	for _, rule := range sarifRules {
+		sr := sarifRule{ID: rule.id, ShortDescription: sarifMessage{Text: rule.text}}
+		sr.DefaultConfiguration.Level = rule.level
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sr)
+	}
+
+	for _, c := range r.Certificates {
+		for _, rule := range sarifRules {
+			if rule.status != c.Status {
+				continue
+			}
+			res := sarifResult{
+				RuleID:    rule.id,
+				Level:     rule.level,
+				Message:   sarifMessage{Text: describe(c, r.GeneratedAt)},
+				Locations: []sarifLocation{sarifLocationOf(c)},
+			}
+			if c.Fingerprint != "" {
+				res.PartialFingerprints = map[string]string{"certificateFingerprint/v1": c.Fingerprint}
+			}
+			run.Results = append(run.Results, res)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Version: "2.1.0", Schema: "https://json.schemastore.org/sarif-2.1.0.json", Runs: []sarifRun{run}})
+}
+
+// sarifLocationOf points at the file of a host certificate, or names the
+// secret of a cluster certificate.
+func sarifLocationOf(c monitoringv1alpha1.MonitoredCertificateStatus) sarifLocation {
+	if c.Type == "external" && c.Path != "" {
+		pl := &sarifPhysicalLocation{}
+		pl.ArtifactLocation.URI = c.Path
+		if strings.HasPrefix(c.Path, "/") {
+			pl.ArtifactLocation.URI = "file://" + c.Path
+		}
+		return sarifLocation{PhysicalLocation: pl}
+	}
+	return sarifLocation{LogicalLocations: []sarifLogicalLocation{{Name: c.Name, FullyQualifiedName: c.Path, Kind: "resource"}}}
+}
@@ -0,0 +1,202 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// Format is an output format of a report.
+type Format string
+
+const (
+	JSON     Format = "json"
+	YAML     Format = "yaml"
+	CSV      Format = "csv"
+	Markdown Format = "markdown"
+	JUnit    Format = "junit"
+	SARIF    Format = "sarif"
+)
+
+// Formats lists the supported formats.
+func Formats() []Format {
+	return []Format{JSON, YAML, CSV, Markdown, JUnit, SARIF}
+}
+
+// ParseFormat reads a format name, accepting the usual file extensions as
+// aliases.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSON, YAML, CSV, Markdown, JUnit, SARIF:
+		return f, nil
+	case "yml":
+		return YAML, nil
+	case "md":
+		return Markdown, nil
+	case "xml":
+		return JUnit, nil
+	}
+	return "", fmt.Errorf("unknown report format %q, expected one of %s", s, FormatList())
+}
+
+// FormatList names the supported formats, comma separated.
+func FormatList() string {
+	names := make([]string, 0, len(Formats()))
+	for _, f := range Formats() {
+		names = append(names, string(f))
+	}
+	return strings.Join(names, ", ")
+}
+
+// ContentType is the media type of the format, for HTTP responses.
+func (f Format) ContentType() string {
+	switch f {
+	case YAML:
+		return "application/yaml"
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	case JUnit:
+		return "application/xml"
+	case SARIF:
+		return "application/sarif+json"
+	}
+	return "application/json"
+}
+
+// Source returns the certificates to report on.
+type Source func(ctx context.Context) ([]monitoringv1alpha1.MonitoredCertificateStatus, error)
+
+// Document is a point-in-time view of certificate results, in the model of
+// the CertificateMonitor status.
+type Document struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Summary counts the certificates per status.
+	Summary map[string]int `json:"summary"`
+	// Owners counts the certificates of each owner per status. Certificates
+	// without an owner are left out.
+	Owners       map[string]map[string]int                       `json:"owners,omitempty"`
+	Certificates []monitoringv1alpha1.MonitoredCertificateStatus `json:"certificates"`
+}
+
+// New builds a report of the given certificates, sorted by name.
+func New(certs []monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) *Document {
+	r := &Document{
+		GeneratedAt:  now.UTC(),
+		Summary:      map[string]int{},
+		Certificates: append([]monitoringv1alpha1.MonitoredCertificateStatus{}, certs...),
+	}
+	sort.SliceStable(r.Certificates, func(i, j int) bool { return r.Certificates[i].Name < r.Certificates[j].Name })
+	for _, c := range r.Certificates {
+		r.Summary[c.Status]++
+		if c.Owner == "" {
+			continue
+		}
+		if r.Owners == nil {
+			r.Owners = map[string]map[string]int{}
+		}
+		if r.Owners[c.Owner] == nil {
+			r.Owners[c.Owner] = map[string]int{}
+		}
+		r.Owners[c.Owner][c.Status]++
+	}
+	return r
+}
+
+// Write renders the report in the given format.
+func Write(w io.Writer, format Format, r *Document) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case YAML:
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case CSV:
+		return writeCSV(w, r)
+	case Markdown:
+		return writeMarkdown(w, r)
+	case JUnit:
+		return writeJUnit(w, r)
+	case SARIF:
+		return writeSARIF(w, r)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// statusOrder ranks statuses from the most to the least urgent.
+var statusOrder = []string{"expired", "critical", "expiring", "valid"}
+
+// summaryText describes the status counts, e.g. "1 expired, 3 valid".
+func (r *Document) summaryText() string {
+	return countsText(r.Summary)
+}
+
+// countsText describes status counts, the most urgent first.
+func countsText(counts map[string]int) string {
+	var parts []string
+	seen := map[string]bool{}
+	for _, s := range statusOrder {
+		seen[s] = true
+		if n := counts[s]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, s))
+		}
+	}
+	var others []string
+	for s := range counts {
+		if !seen[s] {
+			others = append(others, s)
+		}
+	}
+	sort.Strings(others)
+	for _, s := range others {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DaysRemaining is the number of whole days until a certificate expires,
+// negative once expired. ok is false when the expiry is unknown.
+func DaysRemaining(c monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) (int, bool) {
+	t, err := time.Parse(time.RFC3339, c.Expiry)
+	if err != nil {
+		return 0, false
+	}
+	return int(t.Sub(now).Hours() / 24), true
+}
+
+// location is where a certificate lives: the namespaced secret, or the path
+// on its node.
+func location(c monitoringv1alpha1.MonitoredCertificateStatus) string {
+	if c.Node != "" {
+		return c.Node + ":" + c.Path
+	}
+	return c.Path
+}
+
+// describe explains the status of a certificate in a sentence.
+func describe(c monitoringv1alpha1.MonitoredCertificateStatus, now time.Time) string {
+	days, ok := DaysRemaining(c, now)
+	switch {
+	case !ok:
+		return fmt.Sprintf("Certificate %s is %s", location(c), c.Status)
+	case days < 0:
+		return fmt.Sprintf("Certificate %s expired %d days ago, on %s", location(c), -days, c.Expiry)
+	default:
+		return fmt.Sprintf("Certificate %s is %s, it expires in %d days, on %s", location(c), c.Status, days, c.Expiry)
+	}
+}
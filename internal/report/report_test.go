@@ -0,0 +1,115 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+var _ = Describe("Report", func() {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	certs := []monitoringv1alpha1.MonitoredCertificateStatus{
+		{
+			Name: "internal-shop-web", Type: "internal", Path: "shop/web", Namespace: "shop", Status: "expiring",
+			Expiry: "2024-06-11T12:00:00Z", Subject: "CN=web|shop", Issuer: "CN=ca", DNSNames: []string{"a.example", "b.example"},
+			Fingerprint: "abc", Owner: "shop-team",
+		},
+		{Name: "external-cp1-/etc/kubernetes/pki/ca.crt", Type: "external", Path: "/etc/kubernetes/pki/ca.crt", Node: "cp1", Status: "expired", Expiry: "2024-05-30T12:00:00Z"},
+		{Name: "internal-shop-api", Type: "internal", Path: "shop/api", Namespace: "shop", Status: "valid", Expiry: "2025-06-01T12:00:00Z", Owner: "shop-team"},
+	}
+	render := func(f Format) []byte {
+		var buf bytes.Buffer
+		Expect(Write(&buf, f, New(certs, now))).To(Succeed())
+		return buf.Bytes()
+	}
+
+	It("parses format names and aliases", func() {
+		for _, f := range Formats() {
+			Expect(ParseFormat(string(f))).To(Equal(f))
+		}
+		Expect(ParseFormat("MD")).To(Equal(Markdown))
+		Expect(ParseFormat("yml")).To(Equal(YAML))
+		_, err := ParseFormat("pdf")
+		Expect(err).To(MatchError(ContainSubstring("json, yaml, csv, markdown, junit, sarif")))
+	})
+
+	It("renders the result model as JSON and YAML", func() {
+		for _, data := range [][]byte{render(JSON), render(YAML)} {
+			var r Document
+			Expect(yaml.Unmarshal(data, &r)).To(Succeed())
+			Expect(r.GeneratedAt).To(Equal(now))
+			Expect(r.Summary).To(Equal(map[string]int{"expiring": 1, "expired": 1, "valid": 1}))
+			Expect(r.Owners).To(Equal(map[string]map[string]int{"shop-team": {"expiring": 1, "valid": 1}}))
+			Expect(r.Certificates).To(HaveLen(3))
+			Expect(r.Certificates[0].Name).To(Equal("external-cp1-/etc/kubernetes/pki/ca.crt"))
+			Expect(r.Certificates[2].DNSNames).To(Equal([]string{"a.example", "b.example"}))
+		}
+	})
+
+	It("renders one CSV row per certificate", func() {
+		records, err := csv.NewReader(bytes.NewReader(render(CSV))).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveLen(4))
+		Expect(records[0]).To(Equal(csvHeader))
+		Expect(records[3][0]).To(Equal("internal-shop-web"))
+		Expect(records[3][7]).To(Equal("10"))
+		Expect(records[3][11]).To(Equal("a.example;b.example"))
+		Expect(records[3][15]).To(Equal("shop-team"))
+	})
+
+	It("renders a Markdown table", func() {
+		md := string(render(Markdown))
+		Expect(md).To(ContainSubstring("3 certificates: 1 expired, 1 expiring, 1 valid."))
+		Expect(md).To(ContainSubstring(`| internal-shop-web | shop/web | expiring | 2024-06-11T12:00:00Z | 10 | CN=web\|shop | CN=ca |`))
+		Expect(md).To(ContainSubstring("| cp1:/etc/kubernetes/pki/ca.crt | expired |"))
+		Expect(md).To(ContainSubstring("| shop-team | 1 expiring, 1 valid |"))
+	})
+
+	It("fails the JUnit test cases of certificates that are not valid", func() {
+		var doc junitTestSuites
+		Expect(xml.Unmarshal(render(JUnit), &doc)).To(Succeed())
+		Expect(doc.Tests).To(Equal(3))
+		Expect(doc.Failures).To(Equal(2))
+		cases := doc.Suites[0].Cases
+		Expect(cases[0].ClassName).To(Equal("cp1"))
+		Expect(cases[0].Failure.Message).To(Equal("Certificate cp1:/etc/kubernetes/pki/ca.crt expired 2 days ago, on 2024-05-30T12:00:00Z"))
+		Expect(cases[1].Failure).To(BeNil())
+		Expect(cases[2].Failure.Type).To(Equal("expiring"))
+		Expect(cases[2].Failure.Text).To(ContainSubstring("DNS names: a.example, b.example"))
+	})
+
+	It("reports certificates needing attention as SARIF results", func() {
+		var log sarifLog
+		Expect(json.Unmarshal(render(SARIF), &log)).To(Succeed())
+		Expect(log.Version).To(Equal("2.1.0"))
+		results := log.Runs[0].Results
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].RuleID).To(Equal("certificate-expired"))
+		Expect(results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI).To(Equal("file:///etc/kubernetes/pki/ca.crt"))
+		Expect(results[1].Level).To(Equal("warning"))
+		Expect(results[1].Locations[0].LogicalLocations[0].FullyQualifiedName).To(Equal("shop/web"))
+		Expect(results[1].PartialFingerprints).To(HaveKeyWithValue("certificateFingerprint/v1", "abc"))
+	})
+
+	It("aligns tables and shows the days left", func() {
+		var buf bytes.Buffer
+		columns := []Column{
+			{Header: "NAME", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string { return c.Name }},
+			DaysColumn(now),
+		}
+		Expect(WriteTable(&buf, columns, append(certs[:1:1], monitoringv1alpha1.MonitoredCertificateStatus{Name: "unknown"}), "none")).To(Succeed())
+		Expect(buf.String()).To(Equal("NAME                DAYS\n" + "internal-shop-web   10\n" + "unknown             ?\n"))
+
+		buf.Reset()
+		Expect(WriteTable(&buf, columns, nil, "none")).To(Succeed())
+		Expect(buf.String()).To(Equal("none\n"))
+	})
+})
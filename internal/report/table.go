@@ -0,0 +1,52 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	monitoringv1alpha1 "egarciam.com/checkcert/api/v1alpha1"
+)
+
+// Column is a column of a table: its header and the cell of each certificate.
+type Column struct {
+	Header string
+	Value  func(c monitoringv1alpha1.MonitoredCertificateStatus) string
+}
+
+// WriteTable writes one row per certificate, in the layout of kubectl get.
+// empty is written instead when there are no certificates.
+func WriteTable(w io.Writer, columns []Column, certs []monitoringv1alpha1.MonitoredCertificateStatus, empty string) error {
+	if len(certs) == 0 {
+		_, err := fmt.Fprintln(w, empty)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = col.Header
+	}
+	fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	for _, c := range certs {
+		for i, col := range columns {
+			cells[i] = col.Value(c)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// DaysColumn shows the whole days until expiry, negative once expired, and
+// "?" when the expiry is unknown.
+func DaysColumn(now time.Time) Column {
+	return Column{Header: "DAYS", Value: func(c monitoringv1alpha1.MonitoredCertificateStatus) string {
+		days, ok := DaysRemaining(c, now)
+		if !ok {
+			return "?"
+		}
+		return strconv.Itoa(days)
+	}}
+}
@@ -0,0 +1,130 @@
+package scan
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Options selects the files a walk returns.
+type Options struct {
+	// Include are glob patterns, in filepath.Match syntax, a file has to
+	// match to be returned. A pattern matches either the file name or the
+	// path relative to the walked root. Every file matches when empty.
+	Include []string
+	// Exclude are glob patterns of files and directories to skip, matched
+	// like Include.
+	Exclude []string
+	// FollowSymlinks walks into linked directories and returns linked files.
+	// Otherwise symlinks below the roots are skipped. Roots are always
+	// followed.
+	FollowSymlinks bool
+}
+
+// Walk returns the files below the given roots selected by the options, in
+// lexical order per root. A root may be a file. Entries that cannot be read
+// are returned as errors and do not stop the walk.
+func Walk(roots []string, opts Options) ([]string, []error) {
+	w := &walker{opts: opts, visited: map[string]bool{}}
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			w.errs = append(w.errs, err)
+			continue
+		}
+		if !info.IsDir() {
+			// Files named explicitly are taken as they are.
+			w.files = append(w.files, root)
+			continue
+		}
+		w.dir(root, root)
+	}
+	return w.files, w.errs
+}
+
+type walker struct {
+	opts  Options
+	files []string
+	errs  []error
+	// visited holds the resolved directories already walked, so following a
+	// symlink loop terminates.
+	visited map[string]bool
+}
+
+func (w *walker) dir(root, dir string) {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		w.errs = append(w.errs, err)
+		return
+	}
+	if w.visited[real] {
+		return
+	}
+	w.visited[real] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.errs = append(w.errs, err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if w.matches(w.opts.Exclude, root, path) {
+			continue
+		}
+
+		mode := e.Type()
+		if mode&fs.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				w.errs = append(w.errs, fmt.Errorf("broken symlink %s: %w", path, err))
+				continue
+			}
+			mode = info.Mode().Type()
+		}
+
+		switch {
+		case mode.IsDir():
+			w.dir(root, path)
+		case mode.IsRegular():
+			if len(w.opts.Include) == 0 || w.matches(w.opts.Include, root, path) {
+				w.files = append(w.files, path)
+			}
+		}
+	}
+}
+
+// matches reports whether any pattern matches the name or the root-relative
+// path of a file.
+func (w *walker) matches(patterns []string, root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	name := filepath.Base(path)
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePatterns reports the first malformed glob pattern.
+func ValidatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk", func() {
+	var root string
+
+	write := func(rel string) {
+		path := filepath.Join(root, rel)
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("x"), 0o644)).To(Succeed())
+	}
+	rel := func(files []string) []string {
+		out := make([]string, 0, len(files))
+		for _, f := range files {
+			r, err := filepath.Rel(root, f)
+			Expect(err).NotTo(HaveOccurred())
+			out = append(out, r)
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		write("ca.crt")
+		write("ca.key")
+		write("etcd/server.pem")
+		write("etcd/old/server.pem")
+		Expect(os.Symlink(filepath.Join(root, "etcd"), filepath.Join(root, "link"))).To(Succeed())
+		// A loop back to the root.
+		Expect(os.Symlink(root, filepath.Join(root, "etcd", "up"))).To(Succeed())
+	})
+
+	It("selects files by name or relative path", func() {
+		files, errs := Walk([]string{root}, Options{Include: []string{"*.crt", "*.pem"}, Exclude: []string{"etcd/old"}})
+		Expect(errs).To(BeEmpty())
+		Expect(rel(files)).To(Equal([]string{"ca.crt", "etcd/server.pem"}))
+	})
+
+	It("skips symlinks unless asked to follow them", func() {
+		files, _ := Walk([]string{root}, Options{Include: []string{"server.pem"}})
+		Expect(rel(files)).To(Equal([]string{"etcd/old/server.pem", "etcd/server.pem"}))
+
+		// The linked directory was walked already through etcd, and the loop
+		// back to the root ends the walk.
+		files, errs := Walk([]string{filepath.Join(root, "link")}, Options{Include: []string{"*.crt", "server.pem"}, FollowSymlinks: true})
+		Expect(errs).To(BeEmpty())
+		Expect(files).To(HaveLen(3))
+		Expect(files).To(ContainElement(filepath.Join(root, "link", "up", "ca.crt")))
+	})
+
+	It("takes files named as roots and reports missing ones", func() {
+		files, errs := Walk([]string{filepath.Join(root, "ca.key"), filepath.Join(root, "missing")}, Options{Include: []string{"*.crt"}})
+		Expect(rel(files)).To(Equal([]string{"ca.key"}))
+		Expect(errs).To(HaveLen(1))
+	})
+
+	It("rejects malformed patterns", func() {
+		Expect(ValidatePatterns([]string{"*.crt"})).To(Succeed())
+		Expect(ValidatePatterns([]string{"[.crt"})).NotTo(Succeed())
+	})
+})
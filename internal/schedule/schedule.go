@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the next time a scan is due after a given instant.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Interval is a fixed period between scans.
+type Interval time.Duration
+
+// Next returns t plus the interval.
+func (i Interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Parse builds a Schedule from a monitor spec value. The value can be a Go
+// duration ("15m", "24h") or a standard 5-field cron expression, including
+// descriptors such as "@daily". An empty value falls back to the given
+// default interval.
+func Parse(spec string, fallback time.Duration) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Interval(fallback), nil
+	}
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule interval must be positive, got %q", spec)
+		}
+		return Interval(d), nil
+	}
+
+	s, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q is neither a duration nor a cron expression: %w", spec, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,40 @@
+package schedule
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	now := time.Date(2024, 3, 10, 10, 30, 0, 0, time.UTC)
+
+	It("falls back to the default interval when empty", func() {
+		s, err := Parse("", time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Next(now)).To(Equal(now.Add(time.Hour)))
+	})
+
+	It("accepts a duration", func() {
+		s, err := Parse("15m", time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Next(now)).To(Equal(now.Add(15 * time.Minute)))
+	})
+
+	It("accepts a cron expression", func() {
+		s, err := Parse("0 6 * * *", time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Next(now)).To(Equal(time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC)))
+	})
+
+	It("rejects non-positive intervals", func() {
+		_, err := Parse("-5m", time.Hour)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects garbage", func() {
+		_, err := Parse("every tuesday", time.Hour)
+		Expect(err).To(HaveOccurred())
+	})
+})
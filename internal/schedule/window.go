@@ -0,0 +1,98 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a daily time range on some weekdays in a time zone, such as
+// business hours.
+type Window struct {
+	days     map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// ParseWindow builds a Window. Days are three-letter weekday names and
+// default to Monday to Friday; start and end are "HH:MM" and default to
+// 09:00 and 18:00; the zone is an IANA name and defaults to UTC.
+func ParseWindow(days []string, start, end, zone string) (*Window, error) {
+	w := &Window{days: map[time.Weekday]bool{}, location: time.UTC}
+	if len(days) == 0 {
+		days = []string{"Mon", "Tue", "Wed", "Thu", "Fri"}
+	}
+	for _, d := range days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", d)
+		}
+		w.days[wd] = true
+	}
+
+	var err error
+	if w.start, err = clock(start, 9*time.Hour); err != nil {
+		return nil, err
+	}
+	if w.end, err = clock(end, 18*time.Hour); err != nil {
+		return nil, err
+	}
+	if w.end <= w.start {
+		return nil, fmt.Errorf("window end %q is not after start %q", end, start)
+	}
+	if zone != "" {
+		if w.location, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", zone, err)
+		}
+	}
+	return w, nil
+}
+
+// clock parses "HH:MM" as an offset from midnight.
+func clock(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls in the window.
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	if !w.days[t.Weekday()] {
+		return false
+	}
+	offset := t.Sub(midnight(t))
+	return offset >= w.start && offset < w.end
+}
+
+// Next returns the next time the window opens at or after t, or t itself
+// when it is open.
+func (w *Window) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	local := t.In(w.location)
+	for i := 0; i <= 7; i++ {
+		day := midnight(local).AddDate(0, 0, i)
+		open := day.Add(w.start)
+		if w.days[day.Weekday()] && !open.Before(local) {
+			return open
+		}
+	}
+	return t
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
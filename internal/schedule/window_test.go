@@ -0,0 +1,51 @@
+package schedule
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Window", func() {
+	// Friday 2024-03-08.
+	friday := func(hour, min int) time.Time { return time.Date(2024, 3, 8, hour, min, 0, 0, time.UTC) }
+
+	It("defaults to weekday office hours in UTC", func() {
+		w, err := ParseWindow(nil, "", "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Contains(friday(9, 0))).To(BeTrue())
+		Expect(w.Contains(friday(17, 59))).To(BeTrue())
+		Expect(w.Contains(friday(18, 0))).To(BeFalse())
+		Expect(w.Contains(friday(8, 59))).To(BeFalse())
+		Expect(w.Contains(friday(12, 0).AddDate(0, 0, 1))).To(BeFalse())
+	})
+
+	It("finds the next opening", func() {
+		w, err := ParseWindow(nil, "", "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Next(friday(7, 0))).To(Equal(friday(9, 0)))
+		Expect(w.Next(friday(10, 0))).To(Equal(friday(10, 0)))
+		// Friday evening waits for Monday morning.
+		Expect(w.Next(friday(19, 0))).To(Equal(time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)))
+	})
+
+	It("honours the time zone", func() {
+		w, err := ParseWindow([]string{"Fri"}, "08:00", "12:00", "Europe/Madrid")
+		Expect(err).NotTo(HaveOccurred())
+		// 07:30 UTC is 08:30 in Madrid in winter.
+		Expect(w.Contains(friday(7, 30))).To(BeTrue())
+		Expect(w.Contains(friday(11, 30))).To(BeFalse())
+	})
+
+	It("rejects invalid settings", func() {
+		_, err := ParseWindow([]string{"Funday"}, "", "", "")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseWindow(nil, "18:00", "09:00", "")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseWindow(nil, "9am", "", "")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseWindow(nil, "", "", "Mars/Olympus")
+		Expect(err).To(HaveOccurred())
+	})
+})
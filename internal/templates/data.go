@@ -0,0 +1,139 @@
+package templates
+
+import "time"
+
+// Certificate is the certificate metadata available to templates. It is also
+// the certificate object of the webhook payload, so the JSON names are part
+// of that schema.
+type Certificate struct {
+	Name         string   `json:"name"`
+	Namespace    string   `json:"namespace,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Path         string   `json:"path,omitempty"`
+	Status       string   `json:"status"`
+	Expiry       string   `json:"expiry,omitempty"`
+	DaysLeft     int      `json:"daysLeft"`
+	Fingerprint  string   `json:"fingerprint,omitempty"`
+	Subject      string   `json:"subject,omitempty"`
+	Issuer       string   `json:"issuer,omitempty"`
+	DNSNames     []string `json:"dnsNames,omitempty"`
+	NotBefore    string   `json:"notBefore,omitempty"`
+	SerialNumber string   `json:"serialNumber,omitempty"`
+	// Owner is the team owning the certificate.
+	Owner string `json:"owner,omitempty"`
+	// UsedBy describes the workloads using the certificate, e.g.
+	// "deployment web in namespace shop".
+	UsedBy []string `json:"usedBy,omitempty"`
+}
+
+// Thresholds are the limits the monitor evaluates certificates against.
+type Thresholds struct {
+	WarningDays      int
+	CriticalDays     int
+	ReminderInterval time.Duration
+}
+
+// Alert is the data of a single certificate notification.
+type Alert struct {
+	Monitor    string
+	Cluster    string
+	Thresholds Thresholds
+	// Kind is "transition", "reminder", "escalation" or "resolved".
+	Kind string
+	// PreviousStatus is what recipients were last notified about.
+	PreviousStatus string
+	// Rotated is set when the certificate was replaced since the last scan.
+	Rotated     bool
+	Certificate Certificate
+}
+
+// Digest is the data of a digest mail.
+type Digest struct {
+	Monitor    string
+	Cluster    string
+	Thresholds Thresholds
+	Generated  time.Time
+	// Counts holds the number of findings per status.
+	Counts map[string]int
+	// Groups holds the findings per namespace, most severe first.
+	Groups []Group
+	// Resolved lists certificates that are valid again since the last digest.
+	Resolved []Certificate
+}
+
+// Group is the findings of one namespace.
+type Group struct {
+	Namespace    string
+	Certificates []Certificate
+}
+
+// Findings returns the number of certificates listed in the groups.
+func (d Digest) Findings() int {
+	n := 0
+	for _, g := range d.Groups {
+		n += len(g.Certificates)
+	}
+	return n
+}
+
+// sampleCertificate, sampleAlerts and sampleDigests exercise every field and
+// every kind of notification, so that Load can reject templates referring to
+// fields that do not exist, whichever branch refers to them.
+var sampleCertificate = Certificate{
+	Name:         "internal-default-example",
+	Namespace:    "default",
+	Type:         "internal",
+	Path:         "default/example",
+	Status:       "expiring",
+	Expiry:       "2030-01-01T00:00:00Z",
+	DaysLeft:     10,
+	Fingerprint:  "0000",
+	Subject:      "CN=example.com",
+	Issuer:       "CN=Example CA",
+	DNSNames:     []string{"example.com"},
+	NotBefore:    "2029-01-01T00:00:00Z",
+	SerialNumber: "1",
+	Owner:        "platform",
+	UsedBy:       []string{"deployment example in namespace default"},
+}
+
+var sampleThresholds = Thresholds{WarningDays: 30, CriticalDays: 7, ReminderInterval: 24 * time.Hour}
+
+var sampleAlerts = []any{
+	sampleAlert("transition", "valid", false),
+	sampleAlert("reminder", "expiring", false),
+	sampleAlert("escalation", "critical", false),
+	sampleAlert("resolved", "expired", true),
+}
+
+func sampleAlert(kind, previousStatus string, rotated bool) Alert {
+	return Alert{
+		Monitor:        "sample",
+		Cluster:        "cluster",
+		Thresholds:     sampleThresholds,
+		Kind:           kind,
+		PreviousStatus: previousStatus,
+		Rotated:        rotated,
+		Certificate:    sampleCertificate,
+	}
+}
+
+var sampleDigest = Digest{
+	Monitor:    "sample",
+	Cluster:    "cluster",
+	Thresholds: sampleThresholds,
+	Counts:     map[string]int{"expiring": 1},
+	Groups:     []Group{{Namespace: "default", Certificates: []Certificate{sampleCertificate}}},
+	Resolved:   []Certificate{sampleCertificate},
+}
+
+var sampleDigests = []any{
+	sampleDigest,
+	// Only resolved certificates, without cluster name.
+	Digest{
+		Monitor:    "sample",
+		Thresholds: sampleThresholds,
+		Counts:     map[string]int{},
+		Resolved:   []Certificate{sampleCertificate},
+	},
+}
@@ -0,0 +1,67 @@
+package templates
+
+const defaultAlertSubject = `{{ if eq .Kind "reminder" }}Reminder: certificate {{ .Certificate.Name }} is {{ .Certificate.Status }}
+{{- else if eq .Kind "escalation" }}Escalation: certificate {{ .Certificate.Name }} is still {{ .Certificate.Status }}
+{{- else if eq .Kind "resolved" }}Resolved: certificate {{ .Certificate.Name }} {{ if .Rotated }}was renewed{{ else }}is valid{{ end }}
+{{- else }}Certificate {{ .Certificate.Name }} is {{ .Certificate.Status }}{{ end }}`
+
+const defaultAlertText = `{{ with .Certificate -}}
+{{ if eq $.Kind "resolved" -}}
+The certificate {{ .Name }}, previously {{ $.PreviousStatus }}, {{ if $.Rotated }}was replaced and {{ end }}is now valid until {{ .Expiry }}.
+{{- else if eq $.Kind "reminder" -}}
+The certificate {{ .Name }} is still {{ .Status }} on {{ .Expiry }}.
+{{- else if eq $.Kind "escalation" -}}
+The certificate {{ .Name }} is still {{ .Status }} on {{ .Expiry }} and has not been renewed despite earlier alerts.
+{{- else -}}
+The certificate {{ .Name }} is {{ .Status }} on {{ .Expiry }}.
+{{- end }}
+{{- if .Subject }}
+
+Subject: {{ .Subject }}
+Issuer:  {{ .Issuer }}
+{{- if .DNSNames }}
+DNS:     {{ join .DNSNames ", " }}
+{{- end }}
+{{- end }}
+{{- if .UsedBy }}
+
+Used by:
+{{- range .UsedBy }}
+  - {{ . }}
+{{- end }}
+{{- end }}
+
+{{ if .Namespace }}Namespace: {{ .Namespace }}
+{{ end }}{{ if .Owner }}Owner: {{ .Owner }}
+{{ end }}Monitor: {{ $.Monitor }}{{ if $.Cluster }} ({{ $.Cluster }}){{ end }}
+{{ end }}`
+
+const defaultDigestSubject = `[{{ .Monitor }}] {{ .Findings }} certificate(s) need attention`
+
+const defaultDigestText = `Certificate digest for {{ .Monitor }}{{ if .Cluster }} in {{ .Cluster }}{{ end }} ({{ .Generated.Format "2006-01-02 15:04 MST" }})
+Expired: {{ index .Counts "expired" }}  Critical: {{ index .Counts "critical" }}  Expiring: {{ index .Counts "expiring" }}  (warning at {{ .Thresholds.WarningDays }} days, critical at {{ .Thresholds.CriticalDays }})
+{{ range .Groups }}
+== {{ .Namespace }} ==
+{{ printf "%-10s %6s  %-25s %s" "SEVERITY" "DAYS" "EXPIRY" "CERTIFICATE" }}
+{{ range .Certificates }}{{ printf "%-10s %6d  %-25s %s" .Status .DaysLeft .Expiry .Name }}
+{{ end }}{{ end }}{{ if .Resolved }}
+== Resolved since the last digest ==
+{{ range .Resolved }}{{ printf "%-10s %6d  %-25s %s" .Status .DaysLeft .Expiry .Name }}
+{{ end }}{{ end }}`
+
+const defaultDigestHTML = `<html><body>
+<h2>Certificate digest for {{ .Monitor }}{{ if .Cluster }} in {{ .Cluster }}{{ end }}</h2>
+<p>{{ .Generated.Format "2006-01-02 15:04 MST" }} &mdash; expired: {{ index .Counts "expired" }}, critical: {{ index .Counts "critical" }}, expiring: {{ index .Counts "expiring" }}</p>
+{{ range .Groups }}<h3>{{ .Namespace }}</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<thead><tr><th>Severity</th><th>Days left</th><th>Expiry</th><th>Certificate</th><th>Issuer</th><th>Type</th><th>Path</th></tr></thead>
+<tbody>
+{{ range .Certificates }}<tr><td>{{ .Status }}</td><td align="right">{{ .DaysLeft }}</td><td>{{ .Expiry }}</td><td>{{ .Name }}</td><td>{{ .Issuer }}</td><td>{{ .Type }}</td><td>{{ .Path }}</td></tr>
+{{ end }}</tbody>
+</table>
+{{ end }}{{ if .Resolved }}<h3>Resolved since the last digest</h3>
+<ul>
+{{ range .Resolved }}<li>{{ .Name }} &mdash; valid until {{ .Expiry }}</li>
+{{ end }}</ul>
+{{ end }}</body></html>
+`
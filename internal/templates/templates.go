@@ -0,0 +1,178 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// ConfigMap keys holding custom templates. Subjects and text parts use
+// text/template, HTML parts use html/template. Missing keys keep the default.
+const (
+	AlertSubjectKey  = "alert.subject"
+	AlertTextKey     = "alert.text"
+	AlertHTMLKey     = "alert.html"
+	DigestSubjectKey = "digest.subject"
+	DigestTextKey    = "digest.text"
+	DigestHTMLKey    = "digest.html"
+)
+
+// Set is a complete set of notification templates.
+type Set struct {
+	alertSubject  *texttemplate.Template
+	alertText     *texttemplate.Template
+	alertHTML     *htmltemplate.Template
+	digestSubject *texttemplate.Template
+	digestText    *texttemplate.Template
+	digestHTML    *htmltemplate.Template
+}
+
+// Message is a rendered notification. HTML is empty when the set has no
+// HTML template for it.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+var funcs = map[string]any{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+}
+
+var defaults = mustLoad(map[string]string{
+	AlertSubjectKey:  defaultAlertSubject,
+	AlertTextKey:     defaultAlertText,
+	DigestSubjectKey: defaultDigestSubject,
+	DigestTextKey:    defaultDigestText,
+	DigestHTMLKey:    defaultDigestHTML,
+})
+
+// Builtin returns the built-in templates.
+func Builtin() *Set {
+	return defaults
+}
+
+// Load parses the templates found in data on top of the built-in ones. Every
+// template is executed against sample data of every kind, so syntax errors as
+// well as references to unknown fields are reported here rather than when a
+// notification is due.
+func Load(data map[string]string) (*Set, error) {
+	set := *defaults
+	var err error
+	if v, ok := data[AlertSubjectKey]; ok {
+		if set.alertSubject, err = parseText(AlertSubjectKey, v, sampleAlerts...); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := data[AlertTextKey]; ok {
+		if set.alertText, err = parseText(AlertTextKey, v, sampleAlerts...); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := data[AlertHTMLKey]; ok {
+		if set.alertHTML, err = parseHTML(AlertHTMLKey, v, sampleAlerts...); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := data[DigestSubjectKey]; ok {
+		if set.digestSubject, err = parseText(DigestSubjectKey, v, sampleDigests...); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := data[DigestTextKey]; ok {
+		if set.digestText, err = parseText(DigestTextKey, v, sampleDigests...); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := data[DigestHTMLKey]; ok {
+		if set.digestHTML, err = parseHTML(DigestHTMLKey, v, sampleDigests...); err != nil {
+			return nil, err
+		}
+	}
+	return &set, nil
+}
+
+func mustLoad(data map[string]string) *Set {
+	set := &Set{}
+	var err error
+	if set.alertSubject, err = parseText(AlertSubjectKey, data[AlertSubjectKey], sampleAlerts...); err != nil {
+		panic(err)
+	}
+	if set.alertText, err = parseText(AlertTextKey, data[AlertTextKey], sampleAlerts...); err != nil {
+		panic(err)
+	}
+	if set.digestSubject, err = parseText(DigestSubjectKey, data[DigestSubjectKey], sampleDigests...); err != nil {
+		panic(err)
+	}
+	if set.digestText, err = parseText(DigestTextKey, data[DigestTextKey], sampleDigests...); err != nil {
+		panic(err)
+	}
+	if set.digestHTML, err = parseHTML(DigestHTMLKey, data[DigestHTMLKey], sampleDigests...); err != nil {
+		panic(err)
+	}
+	return set
+}
+
+func parseText(name, text string, samples ...any) (*texttemplate.Template, error) {
+	t, err := texttemplate.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+	for _, sample := range samples {
+		if err := t.Execute(&bytes.Buffer{}, sample); err != nil {
+			return nil, fmt.Errorf("invalid template %s: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+func parseHTML(name, text string, samples ...any) (*htmltemplate.Template, error) {
+	t, err := htmltemplate.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+	for _, sample := range samples {
+		if err := t.Execute(&bytes.Buffer{}, sample); err != nil {
+			return nil, fmt.Errorf("invalid template %s: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+// RenderAlert renders a single certificate notification.
+func (s *Set) RenderAlert(a Alert) (Message, error) {
+	return render(s.alertSubject, s.alertText, s.alertHTML, a)
+}
+
+// RenderDigest renders a digest mail.
+func (s *Set) RenderDigest(d Digest) (Message, error) {
+	return render(s.digestSubject, s.digestText, s.digestHTML, d)
+}
+
+func render(subject, text *texttemplate.Template, html *htmltemplate.Template, data any) (Message, error) {
+	var msg Message
+	var buf bytes.Buffer
+	if err := subject.Execute(&buf, data); err != nil {
+		return Message{}, err
+	}
+	// Headers cannot span lines
+	msg.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := text.Execute(&buf, data); err != nil {
+		return Message{}, err
+	}
+	msg.Text = buf.String()
+
+	if html != nil {
+		buf.Reset()
+		if err := html.Execute(&buf, data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
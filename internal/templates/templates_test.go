@@ -0,0 +1,58 @@
+package templates
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Templates", func() {
+	It("renders alerts with the built-in templates", func() {
+		msg, err := Builtin().RenderAlert(sampleAlert("transition", "valid", false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Subject).To(Equal("Certificate internal-default-example is expiring"))
+		Expect(msg.Text).To(ContainSubstring("Issuer:  CN=Example CA"))
+		Expect(msg.Text).To(ContainSubstring("Used by:\n  - deployment example in namespace default"))
+		Expect(msg.Text).To(ContainSubstring("Monitor: sample (cluster)"))
+		Expect(msg.HTML).To(BeEmpty())
+	})
+
+	It("overrides only the templates given", func() {
+		set, err := Load(map[string]string{
+			AlertSubjectKey: `[{{ .Cluster }}] {{ .Certificate.Name }}: {{ .Certificate.DaysLeft }} days left (warning at {{ .Thresholds.WarningDays }})`,
+			AlertHTMLKey:    `<p>{{ .Certificate.Subject }}</p>`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		msg, err := set.RenderAlert(sampleAlert("transition", "valid", false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Subject).To(Equal("[cluster] internal-default-example: 10 days left (warning at 30)"))
+		Expect(msg.Text).To(ContainSubstring("is expiring on"))
+		Expect(msg.HTML).To(Equal("<p>CN=example.com</p>"))
+	})
+
+	It("keeps subjects on one line", func() {
+		set, err := Load(map[string]string{DigestSubjectKey: "{{ .Monitor }}\n{{ .Findings }}"})
+		Expect(err).NotTo(HaveOccurred())
+		msg, err := set.RenderDigest(sampleDigest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Subject).To(Equal("sample 1"))
+	})
+
+	It("rejects templates that do not parse", func() {
+		_, err := Load(map[string]string{AlertTextKey: "{{ .Certificate.Name "})
+		Expect(err).To(MatchError(ContainSubstring(AlertTextKey)))
+	})
+
+	It("rejects templates referring to unknown fields", func() {
+		_, err := Load(map[string]string{DigestHTMLKey: "{{ .Certificates }}"})
+		Expect(err).To(MatchError(ContainSubstring(DigestHTMLKey)))
+	})
+
+	It("checks the branches of every notification kind", func() {
+		_, err := Load(map[string]string{AlertSubjectKey: `{{ if eq .Kind "reminder" }}{{ .Certificate.Team }}{{ end }}`})
+		Expect(err).To(MatchError(ContainSubstring(AlertSubjectKey)))
+
+		_, err = Load(map[string]string{DigestTextKey: `{{ if not .Groups }}{{ .Resolved.Name }}{{ end }}`})
+		Expect(err).To(MatchError(ContainSubstring(DigestTextKey)))
+	})
+})
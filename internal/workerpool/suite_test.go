@@ -0,0 +1,14 @@
+package workerpool
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWorkerPool(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "WorkerPool Suite")
+}
@@ -0,0 +1,88 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Options bounds a pool run.
+type Options struct {
+	// Parallelism is the maximum number of tasks running at once. Values
+	// below 1 run tasks one at a time.
+	Parallelism int
+	// TaskTimeout limits each task. Zero means no per-task limit.
+	TaskTimeout time.Duration
+	// Deadline limits the whole run. Tasks not finished by then get the
+	// context error as result. Zero means no overall limit.
+	Deadline time.Duration
+}
+
+// Result is the outcome of a single task.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Run executes fn for every index in [0, n) and returns the results in input
+// order, regardless of the order in which the tasks finished.
+func Run[T any](ctx context.Context, opts Options, n int, fn func(ctx context.Context, i int) (T, error)) []Result[T] {
+	results := make([]Result[T], n)
+	if n == 0 {
+		return results
+	}
+
+	if opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Deadline)
+		defer cancel()
+	}
+
+	workers := opts.Parallelism
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runTask(ctx, opts.TaskTimeout, i, fn)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func runTask[T any](ctx context.Context, timeout time.Duration, i int, fn func(ctx context.Context, i int) (T, error)) Result[T] {
+	if err := ctx.Err(); err != nil {
+		return Result[T]{Err: err}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	v, err := fn(ctx, i)
+	return Result[T]{Value: v, Err: err}
+}
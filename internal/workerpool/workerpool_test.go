@@ -0,0 +1,66 @@
+package workerpool
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Run", func() {
+	ctx := context.Background()
+
+	It("returns results in input order", func() {
+		results := Run(ctx, Options{Parallelism: 4}, 20, func(_ context.Context, i int) (int, error) {
+			time.Sleep(time.Duration(20-i) * time.Millisecond)
+			return i * i, nil
+		})
+		Expect(results).To(HaveLen(20))
+		for i, r := range results {
+			Expect(r.Err).NotTo(HaveOccurred())
+			Expect(r.Value).To(Equal(i * i))
+		}
+	})
+
+	It("never exceeds the configured parallelism", func() {
+		var running, peak int32
+		Run(ctx, Options{Parallelism: 3}, 30, func(_ context.Context, _ int) (struct{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return struct{}{}, nil
+		})
+		Expect(atomic.LoadInt32(&peak)).To(BeNumerically("<=", 3))
+	})
+
+	It("applies the per-task timeout", func() {
+		results := Run(ctx, Options{Parallelism: 2, TaskTimeout: 10 * time.Millisecond}, 2, func(ctx context.Context, i int) (int, error) {
+			if i == 0 {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}
+			return 1, nil
+		})
+		Expect(results[0].Err).To(MatchError(context.DeadlineExceeded))
+		Expect(results[1].Err).NotTo(HaveOccurred())
+	})
+
+	It("stops handing out tasks once the deadline passed", func() {
+		var started int32
+		results := Run(ctx, Options{Parallelism: 1, Deadline: 30 * time.Millisecond}, 100, func(ctx context.Context, _ int) (int, error) {
+			atomic.AddInt32(&started, 1)
+			time.Sleep(10 * time.Millisecond)
+			return 0, nil
+		})
+		Expect(atomic.LoadInt32(&started)).To(BeNumerically("<", 100))
+		Expect(results[99].Err).To(MatchError(context.DeadlineExceeded))
+	})
+})